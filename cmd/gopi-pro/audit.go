@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/yangruihan/go-pi-pro/internal/agent"
+	"github.com/yangruihan/go-pi-pro/internal/audit"
+)
+
+const auditUsage = `usage: gopi-pro audit list [--since date] [--until date] [--status s] [--query text] [--step text] [--working-dir dir]
+       gopi-pro audit diff [--output text|json] [--color auto|always|never] <runA> <runB>`
+
+func auditCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, auditUsage)
+		return exitError
+	}
+	switch args[0] {
+	case "list":
+		return auditListCommand(args[1:])
+	case "diff":
+		return auditDiffCommand(args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, auditUsage)
+		return exitError
+	}
+}
+
+func auditDirFlag(fs *flag.FlagSet) *string {
+	return fs.String("audit-dir", ".gopi-pro/runs", "directory containing run audit json")
+}
+
+func auditListCommand(args []string) int {
+	fs := flag.NewFlagSet("audit list", flag.ContinueOnError)
+	dir := auditDirFlag(fs)
+	since := fs.String("since", "", "only runs started at or after this time (YYYY-MM-DD or RFC3339)")
+	until := fs.String("until", "", "only runs started before this time (YYYY-MM-DD includes that day)")
+	status := fs.String("status", "", "only runs with this outcome: done, blocked or approval_denied")
+	query := fs.String("query", "", "case-insensitive text searched in the user input and plan goal")
+	step := fs.String("step", "", "case-insensitive text searched in step titles")
+	workdir := fs.String("working-dir", "", "only runs whose working directory is this directory or below it")
+	limit := fs.Int("limit", 20, "max runs to show, 0 means all")
+	output := fs.String("output", outputText, "output format: text or json")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitError
+	}
+	q, err := buildAuditQuery(*since, *until, *status, *workdir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit: %v\n", err)
+		return exitError
+	}
+	q.Text = strings.TrimSpace(*query)
+	q.Step = strings.TrimSpace(*step)
+	q.Limit = *limit
+	if *output != outputText && *output != outputJSON {
+		fmt.Fprintf(os.Stderr, "audit: invalid --output %q (want text or json)\n", *output)
+		return exitError
+	}
+
+	entries, err := audit.Index(*dir)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "audit: %v\n", err)
+		return exitError
+	}
+	entries = audit.Filter(entries, q)
+	if *output == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(entries)
+		return exitOK
+	}
+	if len(entries) == 0 {
+		fmt.Printf("(no matching runs) %s\n", *dir)
+		return exitOK
+	}
+	printAuditTable(os.Stdout, entries)
+	return exitOK
+}
+
+func buildAuditQuery(since, until, status, workdir string) (audit.Query, error) {
+	var q audit.Query
+	var err error
+	if q.Since, err = parseTimeFlag(since, false); err != nil {
+		return q, fmt.Errorf("invalid --since: %w", err)
+	}
+	if q.Until, err = parseTimeFlag(until, true); err != nil {
+		return q, fmt.Errorf("invalid --until: %w", err)
+	}
+	switch status = strings.ToLower(strings.TrimSpace(status)); status {
+	case "", agent.OutcomeDone, agent.OutcomeBlocked, agent.OutcomeApprovalDenied:
+		q.Outcome = status
+	default:
+		return q, fmt.Errorf("invalid --status %q (want done, blocked or approval_denied)", status)
+	}
+	if workdir = strings.TrimSpace(workdir); workdir != "" {
+		if q.WorkingDir, err = filepath.Abs(workdir); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// parseTimeFlag 接受 RFC3339 或本地时区的 YYYY-MM-DD；endOfDay 时日期表示当天结束（次日零点）。
+func parseTimeFlag(v string, endOfDay bool) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not YYYY-MM-DD or RFC3339", v)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func printAuditTable(w io.Writer, entries []audit.IndexEntry) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RUN_ID\tSTARTED\tDURATION\tSTATUS\tSTEPS\tGOAL")
+	for _, e := range entries {
+		started := e.StartedAt
+		if t, err := time.Parse(time.RFC3339, e.StartedAt); err == nil {
+			started = t.Local().Format("2006-01-02 15:04")
+		}
+		goal := strings.TrimSpace(e.Goal)
+		if goal == "" {
+			goal = strings.TrimSpace(e.UserInput)
+		}
+		duration := (time.Duration(e.DurationMs) * time.Millisecond).Round(time.Second)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d/%d\t%s\n", e.RunID, started, duration, e.Outcome, e.Done, len(e.Steps), clipRunes(oneLineText(goal), 60))
+	}
+	_ = tw.Flush()
+}
+
+func oneLineText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func clipRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "..."
+}
+
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+func auditDiffCommand(args []string) int {
+	fs := flag.NewFlagSet("audit diff", flag.ContinueOnError)
+	dir := auditDirFlag(fs)
+	output := fs.String("output", outputText, "output format: text or json")
+	color := fs.String("color", colorAuto, "colorize text output: auto, always or never")
+
+	// run 与参数可以交错书写：gopi-pro audit diff <runA> <runB> --output json
+	var refs []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return exitOK
+			}
+			return exitError
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		refs, args = append(refs, fs.Arg(0)), fs.Args()[1:]
+	}
+	if len(refs) != 2 {
+		fmt.Fprintln(os.Stderr, auditUsage)
+		return exitError
+	}
+	if *output != outputText && *output != outputJSON {
+		fmt.Fprintf(os.Stderr, "audit: invalid --output %q (want text or json)\n", *output)
+		return exitError
+	}
+	useColor, err := resolveColor(*color, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit: %v\n", err)
+		return exitError
+	}
+
+	runs := make([]audit.Run, 2)
+	for i, ref := range refs {
+		if runs[i], err = loadAuditRef(*dir, ref); err != nil {
+			fmt.Fprintf(os.Stderr, "audit: %v\n", err)
+			return exitError
+		}
+	}
+	d := audit.Diff(runs[0], runs[1])
+	if *output == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(d)
+		return exitOK
+	}
+	printAuditDiff(os.Stdout, d, useColor)
+	return exitOK
+}
+
+// loadAuditRef 接受审计目录中的 run id，或直接给出的审计文件路径。
+func loadAuditRef(dir, ref string) (audit.Run, error) {
+	path := agent.AuditPath(dir, ref)
+	if _, err := os.Stat(path); err != nil {
+		if info, ferr := os.Stat(ref); ferr == nil && !info.IsDir() {
+			path = ref
+		} else {
+			return audit.Run{}, fmt.Errorf("run %s not found in %s", ref, dir)
+		}
+	}
+	return audit.Load(path)
+}
+
+// resolveColor 在 auto 模式下仅当输出是终端且未设置 NO_COLOR 时启用颜色。
+func resolveColor(mode string, out *os.File) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case colorAlways:
+		return true, nil
+	case colorNever:
+		return false, nil
+	case colorAuto, "":
+		if os.Getenv("NO_COLOR") != "" {
+			return false, nil
+		}
+		info, err := out.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0, nil
+	default:
+		return false, fmt.Errorf("invalid --color %q (want auto, always or never)", mode)
+	}
+}
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+	ansiBold   = "\x1b[1m"
+)
+
+type diffPrinter struct {
+	w     io.Writer
+	color bool
+}
+
+func (p diffPrinter) line(code, format string, args ...any) {
+	text := fmt.Sprintf(format, args...)
+	if p.color && code != "" {
+		text = code + text + ansiReset
+	}
+	fmt.Fprintln(p.w, text)
+}
+
+func printAuditDiff(w io.Writer, d audit.RunDiff, color bool) {
+	p := diffPrinter{w: w, color: color}
+	p.line(ansiBold, "[AUDIT DIFF]")
+	p.line(ansiRed, "--- a: %s", runRefLine(d.A))
+	p.line(ansiGreen, "+++ b: %s", runRefLine(d.B))
+	if !d.Changed() {
+		p.line("", "(no differences)")
+	}
+	if d.A.Outcome != d.B.Outcome {
+		p.line(ansiYellow, "~ outcome: %s -> %s", d.A.Outcome, d.B.Outcome)
+	}
+	if d.A.DurationMs != d.B.DurationMs {
+		delta := time.Duration(d.B.DurationMs-d.A.DurationMs) * time.Millisecond
+		p.line("", "  duration: %s -> %s (%+.1fs)", msDuration(d.A.DurationMs), msDuration(d.B.DurationMs), delta.Seconds())
+	}
+	if d.A.TotalTokens != d.B.TotalTokens {
+		p.line("", "  tokens: %d -> %d (%+d)", d.A.TotalTokens, d.B.TotalTokens, d.B.TotalTokens-d.A.TotalTokens)
+	}
+	printTextChange(p, "READ SUMMARY", d.ReadSummary)
+	printTextChange(p, "GOAL", d.Goal)
+
+	p.line(ansiBold, "[STEPS] %d -> %d", d.A.Steps, d.B.Steps)
+	for _, s := range d.Steps {
+		switch s.Change {
+		case audit.StepAdded:
+			p.line(ansiGreen, "+ -/%d %s", s.B.Index, stepLabel(*s.B))
+		case audit.StepRemoved:
+			p.line(ansiRed, "- %d/- %s", s.A.Index, stepLabel(*s.A))
+		case audit.StepChanged:
+			label := stepLabel(*s.B)
+			if s.Moved {
+				label += " (moved)"
+			}
+			p.line(ansiYellow, "~ %d/%d %s", s.A.Index, s.B.Index, label)
+			for _, f := range s.Fields {
+				p.line(ansiYellow, "    %s: %s -> %s", f, stepField(*s.A, f), stepField(*s.B, f))
+			}
+		default:
+			p.line("", "  %d/%d %s", s.A.Index, s.B.Index, stepLabel(*s.B))
+		}
+	}
+	printTextChange(p, "FINAL", d.Final)
+}
+
+func runRefLine(r audit.RunRef) string {
+	started := r.StartedAt
+	if t, err := time.Parse(time.RFC3339, r.StartedAt); err == nil {
+		started = t.Local().Format("2006-01-02 15:04")
+	}
+	return fmt.Sprintf("%s  %s  %s  %s", r.RunID, started, r.Outcome, msDuration(r.DurationMs))
+}
+
+func msDuration(ms int64) time.Duration {
+	return (time.Duration(ms) * time.Millisecond).Round(100 * time.Millisecond)
+}
+
+func printTextChange(p diffPrinter, title string, c *audit.TextChange) {
+	if c == nil {
+		return
+	}
+	p.line(ansiBold, "[%s]", title)
+	for _, l := range strings.Split(strings.TrimRight(c.Diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(l, "+++"), strings.HasPrefix(l, "---"):
+			p.line(ansiBold, "%s", l)
+		case strings.HasPrefix(l, "@@"):
+			p.line(ansiCyan, "%s", l)
+		case strings.HasPrefix(l, "+"):
+			p.line(ansiGreen, "%s", l)
+		case strings.HasPrefix(l, "-"):
+			p.line(ansiRed, "%s", l)
+		default:
+			p.line("", "%s", l)
+		}
+	}
+}
+
+func stepLabel(s audit.StepSide) string {
+	label := fmt.Sprintf("%s %s [risk=%s", s.ID, clipRunes(oneLineText(s.Title), 60), s.Risk)
+	if s.RequiresApproval {
+		label += " approval"
+	}
+	if s.Status != "" {
+		label += fmt.Sprintf(" status=%s attempts=%d tools=%d", s.Status, s.Attempts, s.ToolCalls)
+	}
+	return label + "]"
+}
+
+func stepField(s audit.StepSide, field string) string {
+	switch field {
+	case "risk":
+		return s.Risk
+	case "requires_approval":
+		return strconv.FormatBool(s.RequiresApproval)
+	case "status":
+		if s.Status == "" {
+			return "(not run)"
+		}
+		return s.Status
+	case "attempts":
+		return strconv.Itoa(s.Attempts)
+	case "tool_calls":
+		return strconv.Itoa(s.ToolCalls)
+	case "write_tool_calls":
+		return strconv.Itoa(s.WriteToolCalls)
+	}
+	return ""
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yangruihan/go-pi-pro/internal/audit"
+)
+
+func TestBuildAuditQuery(t *testing.T) {
+	q, err := buildAuditQuery("2025-01-02", "2025-01-02", "Blocked", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Until.Sub(q.Since) != 24*time.Hour || q.Outcome != "blocked" {
+		t.Fatalf("date-only --until should include the whole day: %+v", q)
+	}
+	if q, err = buildAuditQuery("2025-01-02T03:04:05Z", "", "", "."); err != nil || q.Since.Hour() != 3 || q.WorkingDir == "." {
+		t.Fatalf("unexpected query %+v (%v)", q, err)
+	}
+	for _, args := range [][4]string{{"yesterday", "", "", ""}, {"", "", "failed", ""}} {
+		if _, err := buildAuditQuery(args[0], args[1], args[2], args[3]); err == nil {
+			t.Fatalf("expected error for %v", args)
+		}
+	}
+}
+
+func TestPrintAuditDiff(t *testing.T) {
+	a := audit.Run{RunID: "a", Outcome: audit.OutcomeDone, Plan: audit.Plan{Goal: "g", Steps: []audit.PlanStep{{ID: "s1", Title: "x", Risk: "low"}}}}
+	b := audit.Run{RunID: "b", Outcome: audit.OutcomeDone, Plan: audit.Plan{Goal: "g", Steps: []audit.PlanStep{{ID: "s1", Title: "x", Risk: "high"}, {ID: "s2", Title: "y", Risk: "low"}}}}
+	var buf bytes.Buffer
+	printAuditDiff(&buf, audit.Diff(a, b), false)
+	out := buf.String()
+	for _, want := range []string{"~ 1/1 s1 x", "risk: low -> high", "+ -/2 s2 y"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("diff output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "\x1b[") {
+		t.Fatalf("color disabled output should not contain escapes:\n%s", out)
+	}
+	buf.Reset()
+	printAuditDiff(&buf, audit.Diff(a, b), true)
+	if !strings.Contains(buf.String(), ansiGreen+"+ -/2") {
+		t.Fatalf("added step should be green:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yangruihan/go-pi-pro/internal/agent"
+)
+
+func forkCommand(args []string) int {
+	fs := flag.NewFlagSet("fork", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gopi-pro fork <run-id> --at sN [--task text | --task-file file] [--steps-file file] [--restore-tree]")
+		fs.PrintDefaults()
+	}
+	rf := registerRunnerFlags(fs)
+	at := fs.String("at", "", "keep completed steps up to and including this step id")
+	task := fs.String("task", "", "new instructions for replanning the remaining steps")
+	taskFile := fs.String("task-file", "", "read the new instructions from a file, - for stdin")
+	stepsFile := fs.String("steps-file", "", "json file with the remaining steps ({\"steps\":[...]} or [...]) to run instead")
+	restoreTree := fs.Bool("restore-tree", false, "restore the working tree to the parent's git snapshot taken before the next step")
+
+	// run-id 允许写在参数前面：gopi-pro fork <run-id> --at s3
+	runID := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		runID, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitError
+	}
+	if runID == "" {
+		runID = fs.Arg(0)
+	}
+	if strings.TrimSpace(runID) == "" || strings.TrimSpace(*at) == "" {
+		fs.Usage()
+		return exitError
+	}
+	if _, err := os.Stat(agent.AuditPath(*rf.auditDir, runID)); err != nil {
+		fmt.Fprintf(os.Stderr, "fork: run %s not found in %s\n", runID, *rf.auditDir)
+		return exitError
+	}
+
+	opts := agent.ForkOptions{AtStepID: strings.TrimSpace(*at), RestoreTree: *restoreTree}
+	if strings.TrimSpace(*task) != "" || strings.TrimSpace(*taskFile) != "" {
+		text, err := loadTask(*task, *taskFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fork: %v\n", err)
+			return exitError
+		}
+		opts.Instructions = text
+	}
+	if file := strings.TrimSpace(*stepsFile); file != "" {
+		steps, err := loadSteps(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fork: %v\n", err)
+			return exitError
+		}
+		opts.Steps = steps
+	}
+
+	return runNonInteractive("fork", rf, func(ctx context.Context, runner *agent.Runner) (agent.StepResult, error) {
+		return runner.Fork(ctx, runID, opts)
+	})
+}
+
+func loadSteps(file string) ([]agent.PlanStep, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var plan agent.Plan
+	if err := json.Unmarshal(b, &plan); err == nil && len(plan.Steps) > 0 {
+		return plan.Steps, nil
+	}
+	var steps []agent.PlanStep
+	if err := json.Unmarshal(b, &steps); err != nil || len(steps) == 0 {
+		return nil, fmt.Errorf("%s: expected {\"steps\":[...]} or a non-empty step array", file)
+	}
+	return steps, nil
+}
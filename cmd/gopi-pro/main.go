@@ -3,11 +3,12 @@ package main
 import (
 	"bufio"
 	"context"
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -15,28 +16,42 @@ import (
 	"time"
 
 	"github.com/yangruihan/go-pi-pro/internal/agent"
+	"github.com/yangruihan/go-pi-pro/internal/audit"
+	"github.com/yangruihan/go-pi-pro/internal/gitsnap"
 	"github.com/yangruihan/go-pi-pro/internal/gopi"
+	"github.com/yangruihan/go-pi-pro/internal/redact"
 )
 
+var subcommands = map[string]func(args []string) int{
+	"run":    runCommand,
+	"serve":  serveCommand,
+	"fork":   forkCommand,
+	"recipe": recipeCommand,
+	"audit":  auditCommand,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:]))
+		}
+	}
+
+	rf := registerRunnerFlags(flag.CommandLine)
 	var (
-		gopiBin       = flag.String("gopi-bin", "../gopi/build/gopi.exe", "path to gopi binary")
-		workdir       = flag.String("cwd", "", "working directory for task")
-		timeout       = flag.Int("timeout", 300, "timeout seconds for each LLM call")
-		autoApprove   = flag.Bool("auto-approve", false, "auto approve high-risk steps")
-		maxRetries    = flag.Int("max-retries", 2, "max retries for each action step")
-		auditDir      = flag.String("audit-dir", ".gopi-pro/runs", "directory to persist run audit json")
 		showAudit     = flag.Bool("show-audit", false, "show latest audit summary and exit")
 		showAuditFull = flag.Bool("show-audit-full", false, "show selected audit raw json and exit")
 		auditIndex    = flag.Int("show-audit-index", 1, "which latest audit to show, 1 means most recent")
-		noSpinner     = flag.Bool("no-spinner", false, "disable thinking spinner output")
+		resumeRunID   = flag.String("resume", "", "resume an interrupted run from its checkpoint by run id")
+		rollbackRunID = flag.String("rollback", "", "restore the working tree to a run's git snapshot and exit")
+		rollbackStep  = flag.String("step", "", "with --rollback, restore the snapshot taken before this step instead of before the run")
+		reviewPlan    = flag.Bool("review-plan", false, "review and edit each plan (delete, reorder, edit, insert steps, change risk, or re-plan with feedback) before any step runs")
 	)
 	flag.Parse()
 
-	cwd := strings.TrimSpace(*workdir)
-	if cwd == "" {
-		cwd, _ = os.Getwd()
-	}
+	cwd := rf.cwd()
+	auditDir := rf.auditDir
+	noSpinner := rf.noSpinner
 
 	if *showAudit || *showAuditFull {
 		if err := printAudit(*auditDir, *auditIndex, *showAuditFull); err != nil {
@@ -46,51 +61,62 @@ func main() {
 		return
 	}
 
-	client := gopi.New(*gopiBin, cwd)
-	defer client.Close()
-	printRuntimeInfo(client.Info())
-	runner := agent.NewRunner(
-		timeoutLLM{inner: client, timeout: time.Duration(*timeout) * time.Second},
-		agent.RunnerOptions{
-			MaxActRetries: *maxRetries,
-			AuditDir:      *auditDir,
-			WorkingDir:    cwd,
-			OnProgress: func(ev agent.ProgressEvent) {
-				phase := strings.ToUpper(strings.TrimSpace(ev.Phase))
-				if phase == "" {
-					phase = "PROGRESS"
-				}
-				if ev.Total > 0 {
-					fmt.Printf("\n[%s] %s (%d/%d)\n", phase, strings.TrimSpace(ev.Message), ev.Completed, ev.Total)
-				} else {
-					fmt.Printf("\n[%s] %s\n", phase, strings.TrimSpace(ev.Message))
-				}
-				if strings.TrimSpace(ev.TodoText) != "" && ev.TodoText != "(no todos)" {
-					fmt.Println(ev.TodoText)
-				}
-			},
-			Approver: func(_ context.Context, step agent.PlanStep) (bool, error) {
-				if *autoApprove {
-					return true, nil
-				}
-				fmt.Printf("\n[APPROVAL] step=%s risk=%s\n%s\n批准执行? (y/N): ", step.ID, step.Risk, step.Title)
-				reader := bufio.NewReader(os.Stdin)
-				line, err := reader.ReadString('\n')
-				if err != nil {
-					return false, err
-				}
-				v := strings.ToLower(strings.TrimSpace(line))
-				return v == "y" || v == "yes", nil
-			},
-		},
-	)
+	if id := strings.TrimSpace(*rollbackRunID); id != "" {
+		ref := agent.SnapshotRef(id, strings.TrimSpace(*rollbackStep))
+		if err := gitsnap.Restore(context.Background(), cwd, ref, agent.SnapshotExcludes(*auditDir, "")...); err != nil {
+			fmt.Fprintf(os.Stderr, "rollback failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("[ROLLBACK]\nrestored %s\n", ref)
+		return
+	}
+
+	out, err := newOutput(*rf.output, os.Stdout, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if out.machine() {
+		out.info = os.Stderr
+		*noSpinner = true
+	}
+	info := out.info
+	opts, err := rf.runnerOptions(cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	llm, runtimeInfo, closeLLM, err := rf.openLLM(cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	defer closeLLM()
+	printRuntimeInfo(info, runtimeInfo)
+	rf.applyPrice(&opts, runtimeInfo, info)
+	opts.OnProgress = out.progress
+	opts.Approver = stdinApprover(info, *rf.autoApprove)
+	var indicator *thinkingIndicator
+	if *reviewPlan {
+		opts.PlanReviewer = stdinPlanReviewer(info, func() { indicator.StopAndClear() })
+	}
+	runner := agent.NewRunner(llm, opts)
+
+	if id := strings.TrimSpace(*resumeRunID); id != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		code := resumeRun(ctx, runner, out, agent.CheckpointPath(*auditDir, id), !*noSpinner)
+		stop()
+		closeLLM()
+		os.Exit(code)
+	}
 
-	fmt.Println("gopi-pro (read-plan-act) ready. 输入你的任务，Ctrl+C 退出。")
+	fmt.Fprintln(info, "gopi-pro (read-plan-act) ready. 输入你的任务，Ctrl+C 退出。")
 	scanner := bufio.NewScanner(os.Stdin)
 	for {
-		fmt.Print("\n> ")
+		fmt.Fprint(info, "\n> ")
 		if !scanner.Scan() {
-			fmt.Println("\nbye")
+			fmt.Fprintln(info, "\nbye")
 			return
 		}
 		text := strings.TrimSpace(scanner.Text())
@@ -98,7 +124,7 @@ func main() {
 			continue
 		}
 
-		var indicator *thinkingIndicator
+		indicator = nil
 		if !*noSpinner {
 			indicator = newThinkingIndicator()
 		}
@@ -107,35 +133,102 @@ func main() {
 			indicator.StopAndClear()
 		}
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			out.failure(err)
 			continue
 		}
+		out.result(runner, res)
+	}
+}
+
+// resumeRun 从检查点恢复运行并返回与 run 子命令一致的退出码，恢复后不进入交互循环。
+func resumeRun(ctx context.Context, runner *agent.Runner, out *output, checkpoint string, spinner bool) int {
+	var indicator *thinkingIndicator
+	if spinner {
+		indicator = newThinkingIndicator()
+	}
+	res, err := runner.Resume(ctx, checkpoint)
+	if indicator != nil {
+		indicator.StopAndClear()
+	}
+	if err != nil {
+		out.failure(fmt.Errorf("resume failed: %w", err))
+		return exitCodeForError(ctx, err)
+	}
+	out.result(runner, res)
+	return exitCodeFor(res)
+}
 
-		fmt.Println("\n[READ]")
-		fmt.Println(res.ReadSummary)
-		fmt.Println("\n[PLAN]")
-		fmt.Printf("Goal: %s\n", res.Plan.Goal)
-		for i, step := range res.Plan.Steps {
-			fmt.Printf("%d. (%s) %s [risk=%s approval=%v]\n", i+1, step.ID, step.Title, step.Risk, step.RequiresApproval)
+func printResult(runner *agent.Runner, res agent.StepResult) {
+	fmt.Println("\n[READ]")
+	fmt.Println(res.ReadSummary)
+	fmt.Println("\n[PLAN]")
+	fmt.Printf("Goal: %s\n", res.Plan.Goal)
+	for i, step := range res.Plan.Steps {
+		fmt.Printf("%d. (%s) %s [risk=%s approval=%v]\n", i+1, step.ID, step.Title, step.Risk, step.RequiresApproval)
+	}
+	fmt.Println("\n[TODOS]")
+	fmt.Println(runner.TodosText())
+	fmt.Println("\n[ACTION]")
+	for _, log := range res.ActionLogs {
+		fmt.Printf("- [%s] %s (attempts=%d)\n", log.Status, log.Title, log.Attempts)
+		if strings.TrimSpace(log.Output) != "" {
+			fmt.Printf("  output: %s\n", log.Output)
 		}
-		fmt.Println("\n[TODOS]")
-		fmt.Println(runner.TodosText())
-		fmt.Println("\n[ACTION]")
-		for _, log := range res.ActionLogs {
-			fmt.Printf("- [%s] %s (attempts=%d)\n", log.Status, log.Title, log.Attempts)
-			if strings.TrimSpace(log.Output) != "" {
-				fmt.Printf("  output: %s\n", log.Output)
-			}
-			if strings.TrimSpace(log.ErrorText) != "" {
-				fmt.Printf("  error: %s\n", log.ErrorText)
-			}
+		if strings.TrimSpace(log.ErrorText) != "" {
+			fmt.Printf("  error: %s\n", log.ErrorText)
+		}
+		for _, c := range log.Changes {
+			fmt.Printf("  %s: %s (attempt=%d)\n", c.Kind, c.Path, c.Attempt)
 		}
-		fmt.Println("\n[FINAL]")
-		fmt.Println(res.Final)
-		if strings.TrimSpace(res.AuditPath) != "" {
-			fmt.Printf("\n[AUDIT]\n%s\n", res.AuditPath)
+		if log.ChangesUnattributed {
+			fmt.Println("  changes: (not recorded, ran concurrently with other steps)")
 		}
+		if log.Policy != nil && log.Policy.Action != agent.PolicyAllow {
+			fmt.Printf("  policy: %s (rule=%s approved=%v)\n", log.Policy.Action, log.Policy.Rule, log.Policy.Approved)
+		}
+		if log.RolledBack {
+			fmt.Printf("  rolled_back: %s\n", log.Snapshot)
+		}
+	}
+	fmt.Println("\n[FINAL]")
+	fmt.Println(res.Final)
+	if strings.TrimSpace(res.AuditPath) != "" {
+		fmt.Printf("\n[AUDIT]\n%s\n", res.AuditPath)
+	}
+	if strings.TrimSpace(res.RunID) != "" {
+		fmt.Printf("run_id: %s\n", res.RunID)
+	}
+	if strings.TrimSpace(res.ParentRunID) != "" {
+		fmt.Printf("parent_run_id: %s\n", res.ParentRunID)
+	}
+	if res.Budget != nil {
+		fmt.Printf("budget_exceeded: %s\n", res.Budget.Error())
+	}
+	if res.Usage.Calls > 0 {
+		fmt.Printf("\n[USAGE]\n%s\n", formatUsage(res.Usage))
+	}
+}
+
+func formatUsage(u agent.UsageSummary) string {
+	var b strings.Builder
+	estimated := ""
+	if u.Estimated {
+		estimated = " (含估算)"
+	}
+	fmt.Fprintf(&b, "calls=%d tokens=%d in=%d out=%d latency_ms=%d%s", u.Calls, u.TotalTokens, u.InputTokens, u.OutputTokens, u.LatencyMs, estimated)
+	if u.Cost > 0 {
+		fmt.Fprintf(&b, "\ncost: %.4f %s", u.Cost, u.Currency)
 	}
+	phases := make([]string, 0, len(u.ByPhase))
+	for phase := range u.ByPhase {
+		phases = append(phases, phase)
+	}
+	sort.Strings(phases)
+	for _, phase := range phases {
+		p := u.ByPhase[phase]
+		fmt.Fprintf(&b, "\n  %s: calls=%d in=%d out=%d latency_ms=%d", phase, p.Calls, p.InputTokens, p.OutputTokens, p.LatencyMs)
+	}
+	return b.String()
 }
 
 type thinkingIndicator struct {
@@ -180,29 +273,6 @@ func (ti *thinkingIndicator) StopAndClear() {
 	fmt.Print("\r                \r")
 }
 
-type auditView struct {
-	StartedAt   string `json:"started_at"`
-	FinishedAt  string `json:"finished_at"`
-	DurationMs  int64  `json:"duration_ms"`
-	UserInput   string `json:"user_input"`
-	ReadSummary string `json:"read_summary"`
-	Plan        struct {
-		Goal  string `json:"goal"`
-		Steps []struct {
-			ID    string `json:"id"`
-			Title string `json:"title"`
-			Risk  string `json:"risk"`
-		} `json:"steps"`
-	} `json:"plan"`
-	ActionLogs []struct {
-		StepID   string `json:"step_id"`
-		Title    string `json:"title"`
-		Status   string `json:"status"`
-		Attempts int    `json:"attempts"`
-	} `json:"action_logs"`
-	Final string `json:"final"`
-}
-
 func printAudit(auditDir string, index int, full bool) error {
 	base := strings.TrimSpace(auditDir)
 	if base == "" {
@@ -229,24 +299,23 @@ func printAudit(auditDir string, index int, full bool) error {
 	}
 	target := files[index-1]
 
-	b, err := os.ReadFile(target.path)
-	if err != nil {
-		return err
-	}
-
 	if full {
+		b, err := os.ReadFile(target.path)
+		if err != nil {
+			return err
+		}
 		fmt.Println("[LATEST AUDIT FULL]")
 		fmt.Println(target.path)
 		fmt.Println(string(b))
 		return nil
 	}
 
-	var audit auditView
-	if err := json.Unmarshal(b, &audit); err != nil {
+	run, err := audit.Load(target.path)
+	if err != nil {
 		return err
 	}
 
-	final := strings.TrimSpace(audit.Final)
+	final := strings.TrimSpace(run.Final)
 	if final == "" {
 		final = "(empty)"
 	}
@@ -255,7 +324,7 @@ func printAudit(auditDir string, index int, full bool) error {
 	}
 
 	var doneCount, blockedCount, skippedCount int
-	for _, log := range audit.ActionLogs {
+	for _, log := range run.ActionLogs {
 		switch strings.ToLower(strings.TrimSpace(log.Status)) {
 		case "done":
 			doneCount++
@@ -268,14 +337,28 @@ func printAudit(auditDir string, index int, full bool) error {
 
 	fmt.Println("[LATEST AUDIT]")
 	fmt.Println(target.path)
-	fmt.Printf("started_at: %s\n", strings.TrimSpace(audit.StartedAt))
-	fmt.Printf("finished_at: %s\n", strings.TrimSpace(audit.FinishedAt))
-	fmt.Printf("duration_ms: %d\n", audit.DurationMs)
-	fmt.Printf("goal: %s\n", strings.TrimSpace(audit.Plan.Goal))
-	fmt.Printf("steps: %d\n", len(audit.Plan.Steps))
-	fmt.Printf("action_logs: %d (done=%d blocked=%d skipped=%d)\n", len(audit.ActionLogs), doneCount, blockedCount, skippedCount)
-	fmt.Printf("user_input: %s\n", strings.TrimSpace(audit.UserInput))
+	fmt.Printf("started_at: %s\n", strings.TrimSpace(run.StartedAt))
+	fmt.Printf("finished_at: %s\n", strings.TrimSpace(run.FinishedAt))
+	fmt.Printf("duration_ms: %d\n", run.DurationMs)
+	fmt.Printf("goal: %s\n", strings.TrimSpace(run.Plan.Goal))
+	fmt.Printf("steps: %d\n", len(run.Plan.Steps))
+	fmt.Printf("action_logs: %d (done=%d blocked=%d skipped=%d)\n", len(run.ActionLogs), doneCount, blockedCount, skippedCount)
+	fmt.Printf("user_input: %s\n", strings.TrimSpace(run.UserInput))
 	fmt.Printf("final: %s\n", final)
+	if run.Budget != nil {
+		fmt.Printf("budget_exceeded: %s\n", run.Budget.Error())
+	}
+	if run.Usage.Calls > 0 {
+		fmt.Printf("usage: %s\n", formatUsage(run.Usage))
+	}
+	if run.Redactions != nil && (run.Redactions.Audit > 0 || run.Redactions.Prompts > 0) {
+		fmt.Printf("redactions: audit=%d prompts=%d (%s)\n", run.Redactions.Audit, run.Redactions.Prompts, redact.Counts(run.Redactions.ByRule))
+	}
+	if run.TranscriptFile != "" {
+		fmt.Printf("transcript: %s\n", filepath.Join(filepath.Dir(target.path), run.TranscriptFile))
+	} else if len(run.Transcript) > 0 {
+		fmt.Printf("transcript: %d exchanges\n", len(run.Transcript))
+	}
 	return nil
 }
 
@@ -314,33 +397,36 @@ func listAuditFiles(base string) ([]auditFile, error) {
 	return files, nil
 }
 
-func printRuntimeInfo(info gopi.RuntimeInfo) {
-	fmt.Println("[RUNTIME]")
-	fmt.Printf("mode: %s\n", strings.TrimSpace(info.Mode))
-	fmt.Printf("provider: %s\n", strings.TrimSpace(info.Provider))
-	fmt.Printf("model: %s\n", strings.TrimSpace(info.Model))
+func printRuntimeInfo(w io.Writer, info gopi.RuntimeInfo) {
+	fmt.Fprintln(w, "[RUNTIME]")
+	fmt.Fprintf(w, "mode: %s\n", strings.TrimSpace(info.Mode))
+	fmt.Fprintf(w, "provider: %s\n", strings.TrimSpace(info.Provider))
+	fmt.Fprintf(w, "model: %s\n", strings.TrimSpace(info.Model))
 	if strings.TrimSpace(info.ConfigModel) != "" {
-		fmt.Printf("configured_model: %s\n", strings.TrimSpace(info.ConfigModel))
+		fmt.Fprintf(w, "configured_model: %s\n", strings.TrimSpace(info.ConfigModel))
 	}
 	if strings.TrimSpace(info.SessionModel) != "" {
-		fmt.Printf("session_model: %s\n", strings.TrimSpace(info.SessionModel))
+		fmt.Fprintf(w, "session_model: %s\n", strings.TrimSpace(info.SessionModel))
 	}
-	fmt.Printf("host: %s\n", strings.TrimSpace(info.Host))
-	fmt.Printf("api_base: %s\n", strings.TrimSpace(info.APIBase))
-	fmt.Printf("session_id: %s\n", strings.TrimSpace(info.SessionID))
+	fmt.Fprintf(w, "host: %s\n", strings.TrimSpace(info.Host))
+	fmt.Fprintf(w, "api_base: %s\n", strings.TrimSpace(info.APIBase))
+	fmt.Fprintf(w, "session_id: %s\n", strings.TrimSpace(info.SessionID))
 	if len(info.ConfigPaths) > 0 {
-		fmt.Printf("config_paths: %s\n", strings.Join(info.ConfigPaths, " -> "))
+		fmt.Fprintf(w, "config_paths: %s\n", strings.Join(info.ConfigPaths, " -> "))
 	} else {
-		fmt.Println("config_paths: (default built-in / managed by gopi binary)")
+		fmt.Fprintln(w, "config_paths: (default built-in / managed by gopi binary)")
 	}
-	fmt.Printf("cwd: %s\n\n", strings.TrimSpace(info.CWD))
+	fmt.Fprintf(w, "cwd: %s\n\n", strings.TrimSpace(info.CWD))
 }
 
+// timeoutLLM 给每次调用加超时，超时后以加倍的超时重发一次。重发对 Runner 不可见、不计入调用次数与 token，
+// 因此设置了 --max-llm-calls / --max-tokens 时用 noResend 关闭，由 act 阶段自身（计入预算）的重试处理。
 type timeoutLLM struct {
 	inner interface {
 		Ask(ctx context.Context, prompt string) (string, error)
 	}
-	timeout time.Duration
+	timeout  time.Duration
+	noResend bool
 }
 
 type askWithStatsInner interface {
@@ -352,7 +438,7 @@ func (t timeoutLLM) Ask(parentCtx context.Context, prompt string) (string, error
 	if err == nil {
 		return out, nil
 	}
-	if !isTimeoutErr(err) {
+	if !isTimeoutErr(err) || t.noResend {
 		return "", err
 	}
 
@@ -368,7 +454,7 @@ func (t timeoutLLM) AskWithStats(parentCtx context.Context, prompt string) (stri
 	if err == nil {
 		return out, toolCalls, writeToolCalls, nil
 	}
-	if !isTimeoutErr(err) {
+	if !isTimeoutErr(err) || t.noResend {
 		return "", 0, 0, err
 	}
 
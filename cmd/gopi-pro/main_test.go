@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yangruihan/go-pi-pro/internal/agent"
+	"github.com/yangruihan/go-pi-pro/internal/llmtest"
+)
+
+type slowLLM struct{ calls int32 }
+
+func (s *slowLLM) Ask(ctx context.Context, _ string) (string, error) {
+	atomic.AddInt32(&s.calls, 1)
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestTimeoutLLMSkipsResendUnderBudget(t *testing.T) {
+	inner := &slowLLM{}
+	llm := timeoutLLM{inner: inner, timeout: 10 * time.Millisecond, noResend: true}
+	if _, err := llm.Ask(context.Background(), "p"); !isTimeoutErr(err) {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	if _, _, _, err := llm.AskWithStats(context.Background(), "p"); !isTimeoutErr(err) {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	if n := atomic.LoadInt32(&inner.calls); n != 2 {
+		t.Fatalf("each timed-out call should reach the provider once, got %d", n)
+	}
+}
+
+func TestResumeRunReturnsOutcomeExitCode(t *testing.T) {
+	dir := t.TempDir()
+	fail := true
+	llm := llmtest.New()
+	llm.On(llmtest.PhaseRead).Reply("摘要")
+	llm.On(llmtest.PhasePlan).Reply(`{"goal":"g","steps":[{"id":"s1","title":"写文件","reason":"r","risk":"low","requires_approval":false}]}`)
+	llm.On(llmtest.PhaseAct).Do(func(string) (string, error) {
+		if fail {
+			return "", errors.New("provider unavailable")
+		}
+		return "ok", nil
+	})
+	llm.On(llmtest.PhaseFinal).Reply("完成")
+	opts := agent.RunnerOptions{AuditDir: dir, WorkingDir: dir, MaxActRetries: 1, PlanMinSteps: 1}
+	first, err := agent.NewRunner(llm, opts).Run(context.Background(), "任务")
+	if err != nil || first.Outcome() != agent.OutcomeBlocked {
+		t.Fatalf("expected blocked first run: %v %s", err, first.Outcome())
+	}
+
+	var buf bytes.Buffer
+	out, err := newOutput("json", &buf, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fail = false
+	checkpoint := agent.CheckpointPath(dir, first.RunID)
+	if code := resumeRun(context.Background(), agent.NewRunner(llm, opts), out, checkpoint, false); code != exitOK {
+		t.Fatalf("resumed run should exit %d, got %d: %s", exitOK, code, buf.String())
+	}
+	if code := resumeRun(context.Background(), agent.NewRunner(llm, opts), out, checkpoint, false); code != exitError {
+		t.Fatalf("resuming a completed run should exit %d, got %d", exitError, code)
+	}
+}
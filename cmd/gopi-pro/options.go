@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/yangruihan/go-pi-pro/internal/agent"
+	"github.com/yangruihan/go-pi-pro/internal/cassette"
+	"github.com/yangruihan/go-pi-pro/internal/gopi"
+	"github.com/yangruihan/go-pi-pro/internal/redact"
+	"github.com/yangruihan/go-pi-pro/internal/usage"
+)
+
+type runnerFlags struct {
+	gopiBin       *string
+	workdir       *string
+	timeout       *int
+	autoApprove   *bool
+	maxRetries    *int
+	maxParallel   *int
+	maxReplans    *int
+	repairRounds  *int
+	bulletPlan    *bool
+	auditDir      *string
+	noSpinner     *bool
+	gitSnapshot   *bool
+	rollbackBlock *bool
+	trackChanges  *bool
+	changeIgnore  *string
+	output        *string
+	policy        *string
+	acceptCmds    *bool
+	session       *string
+	record        *string
+	replay        *string
+	priceTable    *string
+	maxLLMCalls   *int
+	maxTokens     *int
+	maxWallTime   *time.Duration
+	transcript    *string
+	noRedact      *bool
+	redactPrompts *bool
+
+	redactPatterns patternFlags
+	prices         *usage.PriceTable
+}
+
+// patternFlags 收集可重复的 --redact-pattern；正则中可能含逗号，因此不按逗号拆分。
+type patternFlags []string
+
+func (p *patternFlags) String() string {
+	return strings.Join(*p, " ")
+}
+
+func (p *patternFlags) Set(v string) error {
+	*p = append(*p, v)
+	return nil
+}
+
+func registerRunnerFlags(fs *flag.FlagSet) *runnerFlags {
+	f := &runnerFlags{
+		gopiBin:       fs.String("gopi-bin", "../gopi/build/gopi.exe", "path to gopi binary"),
+		workdir:       fs.String("cwd", "", "working directory for task"),
+		timeout:       fs.Int("timeout", 300, "timeout seconds for each LLM call"),
+		autoApprove:   fs.Bool("auto-approve", false, "auto approve high-risk steps"),
+		maxRetries:    fs.Int("max-retries", 2, "max retries for each action step"),
+		maxParallel:   fs.Int("max-parallel", 1, "max number of independent plan steps executed concurrently"),
+		maxReplans:    fs.Int("max-replans", 0, "max automatic replans after a step is blocked, 0 disables replanning"),
+		repairRounds:  fs.Int("plan-repair-rounds", 1, "max rounds asking the LLM to repair a plan that fails schema validation"),
+		bulletPlan:    fs.Bool("plan-bullet-fallback", false, "accept a bullet list as the plan when JSON validation and repair fail"),
+		auditDir:      fs.String("audit-dir", ".gopi-pro/runs", "directory to persist run audit json"),
+		noSpinner:     fs.Bool("no-spinner", false, "disable thinking spinner output"),
+		gitSnapshot:   fs.Bool("git-snapshot", false, "snapshot the git working tree before each step"),
+		rollbackBlock: fs.Bool("rollback-blocked", false, "roll back a blocked step's changes to its snapshot (requires --git-snapshot)"),
+		trackChanges:  fs.Bool("track-changes", false, "record files created/modified/deleted by each act attempt in the audit"),
+		changeIgnore:  fs.String("change-ignore", "", "comma separated extra ignore patterns for --track-changes"),
+		policy:        fs.String("policy", "", "approval policy file (yaml or json) with ordered allow/deny/ask rules"),
+		acceptCmds:    fs.Bool("acceptance-commands", false, "run command_exit acceptance commands, each checked by the policy and approver as a high-risk step"),
+		session:       fs.String("session", "", "named session whose history (inputs, plans, answers) is kept under .gopi-pro/sessions and fed to the read phase"),
+		record:        fs.String("record", "", "record every LLM call (prompt, response, tool calls, latency) to this cassette file"),
+		replay:        fs.String("replay", "", "replay LLM responses from a cassette file instead of calling gopi"),
+		maxLLMCalls:   fs.Int("max-llm-calls", 0, "max LLM calls per run, 0 means unlimited"),
+		maxTokens:     fs.Int("max-tokens", 0, "max tokens (input+output, estimated when not reported) per run, 0 means unlimited"),
+		maxWallTime:   fs.Duration("max-wall-time", 0, "max wall-clock time per run (e.g. 10m), 0 means unlimited"),
+		transcript:    fs.String("transcript", agent.TranscriptAudit, "record every prompt and raw response: audit (inline in the audit json), file (sidecar .transcript.jsonl next to the audit) or off"),
+		priceTable:    fs.String("price-table", "", "price table file (yaml or json, per million tokens by model) used to estimate run cost"),
+		noRedact:      fs.Bool("no-redact", false, "disable secret redaction of audit files"),
+		redactPrompts: fs.Bool("redact-prompts", false, "also redact secrets from prompts before they are sent to the LLM"),
+		output:        fs.String("output", outputText, "result format: text, json (single document) or jsonl (streamed progress events)"),
+	}
+	fs.Var(&f.redactPatterns, "redact-pattern", "extra regexp whose match (or first capture group) is redacted, repeatable")
+	return f
+}
+
+func (f *runnerFlags) cwd() string {
+	cwd := strings.TrimSpace(*f.workdir)
+	if cwd == "" {
+		cwd, _ = os.Getwd()
+	}
+	return cwd
+}
+
+// openLLM 按参数构造 LLM：--replay 时完全离线回放 cassette，不启动 gopi；
+// 否则连接 gopi，并在 --record 时把每次调用录制到 cassette 文件。
+func (f *runnerFlags) openLLM(cwd string) (agent.LLM, gopi.RuntimeInfo, func(), error) {
+	record := strings.TrimSpace(*f.record)
+	replay := strings.TrimSpace(*f.replay)
+	if record != "" && replay != "" {
+		return nil, gopi.RuntimeInfo{}, nil, fmt.Errorf("--record and --replay are mutually exclusive")
+	}
+	if replay != "" {
+		c, err := cassette.Load(replay)
+		if err != nil {
+			return nil, gopi.RuntimeInfo{}, nil, err
+		}
+		rep := cassette.NewReplayer(c)
+		info := gopi.RuntimeInfo{
+			Mode:        "replay",
+			Provider:    "(cassette)",
+			Model:       "(cassette)",
+			Host:        "(offline)",
+			APIBase:     "(offline)",
+			CWD:         cwd,
+			SessionID:   "(none)",
+			ConfigPaths: []string{replay},
+		}
+		closeFn := func() {
+			if misses, left := rep.Misses(), rep.Remaining(); misses > 0 || left > 0 {
+				fmt.Fprintf(os.Stderr, "replay: %d prompt mismatches, %d recorded interactions unused\n", misses, left)
+			}
+		}
+		return rep, info, closeFn, nil
+	}
+
+	client := gopi.New(*f.gopiBin, cwd)
+	noResend := *f.maxLLMCalls > 0 || *f.maxTokens > 0
+	var llm agent.LLM = timeoutLLM{inner: client, timeout: time.Duration(*f.timeout) * time.Second, noResend: noResend}
+	if record != "" {
+		llm = cassette.NewRecorder(llm, record)
+	}
+	return llm, client.Info(), func() { _ = client.Close() }, nil
+}
+
+func (f *runnerFlags) runnerOptions(cwd string) (agent.RunnerOptions, error) {
+	var policy *agent.Policy
+	if file := strings.TrimSpace(*f.policy); file != "" {
+		p, err := agent.LoadPolicy(file)
+		if err != nil {
+			return agent.RunnerOptions{}, err
+		}
+		policy = p
+	}
+	session := strings.TrimSpace(*f.session)
+	if session != "" {
+		if err := agent.ValidateSessionName(session); err != nil {
+			return agent.RunnerOptions{}, err
+		}
+	}
+	transcript := strings.ToLower(strings.TrimSpace(*f.transcript))
+	switch transcript {
+	case agent.TranscriptAudit, agent.TranscriptFile, agent.TranscriptOff:
+	default:
+		return agent.RunnerOptions{}, fmt.Errorf("invalid --transcript %q (want audit, file or off)", *f.transcript)
+	}
+	var redactor *redact.Redactor
+	if !*f.noRedact {
+		r, err := redact.New(f.redactPatterns)
+		if err != nil {
+			return agent.RunnerOptions{}, err
+		}
+		redactor = r
+	} else if *f.redactPrompts || len(f.redactPatterns) > 0 {
+		return agent.RunnerOptions{}, fmt.Errorf("--redact-prompts and --redact-pattern cannot be used with --no-redact")
+	}
+	if file := strings.TrimSpace(*f.priceTable); file != "" {
+		table, err := usage.LoadPriceTable(file)
+		if err != nil {
+			return agent.RunnerOptions{}, err
+		}
+		f.prices = &table
+	}
+	return agent.RunnerOptions{
+		MaxActRetries:      *f.maxRetries,
+		MaxParallel:        *f.maxParallel,
+		MaxReplans:         *f.maxReplans,
+		PlanRepairRounds:   *f.repairRounds,
+		PlanBulletFallback: *f.bulletPlan,
+		GitSnapshots:       *f.gitSnapshot,
+		RollbackBlocked:    *f.rollbackBlock,
+		TrackChanges:       *f.trackChanges,
+		ChangeIgnore:       splitList(*f.changeIgnore),
+		Policy:             policy,
+		AcceptanceCommands: *f.acceptCmds,
+		MaxLLMCalls:        *f.maxLLMCalls,
+		MaxTokens:          *f.maxTokens,
+		MaxWallTime:        *f.maxWallTime,
+		Transcript:         transcript,
+		Redactor:           redactor,
+		RedactPrompts:      *f.redactPrompts,
+		AuditDir:           *f.auditDir,
+		SessionName:        session,
+		WorkingDir:         cwd,
+	}, nil
+}
+
+// applyPrice 按实际使用的模型从 --price-table 中选出单价；找不到对应模型时只统计 token 不估算费用。
+func (f *runnerFlags) applyPrice(opts *agent.RunnerOptions, info gopi.RuntimeInfo, w io.Writer) {
+	if f.prices == nil {
+		return
+	}
+	price, ok := f.prices.Lookup(info.Model)
+	if !ok {
+		fmt.Fprintf(w, "price table has no entry for model %q, cost will not be estimated\n", info.Model)
+		return
+	}
+	opts.Price = &price
+	opts.Currency = f.prices.Currency
+}
+
+func printProgress(w io.Writer, ev agent.ProgressEvent) {
+	phase := strings.ToUpper(strings.TrimSpace(ev.Phase))
+	if phase == "" {
+		phase = "PROGRESS"
+	}
+	if ev.Total > 0 {
+		fmt.Fprintf(w, "\n[%s] %s (%d/%d)\n", phase, strings.TrimSpace(ev.Message), ev.Completed, ev.Total)
+	} else {
+		fmt.Fprintf(w, "\n[%s] %s\n", phase, strings.TrimSpace(ev.Message))
+	}
+	if strings.TrimSpace(ev.TodoText) != "" && ev.TodoText != "(no todos)" {
+		fmt.Fprintln(w, ev.TodoText)
+	}
+}
+
+func stdinApprover(w io.Writer, autoApprove bool) agent.Approver {
+	return func(_ context.Context, step agent.PlanStep) (bool, error) {
+		if autoApprove {
+			return true, nil
+		}
+		fmt.Fprintf(w, "\n[APPROVAL] step=%s risk=%s\n%s\n批准执行? (y/N): ", step.ID, step.Risk, step.Title)
+		reader := bufio.NewReader(os.Stdin)
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return false, err
+		}
+		v := strings.ToLower(strings.TrimSpace(line))
+		return v == "y" || v == "yes", nil
+	}
+}
+
+func splitList(s string) []string {
+	out := make([]string, 0)
+	for _, part := range strings.Split(s, ",") {
+		if v := strings.TrimSpace(part); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/yangruihan/go-pi-pro/internal/agent"
+)
+
+const (
+	outputText  = "text"
+	outputJSON  = "json"
+	outputJSONL = "jsonl"
+)
+
+type resultDocument struct {
+	agent.StepResult
+	Outcome string `json:"outcome"`
+	Todos   string `json:"todos"`
+	Error   string `json:"error,omitempty"`
+}
+
+type outputEvent struct {
+	Type   string               `json:"type"`
+	At     string               `json:"at"`
+	Event  *agent.ProgressEvent `json:"event,omitempty"`
+	Result *resultDocument      `json:"result,omitempty"`
+	Error  string               `json:"error,omitempty"`
+}
+
+// output 根据 --output 决定结果和进度的格式：text 为人类可读分段，json 只在结束时输出一个文档，
+// jsonl 把每个进度事件和最终结果各输出一行。非 text 模式下 stdout 只包含机器可读内容，其余信息走 info。
+type output struct {
+	mode string
+	out  io.Writer
+	info io.Writer
+	mu   sync.Mutex
+}
+
+func newOutput(mode string, out, info io.Writer) (*output, error) {
+	switch mode {
+	case outputText, outputJSON, outputJSONL:
+	case "":
+		mode = outputText
+	default:
+		return nil, fmt.Errorf("unknown output mode %q (want text, json or jsonl)", mode)
+	}
+	return &output{mode: mode, out: out, info: info}, nil
+}
+
+func (o *output) machine() bool {
+	return o.mode != outputText
+}
+
+func (o *output) progress(ev agent.ProgressEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.mode == outputJSONL {
+		o.writeLine(outputEvent{Type: "progress", At: time.Now().Format(time.RFC3339Nano), Event: &ev})
+		return
+	}
+	printProgress(o.info, ev)
+}
+
+func (o *output) result(runner *agent.Runner, res agent.StepResult) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	doc := resultDocument{StepResult: res, Outcome: res.Outcome(), Todos: runner.TodosText()}
+	switch o.mode {
+	case outputJSON:
+		o.writeIndent(doc)
+	case outputJSONL:
+		o.writeLine(outputEvent{Type: "result", At: time.Now().Format(time.RFC3339Nano), Result: &doc})
+	default:
+		printResult(runner, res)
+	}
+}
+
+func (o *output) failure(err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	switch o.mode {
+	case outputJSON:
+		o.writeIndent(resultDocument{Outcome: "error", Error: err.Error()})
+	case outputJSONL:
+		o.writeLine(outputEvent{Type: "error", At: time.Now().Format(time.RFC3339Nano), Error: err.Error()})
+	}
+}
+
+func (o *output) writeLine(v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "encode output failed: %v\n", err)
+		return
+	}
+	fmt.Fprintln(o.out, string(b))
+}
+
+func (o *output) writeIndent(v any) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "encode output failed: %v\n", err)
+		return
+	}
+	fmt.Fprintln(o.out, string(b))
+}
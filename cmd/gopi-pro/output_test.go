@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/yangruihan/go-pi-pro/internal/agent"
+)
+
+func TestOutputJSONLStreamsProgressAndResult(t *testing.T) {
+	var out, info bytes.Buffer
+	o, err := newOutput(outputJSONL, &out, &info)
+	if err != nil {
+		t.Fatalf("newOutput: %v", err)
+	}
+	runner := agent.NewRunner(nil, agent.RunnerOptions{})
+	o.progress(agent.ProgressEvent{Phase: "read", Message: "分析用户请求"})
+	o.result(runner, agent.StepResult{RunID: "r1", Final: "ok"})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", out.String())
+	}
+	var first, second outputEvent
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || first.Type != "progress" || first.Event.Phase != "read" {
+		t.Fatalf("unexpected progress line: %s (%v)", lines[0], err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil || second.Type != "result" || second.Result.RunID != "r1" || second.Result.Outcome != agent.OutcomeDone {
+		t.Fatalf("unexpected result line: %s (%v)", lines[1], err)
+	}
+	if info.Len() != 0 {
+		t.Fatalf("jsonl progress must not go to info writer: %q", info.String())
+	}
+}
+
+func TestOutputJSONWritesSingleDocument(t *testing.T) {
+	var out, info bytes.Buffer
+	o, _ := newOutput(outputJSON, &out, &info)
+	runner := agent.NewRunner(nil, agent.RunnerOptions{})
+	o.progress(agent.ProgressEvent{Phase: "plan", Message: "生成执行计划"})
+	o.result(runner, agent.StepResult{RunID: "r2", Final: "done"})
+
+	var doc map[string]any
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatalf("stdout is not a single json document: %v\n%s", err, out.String())
+	}
+	if doc["run_id"] != "r2" || doc["final"] != "done" || doc["outcome"] != agent.OutcomeDone {
+		t.Fatalf("unexpected document: %#v", doc)
+	}
+	if !strings.Contains(info.String(), "[PLAN]") {
+		t.Fatalf("progress should go to info writer in json mode: %q", info.String())
+	}
+}
+
+func TestNewOutputRejectsUnknownMode(t *testing.T) {
+	if _, err := newOutput("yaml", nil, nil); err == nil {
+		t.Fatalf("expected error for unknown mode")
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yangruihan/go-pi-pro/internal/agent"
+	"github.com/yangruihan/go-pi-pro/internal/recipe"
+	"gopkg.in/yaml.v3"
+)
+
+const recipeUsage = "usage: gopi-pro recipe list | show <name> | run <name> [--set key=value ...]"
+
+func recipeCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, recipeUsage)
+		return exitError
+	}
+	switch args[0] {
+	case "list":
+		return recipeListCommand(args[1:])
+	case "show":
+		return recipeShowCommand(args[1:])
+	case "run":
+		return recipeRunCommand(args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, recipeUsage)
+		return exitError
+	}
+}
+
+// setFlags 收集可重复的 --set key=value。
+type setFlags map[string]string
+
+func (s setFlags) String() string {
+	pairs := make([]string, 0, len(s))
+	for k, v := range s {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (s setFlags) Set(v string) error {
+	key, value, ok := strings.Cut(v, "=")
+	if !ok || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("expected key=value, got %q", v)
+	}
+	s[strings.TrimSpace(key)] = value
+	return nil
+}
+
+func recipeDirFlag(fs *flag.FlagSet) *string {
+	return fs.String("recipe-dir", ".gopi-pro/recipes", "directory containing recipe yaml files")
+}
+
+// parseNamed 解析 "<name> [flags]"，名称也可以写在参数后面。
+func parseNamed(fs *flag.FlagSet, args []string) (string, int, bool) {
+	name := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return "", exitOK, false
+		}
+		return "", exitError, false
+	}
+	if name == "" {
+		name = fs.Arg(0)
+	}
+	if strings.TrimSpace(name) == "" {
+		fs.Usage()
+		return "", exitError, false
+	}
+	return name, exitOK, true
+}
+
+func recipeListCommand(args []string) int {
+	fs := flag.NewFlagSet("recipe list", flag.ContinueOnError)
+	dir := recipeDirFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitError
+	}
+	list, err := recipe.List(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "recipe: %v\n", err)
+		return exitError
+	}
+	if len(list) == 0 {
+		fmt.Printf("(no recipes) %s\n", recipe.Dir(*dir))
+		return exitOK
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tVARIABLES\tDESCRIPTION")
+	for _, r := range list {
+		names := make([]string, 0, len(r.Variables))
+		for _, v := range r.Variables {
+			names = append(names, v.Name)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Name, strings.Join(names, ","), r.Description)
+	}
+	_ = tw.Flush()
+	return exitOK
+}
+
+func recipeShowCommand(args []string) int {
+	fs := flag.NewFlagSet("recipe show", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gopi-pro recipe show <name>")
+		fs.PrintDefaults()
+	}
+	dir := recipeDirFlag(fs)
+	name, code, ok := parseNamed(fs, args)
+	if !ok {
+		return code
+	}
+	r, err := recipe.Load(*dir, name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "recipe: %v\n", err)
+		return exitError
+	}
+	printRecipe(os.Stdout, r)
+	return exitOK
+}
+
+func printRecipe(w io.Writer, r recipe.Recipe) {
+	fmt.Fprintf(w, "[RECIPE] %s\n%s\n", r.Name, r.Path)
+	if strings.TrimSpace(r.Description) != "" {
+		fmt.Fprintf(w, "description: %s\n", r.Description)
+	}
+	if len(r.Variables) > 0 {
+		fmt.Fprintln(w, "variables:")
+		for _, v := range r.Variables {
+			attr := "optional"
+			if v.Required {
+				attr = "required"
+			} else if v.Default != "" {
+				attr = fmt.Sprintf("default=%q", v.Default)
+			}
+			fmt.Fprintf(w, "  - %s (%s) %s\n", v.Name, attr, v.Description)
+		}
+	}
+	if strings.TrimSpace(r.Task) != "" {
+		fmt.Fprintf(w, "task: %s\n", r.Task)
+	}
+	b, _ := yaml.Marshal(&r.Plan)
+	fmt.Fprintf(w, "plan:\n%s", indentLines(string(b), "  "))
+}
+
+func indentLines(s, prefix string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = prefix + l
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func recipeRunCommand(args []string) int {
+	fs := flag.NewFlagSet("recipe run", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gopi-pro recipe run <name> [--set key=value ...]")
+		fs.PrintDefaults()
+	}
+	rf := registerRunnerFlags(fs)
+	dir := recipeDirFlag(fs)
+	set := setFlags{}
+	fs.Var(set, "set", "recipe variable as key=value, repeatable")
+	task := fs.String("task", "", "override the task description rendered from the recipe")
+	name, code, ok := parseNamed(fs, args)
+	if !ok {
+		return code
+	}
+	r, err := recipe.Load(*dir, name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "recipe: %v\n", err)
+		return exitError
+	}
+	plan, text, err := r.Render(set)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "recipe: %v\n", err)
+		return exitError
+	}
+	if strings.TrimSpace(*task) != "" {
+		text = strings.TrimSpace(*task)
+	}
+	return runNonInteractive("recipe", rf, func(ctx context.Context, runner *agent.Runner) (agent.StepResult, error) {
+		return runner.RunPlan(ctx, text, plan)
+	})
+}
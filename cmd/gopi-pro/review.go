@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/yangruihan/go-pi-pro/internal/agent"
+)
+
+const planReviewHelp = `命令：
+  y                        批准计划并开始执行
+  d <n>                    删除第 n 步
+  m <n> <to>               把第 n 步移动到第 to 位
+  e <n> <标题>             修改第 n 步标题
+  i <n> <标题>             在第 n 步之前插入新步骤（n 为步数+1 时追加到末尾）
+  r <n> <low|medium|high>  修改第 n 步风险
+  a <n>                    切换第 n 步是否需要审批
+  f <反馈>                 让 LLM 按反馈重新规划
+  q                        放弃本次任务
+计划声明了 depends_on 时，插入或移动的步骤依赖前一步，后一步改为依赖它。`
+
+var errPlanReviewHelp = errors.New("help")
+
+// stdinPlanReviewer 在终端展示计划并读取编辑命令。before 在首次输出前调用，用于停止加载动画。
+func stdinPlanReviewer(w io.Writer, before func()) agent.PlanReviewer {
+	return func(_ context.Context, plan agent.Plan) (agent.PlanReview, error) {
+		if before != nil {
+			before()
+		}
+		reader := bufio.NewReader(os.Stdin)
+		for {
+			printPlanForReview(w, plan)
+			fmt.Fprint(w, "审阅计划 (y 批准 / h 帮助): ")
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return agent.PlanReview{}, err
+			}
+			next, review, err := applyPlanReviewCommand(plan, line)
+			switch {
+			case errors.Is(err, errPlanReviewHelp):
+				fmt.Fprintln(w, planReviewHelp)
+			case err != nil:
+				fmt.Fprintf(w, "%v\n", err)
+			case review != nil:
+				return *review, nil
+			default:
+				plan = next
+			}
+		}
+	}
+}
+
+func printPlanForReview(w io.Writer, plan agent.Plan) {
+	fmt.Fprintf(w, "\n[PLAN REVIEW]\nGoal: %s\n", plan.Goal)
+	for i, step := range plan.Steps {
+		deps := ""
+		if len(step.DependsOn) > 0 {
+			deps = " deps=" + strings.Join(step.DependsOn, ",")
+		}
+		fmt.Fprintf(w, "%d. (%s) %s [risk=%s approval=%v%s]\n", i+1, step.ID, step.Title, step.Risk, step.RequiresApproval, deps)
+	}
+}
+
+// applyPlanReviewCommand 执行一条审阅命令。编辑命令返回修改后的计划；y/f/q 返回最终的审阅决定。
+func applyPlanReviewCommand(plan agent.Plan, line string) (agent.Plan, *agent.PlanReview, error) {
+	line = strings.TrimSpace(line)
+	cmd, rest, _ := strings.Cut(line, " ")
+	rest = strings.TrimSpace(rest)
+	steps := append([]agent.PlanStep(nil), plan.Steps...)
+	plan.Steps = steps
+
+	switch strings.ToLower(cmd) {
+	case "y", "yes":
+		return plan, &agent.PlanReview{Action: agent.PlanReviewApprove, Plan: plan}, nil
+	case "q", "quit":
+		return plan, &agent.PlanReview{Action: agent.PlanReviewReject}, nil
+	case "f":
+		if rest == "" {
+			return plan, nil, fmt.Errorf("usage: f <feedback>")
+		}
+		return plan, &agent.PlanReview{Action: agent.PlanReviewReplan, Plan: plan, Feedback: rest}, nil
+	case "", "h", "help", "?":
+		return plan, nil, errPlanReviewHelp
+	case "d":
+		i, _, err := stepIndex(rest, len(steps))
+		if err != nil {
+			return plan, nil, err
+		}
+		removed := steps[i].ID
+		plan.Steps = append(steps[:i:i], steps[i+1:]...)
+		for j := range plan.Steps {
+			plan.Steps[j].DependsOn = withoutDependency(plan.Steps[j].DependsOn, removed)
+		}
+	case "m":
+		i, arg, err := stepIndex(rest, len(steps))
+		if err != nil {
+			return plan, nil, err
+		}
+		to, _, err := stepIndex(arg, len(steps))
+		if err != nil {
+			return plan, nil, err
+		}
+		step := steps[i]
+		declared := declaresDependencies(steps)
+		steps = append(steps[:i:i], steps[i+1:]...)
+		plan.Steps = append(steps[:to:to], append([]agent.PlanStep{step}, steps[to:]...)...)
+		if declared {
+			placeDependencies(plan.Steps, to)
+		}
+	case "e":
+		i, title, err := stepIndex(rest, len(steps))
+		if err != nil {
+			return plan, nil, err
+		}
+		if title == "" {
+			return plan, nil, fmt.Errorf("usage: e <n> <title>")
+		}
+		steps[i].Title = title
+	case "i":
+		i, title, err := stepIndex(rest, len(steps)+1)
+		if err != nil {
+			return plan, nil, err
+		}
+		if title == "" {
+			return plan, nil, fmt.Errorf("usage: i <n> <title>")
+		}
+		step := agent.PlanStep{ID: nextStepID(steps), Title: title, Reason: "审阅时插入", Risk: "medium"}
+		plan.Steps = append(steps[:i:i], append([]agent.PlanStep{step}, steps[i:]...)...)
+		if declaresDependencies(steps) {
+			placeDependencies(plan.Steps, i)
+		}
+	case "r":
+		i, risk, err := stepIndex(rest, len(steps))
+		if err != nil {
+			return plan, nil, err
+		}
+		risk = strings.ToLower(risk)
+		if risk != "low" && risk != "medium" && risk != "high" {
+			return plan, nil, fmt.Errorf("invalid risk %q (want low, medium or high)", risk)
+		}
+		steps[i].Risk = risk
+	case "a":
+		i, _, err := stepIndex(rest, len(steps))
+		if err != nil {
+			return plan, nil, err
+		}
+		steps[i].RequiresApproval = !steps[i].RequiresApproval
+	default:
+		return plan, nil, fmt.Errorf("unknown command %q (h for help)", cmd)
+	}
+	return plan, nil, nil
+}
+
+// stepIndex 解析 1 起始的步骤序号，返回 0 起始的下标和剩余参数。
+func stepIndex(args string, n int) (int, string, error) {
+	first, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	i, err := strconv.Atoi(first)
+	if err != nil || i < 1 || i > n {
+		return 0, "", fmt.Errorf("invalid step number %q (1-%d)", first, n)
+	}
+	return i - 1, strings.TrimSpace(rest), nil
+}
+
+func withoutDependency(deps []string, id string) []string {
+	out := make([]string, 0, len(deps))
+	for _, d := range deps {
+		if d != id {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// declaresDependencies 与 agent 的调度规则一致：任一步骤写了 depends_on 时按依赖调度，否则按顺序串行。
+func declaresDependencies(steps []agent.PlanStep) bool {
+	for _, s := range steps {
+		if len(s.DependsOn) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// placeDependencies 让插入或移动到第 at 位的步骤在按依赖调度时仍处于该位置：它只依赖排在前面的步骤并接在前一步之后，
+// 后一步改为依赖它，排在前面的步骤不再依赖它。
+func placeDependencies(steps []agent.PlanStep, at int) {
+	step := &steps[at]
+	before := make(map[string]struct{}, at)
+	for j := 0; j < at; j++ {
+		before[steps[j].ID] = struct{}{}
+		steps[j].DependsOn = withoutDependency(steps[j].DependsOn, step.ID)
+	}
+	deps := make([]string, 0, len(step.DependsOn)+1)
+	for _, d := range step.DependsOn {
+		if _, ok := before[d]; ok {
+			deps = append(deps, d)
+		}
+	}
+	if at > 0 {
+		deps = withDependency(deps, steps[at-1].ID)
+	}
+	step.DependsOn = deps
+	if at+1 < len(steps) {
+		next := &steps[at+1]
+		next.DependsOn = withDependency(append([]string(nil), next.DependsOn...), step.ID)
+	}
+}
+
+func withDependency(deps []string, id string) []string {
+	for _, d := range deps {
+		if d == id {
+			return deps
+		}
+	}
+	return append(deps, id)
+}
+
+func nextStepID(steps []agent.PlanStep) string {
+	used := make(map[string]struct{}, len(steps))
+	for _, s := range steps {
+		used[s.ID] = struct{}{}
+	}
+	for n := len(steps) + 1; ; n++ {
+		id := fmt.Sprintf("s%d", n)
+		if _, ok := used[id]; !ok {
+			return id
+		}
+	}
+}
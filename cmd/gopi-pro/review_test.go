@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/yangruihan/go-pi-pro/internal/agent"
+)
+
+func reviewTestPlan() agent.Plan {
+	return agent.Plan{Goal: "g", Steps: []agent.PlanStep{
+		{ID: "s1", Title: "一", Risk: "low"},
+		{ID: "s2", Title: "二", Risk: "low", DependsOn: []string{"s1"}},
+		{ID: "s3", Title: "三", Risk: "low", DependsOn: []string{"s2"}},
+	}}
+}
+
+func applyAll(t *testing.T, plan agent.Plan, lines ...string) agent.Plan {
+	t.Helper()
+	for _, line := range lines {
+		next, review, err := applyPlanReviewCommand(plan, line)
+		if err != nil || review != nil {
+			t.Fatalf("%q: review=%v err=%v", line, review, err)
+		}
+		plan = next
+	}
+	return plan
+}
+
+func stepIDs(plan agent.Plan) string {
+	out := ""
+	for _, s := range plan.Steps {
+		out += s.ID + " "
+	}
+	return out
+}
+
+func TestApplyPlanReviewEdits(t *testing.T) {
+	orig := reviewTestPlan()
+	plan := applyAll(t, orig, "d 2", "m 2 1", "i 3 补充文档", "e 1 三（改）", "r 2 high", "a 2")
+	if got := stepIDs(plan); got != "s3 s1 s4 " {
+		t.Fatalf("unexpected order: %s", got)
+	}
+	if plan.Steps[0].Title != "三（改）" || len(plan.Steps[0].DependsOn) != 0 {
+		t.Fatalf("deleted step must be dropped from depends_on: %#v", plan.Steps[0])
+	}
+	if plan.Steps[1].Risk != "high" || !plan.Steps[1].RequiresApproval {
+		t.Fatalf("risk/approval not applied: %#v", plan.Steps[1])
+	}
+	if orig.Steps[0].Title != "一" || len(orig.Steps) != 3 {
+		t.Fatalf("original plan must not be mutated: %#v", orig)
+	}
+}
+
+func TestApplyPlanReviewDecisions(t *testing.T) {
+	plan := reviewTestPlan()
+	if _, review, err := applyPlanReviewCommand(plan, "f 拆得更细一些\n"); err != nil || review == nil || review.Action != agent.PlanReviewReplan || review.Feedback != "拆得更细一些" {
+		t.Fatalf("feedback: %#v %v", review, err)
+	}
+	if _, review, _ := applyPlanReviewCommand(plan, "y"); review == nil || review.Action != agent.PlanReviewApprove || len(review.Plan.Steps) != 3 {
+		t.Fatalf("approve: %#v", review)
+	}
+	for _, bad := range []string{"d 9", "r 1 extreme", "x", "e 1"} {
+		if _, _, err := applyPlanReviewCommand(plan, bad); err == nil {
+			t.Fatalf("%q should fail", bad)
+		}
+	}
+}
+
+func TestApplyPlanReviewKeepsDependencyOrder(t *testing.T) {
+	// s1 -> s2 -> s3 依赖链中插入的步骤应接在前一步之后、后一步之前
+	plan := applyAll(t, reviewTestPlan(), "i 2 检查环境")
+	if got := stepIDs(plan); got != "s1 s4 s2 s3 " {
+		t.Fatalf("unexpected order: %s", got)
+	}
+	if deps := plan.Steps[1].DependsOn; len(deps) != 1 || deps[0] != "s1" {
+		t.Fatalf("inserted step should depend on the previous step: %v", deps)
+	}
+	if deps := plan.Steps[2].DependsOn; len(deps) != 2 || deps[1] != "s4" {
+		t.Fatalf("next step should depend on the inserted step: %v", deps)
+	}
+
+	// 把 s1 移到末尾：s2 不再依赖它，s1 接在 s3 之后
+	plan = applyAll(t, reviewTestPlan(), "m 1 3")
+	if got := stepIDs(plan); got != "s2 s3 s1 " {
+		t.Fatalf("unexpected order: %s", got)
+	}
+	if len(plan.Steps[0].DependsOn) != 0 {
+		t.Fatalf("step moved before its former dependency must drop it: %v", plan.Steps[0].DependsOn)
+	}
+	if deps := plan.Steps[2].DependsOn; len(deps) != 1 || deps[0] != "s3" {
+		t.Fatalf("moved step should depend on its new predecessor: %v", deps)
+	}
+
+	// 没有声明依赖的计划按顺序串行，不补 depends_on
+	plain := agent.Plan{Steps: []agent.PlanStep{{ID: "s1", Title: "a"}, {ID: "s2", Title: "b"}}}
+	plain = applyAll(t, plain, "i 2 c", "m 1 3")
+	for _, s := range plain.Steps {
+		if len(s.DependsOn) != 0 {
+			t.Fatalf("sequential plan should stay without depends_on: %#v", plain.Steps)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/yangruihan/go-pi-pro/internal/agent"
+)
+
+const (
+	exitOK             = 0
+	exitError          = 1
+	exitBlocked        = 2
+	exitApprovalDenied = 3
+	exitLLMError       = 4
+	exitInterrupted    = 130
+)
+
+func runCommand(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	rf := registerRunnerFlags(fs)
+	task := fs.String("task", "", "task text to execute")
+	taskFile := fs.String("task-file", "", "read the task from a file, - for stdin")
+	planFile := fs.String("plan-file", "", "execute the steps in this plan file (yaml or json) directly, skipping the read and plan phases")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitError
+	}
+
+	if file := strings.TrimSpace(*planFile); file != "" {
+		plan, err := agent.LoadPlan(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "run: %v\n", err)
+			return exitError
+		}
+		// 使用计划文件时任务描述可选，缺省为计划目标
+		text := ""
+		if strings.TrimSpace(*task) != "" || strings.TrimSpace(*taskFile) != "" {
+			if text, err = loadTask(*task, *taskFile); err != nil {
+				fmt.Fprintf(os.Stderr, "run: %v\n", err)
+				return exitError
+			}
+		}
+		return runNonInteractive("run", rf, func(ctx context.Context, runner *agent.Runner) (agent.StepResult, error) {
+			return runner.RunPlan(ctx, text, plan)
+		})
+	}
+
+	text, err := loadTask(*task, *taskFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "run: %v\n", err)
+		return exitError
+	}
+	return runNonInteractive("run", rf, func(ctx context.Context, runner *agent.Runner) (agent.StepResult, error) {
+		return runner.Run(ctx, text)
+	})
+}
+
+// runNonInteractive 是 run/fork 等子命令的公共流程：进度与运行信息输出到 stderr，结果按 --output 输出到 stdout，
+// 并把结果映射为退出码。
+func runNonInteractive(name string, rf *runnerFlags, start func(ctx context.Context, runner *agent.Runner) (agent.StepResult, error)) int {
+	out, err := newOutput(*rf.output, os.Stdout, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return exitError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cwd := rf.cwd()
+	opts, err := rf.runnerOptions(cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return exitError
+	}
+	llm, runtimeInfo, closeLLM, err := rf.openLLM(cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return exitError
+	}
+	defer closeLLM()
+	printRuntimeInfo(os.Stderr, runtimeInfo)
+	rf.applyPrice(&opts, runtimeInfo, os.Stderr)
+	opts.OnProgress = out.progress
+	opts.Approver = nonInteractiveApprover(*rf.autoApprove)
+	runner := agent.NewRunner(llm, opts)
+
+	res, err := start(ctx, runner)
+	if err != nil {
+		out.failure(err)
+		return exitCodeForError(ctx, err)
+	}
+	out.result(runner, res)
+	return exitCodeFor(res)
+}
+
+func loadTask(task, taskFile string) (string, error) {
+	task = strings.TrimSpace(task)
+	taskFile = strings.TrimSpace(taskFile)
+	if task != "" && taskFile != "" {
+		return "", fmt.Errorf("--task and --task-file are mutually exclusive")
+	}
+	if taskFile != "" {
+		var b []byte
+		var err error
+		if taskFile == "-" {
+			b, err = io.ReadAll(os.Stdin)
+		} else {
+			b, err = os.ReadFile(taskFile)
+		}
+		if err != nil {
+			return "", err
+		}
+		task = strings.TrimSpace(string(b))
+	}
+	if task == "" {
+		return "", fmt.Errorf("--task or --task-file is required")
+	}
+	return task, nil
+}
+
+func nonInteractiveApprover(autoApprove bool) agent.Approver {
+	return func(_ context.Context, step agent.PlanStep) (bool, error) {
+		if autoApprove {
+			return true, nil
+		}
+		fmt.Fprintf(os.Stderr, "\n[APPROVAL] step=%s risk=%s denied (non-interactive, use --auto-approve)\n%s\n", step.ID, step.Risk, step.Title)
+		return false, nil
+	}
+}
+
+// exitCodeForError 区分中断、LLM 调用失败与其它错误（无效计划、审阅出错等）。
+func exitCodeForError(ctx context.Context, err error) int {
+	var llmErr *agent.LLMError
+	switch {
+	case ctx.Err() != nil || errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.As(err, &llmErr):
+		return exitLLMError
+	}
+	return exitError
+}
+
+func exitCodeFor(res agent.StepResult) int {
+	switch res.Outcome() {
+	case agent.OutcomeBlocked:
+		return exitBlocked
+	case agent.OutcomeApprovalDenied:
+		return exitApprovalDenied
+	}
+	return exitOK
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/yangruihan/go-pi-pro/internal/agent"
+	"github.com/yangruihan/go-pi-pro/internal/llmtest"
+)
+
+func TestExitCodeForError(t *testing.T) {
+	run := func(ctx context.Context, llm *llmtest.LLM) int {
+		t.Helper()
+		dir := t.TempDir()
+		_, err := agent.NewRunner(llm, agent.RunnerOptions{AuditDir: dir, WorkingDir: dir}).Run(ctx, "任务")
+		if err == nil {
+			t.Fatalf("expected run error")
+		}
+		return exitCodeForError(ctx, err)
+	}
+
+	llm := llmtest.New()
+	llm.On(llmtest.PhaseRead).Fail(errors.New("provider unavailable"))
+	if code := run(context.Background(), llm); code != exitLLMError {
+		t.Fatalf("LLM failure should exit %d, got %d", exitLLMError, code)
+	}
+
+	llm = llmtest.New()
+	llm.On(llmtest.PhaseRead).Reply("摘要")
+	llm.On(llmtest.PhasePlan).Reply("不是计划")
+	if code := run(context.Background(), llm); code != exitError {
+		t.Fatalf("invalid plan should exit %d, got %d", exitError, code)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	llm = llmtest.New()
+	llm.On(llmtest.PhaseRead).Do(func(string) (string, error) {
+		cancel()
+		return "", context.Canceled
+	})
+	if code := run(ctx, llm); code != exitInterrupted {
+		t.Fatalf("interrupt should exit %d, got %d", exitInterrupted, code)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/yangruihan/go-pi-pro/internal/server"
+)
+
+func serveCommand(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	rf := registerRunnerFlags(fs)
+	listen := fs.String("listen", "127.0.0.1:8787", "address for the HTTP API to listen on")
+	keepRuns := fs.Int("keep-runs", server.DefaultKeepFinished, "number of finished runs kept in memory; older ones are dropped")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cwd := rf.cwd()
+	opts, err := rf.runnerOptions(cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "serve: %v\n", err)
+		return exitError
+	}
+	llm, runtimeInfo, closeLLM, err := rf.openLLM(cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "serve: %v\n", err)
+		return exitError
+	}
+	defer closeLLM()
+	printRuntimeInfo(os.Stderr, runtimeInfo)
+	rf.applyPrice(&opts, runtimeInfo, os.Stderr)
+
+	srv := server.New(server.Options{
+		LLM:          llm,
+		Runner:       opts,
+		AutoApprove:  *rf.autoApprove,
+		KeepFinished: *keepRuns,
+	})
+	defer srv.Close()
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "serve: %v\n", err)
+		return exitError
+	}
+	httpServer := &http.Server{Handler: srv.Handler()}
+	fmt.Fprintf(os.Stderr, "gopi-pro serving on http://%s\n", ln.Addr())
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- httpServer.Serve(ln) }()
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintf(os.Stderr, "serve: %v\n", err)
+			return exitError
+		}
+	case <-ctx.Done():
+		srv.Close()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdownCtx)
+	}
+	return exitOK
+}
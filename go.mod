@@ -2,7 +2,11 @@ module github.com/yangruihan/go-pi-pro
 
 go 1.24.1
 
-require github.com/yangruihan/go-pi v0.0.0
+require (
+	github.com/pkoukk/tiktoken-go v0.1.8
+	github.com/yangruihan/go-pi v0.0.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/bahlo/generic-list-go v0.2.0 // indirect
@@ -11,12 +15,10 @@ require (
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/mailru/easyjson v0.7.7 // indirect
 	github.com/ollama/ollama v0.17.1 // indirect
-	github.com/pkoukk/tiktoken-go v0.1.8 // indirect
 	github.com/wk8/go-ordered-map/v2 v2.1.8 // indirect
 	golang.org/x/crypto v0.43.0 // indirect
 	golang.org/x/sys v0.37.0 // indirect
 	golang.org/x/text v0.30.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
 replace github.com/yangruihan/go-pi => ../gopi
@@ -0,0 +1,321 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/yangruihan/go-pi-pro/internal/audit"
+)
+
+const (
+	AcceptanceFileExists     = "file_exists"
+	AcceptanceFileContains   = "file_contains"
+	AcceptanceCommandExit    = "command_exit"
+	AcceptanceJSONPathEquals = "json_path_equals"
+)
+
+const acceptanceCommandTimeout = 60 * time.Second
+
+type AcceptanceCriterion = audit.AcceptanceCriterion
+
+type AcceptanceResult = audit.AcceptanceResult
+
+func normalizeAcceptance(criteria []AcceptanceCriterion) ([]AcceptanceCriterion, error) {
+	if len(criteria) == 0 {
+		return nil, nil
+	}
+	out := make([]AcceptanceCriterion, 0, len(criteria))
+	for _, c := range criteria {
+		c.Type = strings.ToLower(strings.TrimSpace(c.Type))
+		c.Path = strings.TrimSpace(c.Path)
+		c.Command = strings.TrimSpace(c.Command)
+		c.JSONPath = strings.TrimSpace(c.JSONPath)
+		switch c.Type {
+		case AcceptanceFileExists:
+			if c.Path == "" {
+				return nil, fmt.Errorf("acceptance %s: path is required", c.Type)
+			}
+		case AcceptanceFileContains:
+			if c.Path == "" || c.Pattern == "" {
+				return nil, fmt.Errorf("acceptance %s: path and pattern are required", c.Type)
+			}
+			if _, err := regexp.Compile(c.Pattern); err != nil {
+				return nil, fmt.Errorf("acceptance %s: invalid pattern: %w", c.Type, err)
+			}
+		case AcceptanceCommandExit:
+			if c.Command == "" {
+				return nil, fmt.Errorf("acceptance %s: command is required", c.Type)
+			}
+		case AcceptanceJSONPathEquals:
+			if c.Path == "" || c.JSONPath == "" {
+				return nil, fmt.Errorf("acceptance %s: path and json_path are required", c.Type)
+			}
+		default:
+			return nil, fmt.Errorf("acceptance: unknown type %q", c.Type)
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// commandGate 决定 command_exit 验收命令能否执行，返回的决定会记录在验收结果中。
+type commandGate func(ctx context.Context, command string) (PolicyDecision, error)
+
+// verifyAcceptance 校验验收条件。command_exit 会在 workingDir 中执行 LLM 写出的命令，
+// 因此必须先经 gate 批准；gate 为 nil 时跳过命令验收。
+func verifyAcceptance(ctx context.Context, criteria []AcceptanceCriterion, workingDir string, gate commandGate) []AcceptanceResult {
+	results := make([]AcceptanceResult, 0, len(criteria))
+	for _, c := range criteria {
+		res := AcceptanceResult{Criterion: c}
+		if c.Type == AcceptanceCommandExit {
+			if gate == nil {
+				res.Skipped = true
+				res.Detail = "未执行：未开启命令验收"
+				results = append(results, res)
+				continue
+			}
+			decision, err := gate(ctx, c.Command)
+			if err != nil {
+				res.Detail = fmt.Sprintf("验收命令审批失败: %v", err)
+				results = append(results, res)
+				continue
+			}
+			res.Policy = &decision
+			if !decision.Approved {
+				res.Detail = fmt.Sprintf("验收命令未获批准（规则 %s），未执行", decision.Rule)
+				results = append(results, res)
+				continue
+			}
+		}
+		detail, err := evaluateCriterion(ctx, c, workingDir)
+		res.Passed = err == nil
+		res.Detail = detail
+		if err != nil {
+			res.Detail = err.Error()
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+func failedAcceptance(results []AcceptanceResult) []AcceptanceResult {
+	out := make([]AcceptanceResult, 0)
+	for _, r := range results {
+		if !r.Passed && !r.Skipped {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// deniedAcceptance 报告是否有验收命令被拒绝；被拒绝的命令重试也不会执行，步骤应直接阻塞。
+func deniedAcceptance(results []AcceptanceResult) bool {
+	for _, r := range results {
+		if r.Policy != nil && !r.Policy.Approved {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptanceCommandGate 让验收命令与步骤一样经过策略与审批：命令按需审批的高风险步骤评估，
+// 标题为 "验收命令: <command>"，同一步骤内每条命令只决定一次。未开启 AcceptanceCommands 时返回 nil。
+func (r *Runner) acceptanceCommandGate(step PlanStep) commandGate {
+	if !r.opts.AcceptanceCommands {
+		return nil
+	}
+	decided := make(map[string]PolicyDecision)
+	return func(ctx context.Context, command string) (PolicyDecision, error) {
+		if d, ok := decided[command]; ok {
+			return d, nil
+		}
+		cmdStep := PlanStep{ID: step.ID, Title: "验收命令: " + command, Reason: step.Reason, Risk: "high", RequiresApproval: true}
+		d, err := r.decide(ctx, cmdStep, nil)
+		if err != nil {
+			return d, err
+		}
+		decided[command] = d
+		return d, nil
+	}
+}
+
+func describeCriterion(c AcceptanceCriterion) string {
+	switch c.Type {
+	case AcceptanceFileExists:
+		return fmt.Sprintf("文件存在 %s", c.Path)
+	case AcceptanceFileContains:
+		return fmt.Sprintf("文件 %s 匹配 /%s/", c.Path, c.Pattern)
+	case AcceptanceCommandExit:
+		return fmt.Sprintf("命令 `%s` 退出码为 %d", c.Command, c.ExitCode)
+	case AcceptanceJSONPathEquals:
+		v, _ := json.Marshal(c.Value)
+		return fmt.Sprintf("文件 %s 中 %s 等于 %s", c.Path, c.JSONPath, string(v))
+	}
+	return c.Type
+}
+
+func renderAcceptanceCriteria(criteria []AcceptanceCriterion) string {
+	lines := make([]string, 0, len(criteria))
+	for _, c := range criteria {
+		lines = append(lines, "- "+describeCriterion(c))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func renderAcceptanceFailures(failed []AcceptanceResult) string {
+	lines := make([]string, 0, len(failed))
+	for _, f := range failed {
+		lines = append(lines, fmt.Sprintf("- %s：%s", describeCriterion(f.Criterion), strings.TrimSpace(f.Detail)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func evaluateCriterion(ctx context.Context, c AcceptanceCriterion, workingDir string) (string, error) {
+	switch c.Type {
+	case AcceptanceFileExists:
+		if _, err := os.Stat(resolvePath(c.Path, workingDir)); err != nil {
+			return "", fmt.Errorf("文件不存在: %s", c.Path)
+		}
+		return "文件存在", nil
+	case AcceptanceFileContains:
+		b, err := os.ReadFile(resolvePath(c.Path, workingDir))
+		if err != nil {
+			return "", fmt.Errorf("无法读取文件: %s", c.Path)
+		}
+		re, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			return "", fmt.Errorf("无效正则: %v", err)
+		}
+		if !re.Match(b) {
+			return "", fmt.Errorf("文件内容未匹配 /%s/", c.Pattern)
+		}
+		return "内容匹配", nil
+	case AcceptanceCommandExit:
+		code, output, err := runAcceptanceCommand(ctx, c.Command, workingDir)
+		if err != nil {
+			return "", err
+		}
+		if code != c.ExitCode {
+			return "", fmt.Errorf("退出码=%d，期望=%d，输出：%s", code, c.ExitCode, truncateText(output, 400))
+		}
+		return fmt.Sprintf("退出码=%d", code), nil
+	case AcceptanceJSONPathEquals:
+		b, err := os.ReadFile(resolvePath(c.Path, workingDir))
+		if err != nil {
+			return "", fmt.Errorf("无法读取文件: %s", c.Path)
+		}
+		var doc any
+		if err := json.Unmarshal(b, &doc); err != nil {
+			return "", fmt.Errorf("文件不是合法JSON: %v", err)
+		}
+		got, err := lookupJSONPath(doc, c.JSONPath)
+		if err != nil {
+			return "", err
+		}
+		if !jsonEqual(got, c.Value) {
+			gotText, _ := json.Marshal(got)
+			wantText, _ := json.Marshal(c.Value)
+			return "", fmt.Errorf("%s 实际为 %s，期望 %s", c.JSONPath, string(gotText), string(wantText))
+		}
+		return "值匹配", nil
+	}
+	return "", fmt.Errorf("未知验收类型: %s", c.Type)
+}
+
+func runAcceptanceCommand(ctx context.Context, command, workingDir string) (int, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, acceptanceCommandTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Dir = workingDir
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	if err == nil {
+		return 0, out.String(), nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		return exitErr.ExitCode(), out.String(), nil
+	}
+	return -1, out.String(), fmt.Errorf("命令执行失败: %v", err)
+}
+
+func lookupJSONPath(doc any, path string) (any, error) {
+	p := strings.TrimSpace(path)
+	p = strings.TrimPrefix(p, "$")
+	p = strings.ReplaceAll(p, "[", ".")
+	p = strings.ReplaceAll(p, "]", "")
+	cur := doc
+	for _, key := range strings.Split(p, ".") {
+		key = strings.Trim(strings.TrimSpace(key), `"'`)
+		if key == "" {
+			continue
+		}
+		switch v := cur.(type) {
+		case map[string]any:
+			next, ok := v[key]
+			if !ok {
+				return nil, fmt.Errorf("%s 不存在", path)
+			}
+			cur = next
+		case []any:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(v) {
+				return nil, fmt.Errorf("%s 不存在", path)
+			}
+			cur = v[idx]
+		default:
+			return nil, fmt.Errorf("%s 不存在", path)
+		}
+	}
+	return cur, nil
+}
+
+func jsonEqual(a, b any) bool {
+	ab, err1 := json.Marshal(a)
+	bb, err2 := json.Marshal(b)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	var av, bv any
+	_ = json.Unmarshal(ab, &av)
+	_ = json.Unmarshal(bb, &bv)
+	return reflect.DeepEqual(av, bv)
+}
+
+func resolvePath(p, workingDir string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(workingDir, p)
+}
+
+func truncateText(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,158 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeAcceptance(t *testing.T) {
+	got, err := normalizeAcceptance([]AcceptanceCriterion{{Type: " File_Exists ", Path: " a.txt "}})
+	if err != nil || got[0].Type != AcceptanceFileExists || got[0].Path != "a.txt" {
+		t.Fatalf("unexpected normalize result: %#v, %v", got, err)
+	}
+	bad := [][]AcceptanceCriterion{
+		{{Type: "unknown"}},
+		{{Type: AcceptanceFileExists}},
+		{{Type: AcceptanceFileContains, Path: "a", Pattern: "("}},
+		{{Type: AcceptanceCommandExit}},
+		{{Type: AcceptanceJSONPathEquals, Path: "a.json"}},
+	}
+	for _, c := range bad {
+		if _, err := normalizeAcceptance(c); err == nil {
+			t.Fatalf("expected error for %#v", c)
+		}
+	}
+}
+
+func TestVerifyAcceptance(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello world"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "pkg.json"), []byte(`{"version":"1.2.0","deps":[{"name":"x"}]}`), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	criteria := []AcceptanceCriterion{
+		{Type: AcceptanceFileExists, Path: "a.txt"},
+		{Type: AcceptanceFileContains, Path: "a.txt", Pattern: `hello\s+world`},
+		{Type: AcceptanceJSONPathEquals, Path: "pkg.json", JSONPath: "$.version", Value: "1.2.0"},
+		{Type: AcceptanceJSONPathEquals, Path: "pkg.json", JSONPath: "$.deps[0].name", Value: "x"},
+		{Type: AcceptanceFileExists, Path: "missing.txt"},
+		{Type: AcceptanceJSONPathEquals, Path: "pkg.json", JSONPath: "$.version", Value: "2.0.0"},
+	}
+	if runtime.GOOS != "windows" {
+		criteria = append(criteria,
+			AcceptanceCriterion{Type: AcceptanceCommandExit, Command: "test -f a.txt"},
+			AcceptanceCriterion{Type: AcceptanceCommandExit, Command: "exit 3", ExitCode: 3},
+			AcceptanceCriterion{Type: AcceptanceCommandExit, Command: "exit 1"},
+		)
+	}
+	allow := func(context.Context, string) (PolicyDecision, error) { return PolicyDecision{Approved: true}, nil }
+	results := verifyAcceptance(context.Background(), criteria, dir, allow)
+	failed := failedAcceptance(results)
+	wantFailed := 2
+	if runtime.GOOS != "windows" {
+		wantFailed = 3
+	}
+	if len(failed) != wantFailed {
+		t.Fatalf("unexpected failures: %#v", failed)
+	}
+	text := renderAcceptanceFailures(failed)
+	if !strings.Contains(text, "missing.txt") || !strings.Contains(text, `"1.2.0"`) {
+		t.Fatalf("unexpected failure text: %s", text)
+	}
+}
+
+func TestExecuteStepFeedsAcceptanceFailuresIntoRetry(t *testing.T) {
+	dir := t.TempDir()
+	prompts := make([]string, 0)
+	llm := funcLLM(func(prompt string) (string, error) {
+		prompts = append(prompts, prompt)
+		if len(prompts) == 2 {
+			if err := os.WriteFile(filepath.Join(dir, "out.txt"), []byte("done"), 0o644); err != nil {
+				return "", err
+			}
+		}
+		return "ok", nil
+	})
+	r := NewRunner(llm, RunnerOptions{AuditDir: dir, WorkingDir: dir, MaxActRetries: 3})
+	step := PlanStep{ID: "s1", Title: "生成结果", Reason: "r", Risk: "low", Acceptance: []AcceptanceCriterion{
+		{Type: AcceptanceFileContains, Path: "out.txt", Pattern: "done"},
+	}}
+	log, err := r.executeStep(context.Background(), step, stepEnv{total: 1})
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if log.Status != "done" || log.Attempts != 2 {
+		t.Fatalf("unexpected log: %#v", log)
+	}
+	if !strings.Contains(prompts[0], "验收标准") || strings.Contains(prompts[0], "上次验收未通过") {
+		t.Fatalf("unexpected first prompt: %s", prompts[0])
+	}
+	if !strings.Contains(prompts[1], "上次验收未通过") || !strings.Contains(prompts[1], "out.txt") {
+		t.Fatalf("retry prompt missing failures: %s", prompts[1])
+	}
+	if len(log.Acceptance) != 1 || !log.Acceptance[0].Passed {
+		t.Fatalf("unexpected acceptance results: %#v", log.Acceptance)
+	}
+}
+
+func TestAcceptanceCommandsRequireOptInAndApproval(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	step := PlanStep{ID: "s1", Title: "生成结果", Reason: "r", Risk: "low", Acceptance: []AcceptanceCriterion{
+		{Type: AcceptanceCommandExit, Command: "touch ran.txt"},
+	}}
+	llm := funcLLM(func(string) (string, error) { return "ok", nil })
+
+	// 未开启时命令不执行，也不计为失败
+	dir := t.TempDir()
+	r := NewRunner(llm, RunnerOptions{AuditDir: dir, WorkingDir: dir, MaxActRetries: 2})
+	log, err := r.executeStep(context.Background(), step, stepEnv{total: 1})
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ran.txt")); err == nil {
+		t.Fatalf("command must not run without AcceptanceCommands")
+	}
+	if log.Status != "done" || len(log.Acceptance) != 1 || !log.Acceptance[0].Skipped {
+		t.Fatalf("unexpected log: %#v", log)
+	}
+
+	// 开启后审批人拒绝：命令不执行，步骤直接阻塞而不重试
+	dir = t.TempDir()
+	var asked []string
+	approver := func(_ context.Context, s PlanStep) (bool, error) {
+		asked = append(asked, s.Title)
+		return false, nil
+	}
+	r = NewRunner(llm, RunnerOptions{AuditDir: dir, WorkingDir: dir, MaxActRetries: 3, AcceptanceCommands: true, Approver: approver})
+	log, err = r.executeStep(context.Background(), step, stepEnv{total: 1})
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ran.txt")); err == nil {
+		t.Fatalf("denied command must not run")
+	}
+	if len(asked) != 1 || asked[0] != "验收命令: touch ran.txt" {
+		t.Fatalf("approver should be asked once for the command: %v", asked)
+	}
+	if log.Status != "blocked" || log.Attempts != 1 || log.Acceptance[0].Policy == nil || log.Acceptance[0].Policy.Approved {
+		t.Fatalf("unexpected log: %#v", log)
+	}
+
+	// 开启且批准：命令执行
+	dir = t.TempDir()
+	r = NewRunner(llm, RunnerOptions{AuditDir: dir, WorkingDir: dir, MaxActRetries: 1, AcceptanceCommands: true})
+	if log, err = r.executeStep(context.Background(), step, stepEnv{total: 1}); err != nil || log.Status != "done" {
+		t.Fatalf("unexpected result: %#v, %v", log, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ran.txt")); err != nil {
+		t.Fatalf("approved command should run: %v", err)
+	}
+}
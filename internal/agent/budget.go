@@ -0,0 +1,163 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yangruihan/go-pi-pro/internal/audit"
+	"github.com/yangruihan/go-pi-pro/internal/todo"
+	"github.com/yangruihan/go-pi-pro/internal/usage"
+)
+
+const (
+	BudgetLLMCalls = audit.BudgetLLMCalls
+	BudgetTokens   = audit.BudgetTokens
+	BudgetWallTime = audit.BudgetWallTime
+)
+
+type BudgetExceeded = audit.BudgetExceeded
+
+func isBudgetError(err error) bool {
+	var be *BudgetExceeded
+	return errors.As(err, &be)
+}
+
+func (r *Runner) hasBudget() bool {
+	return r.opts.MaxLLMCalls > 0 || r.opts.MaxTokens > 0 || r.opts.MaxWallTime > 0
+}
+
+// startBudget 在每次 Run/Resume/Fork 进入执行时重置墙钟预算；调用次数与 token 按整个运行（含检查点恢复的调用）累计。
+func (r *Runner) startBudget() {
+	r.budgetMu.Lock()
+	defer r.budgetMu.Unlock()
+	r.budgetErr = nil
+	r.deadline = time.Time{}
+	if r.opts.MaxWallTime > 0 {
+		r.budgetStart = time.Now()
+		r.deadline = r.budgetStart.Add(r.opts.MaxWallTime)
+	}
+}
+
+func (r *Runner) budgetExceeded() *BudgetExceeded {
+	r.budgetMu.Lock()
+	defer r.budgetMu.Unlock()
+	return r.budgetErr
+}
+
+// reserveCall 在发起 LLM 调用前检查预算并占用一个调用名额及 prompt 的估算 token，耗尽时记录并返回 *BudgetExceeded。
+// 检查与占用在 budgetMu 下完成，并行步骤不会同时越过上限；返回的 release 须在调用记录用量之后执行。
+func (r *Runner) reserveCall(prompt string) (func(), error) {
+	if !r.hasBudget() {
+		return func() {}, nil
+	}
+	promptTokens := 0
+	if r.opts.MaxTokens > 0 {
+		promptTokens = usage.Estimate(prompt)
+	}
+	r.budgetMu.Lock()
+	if be := r.budgetErr; be != nil {
+		r.budgetMu.Unlock()
+		return nil, be
+	}
+	calls := r.usage.all()
+	tokens := 0
+	for _, c := range calls {
+		tokens += c.InputTokens + c.OutputTokens
+	}
+	var trip func() error
+	switch {
+	case r.opts.MaxLLMCalls > 0 && len(calls)+r.inflightCalls >= r.opts.MaxLLMCalls:
+		used := int64(len(calls) + r.inflightCalls)
+		trip = func() error { return r.tripBudget(BudgetLLMCalls, int64(r.opts.MaxLLMCalls), used) }
+	case r.opts.MaxTokens > 0 && tokens+r.inflightTokens >= r.opts.MaxTokens:
+		used := int64(tokens + r.inflightTokens)
+		trip = func() error { return r.tripBudget(BudgetTokens, int64(r.opts.MaxTokens), used) }
+	case !r.deadline.IsZero() && !time.Now().Before(r.deadline):
+		trip = r.tripWallTime
+	}
+	if trip != nil {
+		r.budgetMu.Unlock()
+		return nil, trip()
+	}
+	r.inflightCalls++
+	r.inflightTokens += promptTokens
+	r.budgetMu.Unlock()
+	return func() {
+		r.budgetMu.Lock()
+		r.inflightCalls--
+		r.inflightTokens -= promptTokens
+		r.budgetMu.Unlock()
+	}, nil
+}
+
+func (r *Runner) tripWallTime() error {
+	return r.tripBudget(BudgetWallTime, r.opts.MaxWallTime.Milliseconds(), time.Since(r.budgetStart).Milliseconds())
+}
+
+func (r *Runner) tripBudget(budget string, limit, used int64) error {
+	r.budgetMu.Lock()
+	first := r.budgetErr == nil
+	if first {
+		r.budgetErr = &BudgetExceeded{Budget: budget, Limit: limit, Used: used, At: time.Now().Format(time.RFC3339)}
+	}
+	be := r.budgetErr
+	r.budgetMu.Unlock()
+	if first {
+		r.emitProgress("budget", fmt.Sprintf("预算耗尽，停止后续 LLM 调用：%s", be.Error()), 0, countCompleted(r.todos.All()))
+	}
+	return be
+}
+
+// budgetContext 为单次 LLM 调用附加墙钟预算的截止时间，避免长调用越过预算。
+func (r *Runner) budgetContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.deadline.IsZero() {
+		return ctx, func() {}
+	}
+	return context.WithDeadline(ctx, r.deadline)
+}
+
+// budgetCallError 把因墙钟预算截止而失败的调用转换为预算错误。
+func (r *Runner) budgetCallError(ctx, callCtx context.Context, err error) error {
+	if err == nil || r.deadline.IsZero() || ctx.Err() != nil || !errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return r.tripWallTime()
+}
+
+func blockedByBudget(step PlanStep, be *BudgetExceeded) ActionStepLog {
+	return ActionStepLog{
+		StepID:    step.ID,
+		Title:     step.Title,
+		Status:    string(todo.StatusBlocked),
+		Attempts:  0,
+		ErrorText: fmt.Sprintf("预算耗尽，未执行：%s", be.Error()),
+	}
+}
+
+func buildBudgetFinal(goal string, be *BudgetExceeded, logs []ActionStepLog) string {
+	goal = strings.TrimSpace(goal)
+	if goal == "" {
+		goal = "完成用户请求"
+	}
+	done := make([]string, 0, len(logs))
+	pending := make([]string, 0, len(logs))
+	for _, l := range logs {
+		if l.Status == string(todo.StatusDone) {
+			done = append(done, l.Title)
+		} else {
+			pending = append(pending, l.Title)
+		}
+	}
+	return fmt.Sprintf("结论：预算耗尽，任务未完成。\n\n计划目标：%s\n触发预算：%s\n已完成步骤：%s\n未完成步骤：%s\n建议：提高预算后使用 --resume 继续。",
+		goal, be.Error(), joinOrNone(done), joinOrNone(pending))
+}
+
+func joinOrNone(items []string) string {
+	if len(items) == 0 {
+		return "无"
+	}
+	return strings.Join(items, "；")
+}
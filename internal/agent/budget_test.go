@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yangruihan/go-pi-pro/internal/audit"
+	"github.com/yangruihan/go-pi-pro/internal/llmtest"
+	"github.com/yangruihan/go-pi-pro/internal/todo"
+)
+
+func TestBudgetMaxLLMCallsBlocksRemainingSteps(t *testing.T) {
+	llm := llmtest.New()
+	llm.On(llmtest.PhaseRead).Reply("摘要")
+	llm.On(llmtest.PhasePlan).Reply(scenarioPlanJSON)
+	llm.On(llmtest.PhaseAct).Reply("完成")
+
+	r := newScenarioRunner(t, llm, RunnerOptions{MaxLLMCalls: 3})
+	res, err := r.Run(context.Background(), "交付功能")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if res.Budget == nil || res.Budget.Budget != BudgetLLMCalls || res.Budget.Limit != 3 {
+		t.Fatalf("expected max_llm_calls to trip, got %#v", res.Budget)
+	}
+	if len(llm.Calls()) != 3 || llm.CallCount(llmtest.PhaseFinal) != 0 {
+		t.Fatalf("budget must cap LLM calls, got %d", len(llm.Calls()))
+	}
+	if len(res.ActionLogs) != 2 || res.ActionLogs[0].Status != string(todo.StatusDone) {
+		t.Fatalf("unexpected logs: %#v", res.ActionLogs)
+	}
+	if s2 := res.ActionLogs[1]; s2.Status != string(todo.StatusBlocked) || !strings.Contains(s2.ErrorText, BudgetLLMCalls) {
+		t.Fatalf("s2 should be blocked by budget: %#v", s2)
+	}
+	if res.Outcome() != OutcomeBlocked || !strings.Contains(res.Final, "预算耗尽") {
+		t.Fatalf("outcome=%s final=%q", res.Outcome(), res.Final)
+	}
+	rec, err := audit.Load(res.AuditPath)
+	if err != nil {
+		t.Fatalf("load audit: %v", err)
+	}
+	if rec.Budget == nil || rec.Budget.Budget != BudgetLLMCalls {
+		t.Fatalf("audit should record tripped budget: %#v", rec.Budget)
+	}
+}
+
+func TestBudgetMaxTokensDuringPlanKeepsCheckpointResumable(t *testing.T) {
+	llm := llmtest.New()
+	llm.On(llmtest.PhaseRead).Reply("摘要").Usage(500, 100)
+
+	r := newScenarioRunner(t, llm, RunnerOptions{MaxTokens: 600})
+	res, err := r.Run(context.Background(), "交付功能")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if res.Budget == nil || res.Budget.Budget != BudgetTokens || res.Budget.Used != 600 {
+		t.Fatalf("expected max_tokens to trip, got %#v", res.Budget)
+	}
+	if llm.CallCount(llmtest.PhasePlan) != 0 || res.Outcome() != OutcomeBlocked {
+		t.Fatalf("plan must not be called after budget trips")
+	}
+	cp, err := LoadCheckpoint(CheckpointPath(r.opts.AuditDir, res.RunID))
+	if err != nil {
+		t.Fatalf("load checkpoint: %v", err)
+	}
+	if cp.Phase != PhasePlan || len(cp.LLMCalls) != 1 {
+		t.Fatalf("checkpoint should stay at plan: phase=%s calls=%d", cp.Phase, len(cp.LLMCalls))
+	}
+}
+
+func TestBudgetMaxLLMCallsHoldsWithParallelSteps(t *testing.T) {
+	var calls atomic.Int32
+	llm := funcLLM(func(string) (string, error) {
+		calls.Add(1)
+		// 让并行步骤的调用相互重叠
+		time.Sleep(50 * time.Millisecond)
+		return "ok", nil
+	})
+	dir := t.TempDir()
+	r := NewRunner(llm, RunnerOptions{AuditDir: dir, WorkingDir: dir, MaxActRetries: 1, MaxParallel: 4, MaxLLMCalls: 2})
+	cp := &Checkpoint{RunID: "par", Phase: PhaseAct, Plan: Plan{Goal: "g", Steps: []PlanStep{
+		{ID: "s1", Title: "A", Risk: "low"},
+		{ID: "s2", Title: "B", Risk: "low"},
+		{ID: "s3", Title: "C", Risk: "low"},
+		{ID: "s4", Title: "D", Risk: "low", DependsOn: []string{"s1", "s2", "s3"}},
+	}}}
+	logs, err := r.executePlan(context.Background(), cp)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("parallel steps must not overshoot max_llm_calls, got %d calls", got)
+	}
+	blocked := 0
+	for _, l := range logs {
+		if l.Status == string(todo.StatusBlocked) {
+			blocked++
+		}
+	}
+	if blocked != 2 || r.budgetExceeded() == nil || r.inflightCalls != 0 {
+		t.Fatalf("unexpected result: blocked=%d budget=%v inflight=%d", blocked, r.budgetExceeded(), r.inflightCalls)
+	}
+}
@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"github.com/yangruihan/go-pi-pro/internal/fschange"
+)
+
+// changeTracker 在相邻两次观测之间比较 WorkingDir 的快照，得到每次 act 尝试造成的文件变更。
+// 快照跳过 .gitignore 忽略的文件，大小与 mtime 未变的文件沿用上一次快照（r.fsLatest）而不重新读取。
+// 快照覆盖整个 WorkingDir，因此并行执行时无法区分各步骤的改动：观测区间与其它步骤重叠的尝试不记录变更，只标记 unattributed。
+type changeTracker struct {
+	r            *Runner
+	root         string
+	opts         fschange.Options
+	last         fschange.Snapshot
+	enabled      bool
+	overlapped   bool // 由 r.trackMu 保护
+	unattributed bool
+}
+
+func (r *Runner) newChangeTracker() *changeTracker {
+	if !r.opts.TrackChanges {
+		return &changeTracker{}
+	}
+	t := &changeTracker{
+		r:    r,
+		root: r.resolveWorkingDir(),
+		opts: fschange.Options{Ignore: append(append([]string(nil), fschange.DefaultIgnore...), r.opts.ChangeIgnore...)},
+	}
+	r.trackMu.Lock()
+	prev := r.fsLatest
+	r.trackMu.Unlock()
+	snap, err := fschange.Update(prev, t.root, t.opts)
+	if err != nil {
+		return &changeTracker{}
+	}
+	t.last = snap
+	t.enabled = true
+
+	r.trackMu.Lock()
+	r.fsLatest = snap
+	if r.tracking == nil {
+		r.tracking = make(map[*changeTracker]struct{})
+	}
+	for other := range r.tracking {
+		other.overlapped = true
+		t.overlapped = true
+	}
+	r.tracking[t] = struct{}{}
+	r.trackMu.Unlock()
+	return t
+}
+
+func (t *changeTracker) observe(attempt int) []fschange.Change {
+	if !t.enabled {
+		return nil
+	}
+	snap, err := fschange.Update(t.last, t.root, t.opts)
+	if err != nil {
+		return nil
+	}
+	t.r.trackMu.Lock()
+	t.r.fsLatest = snap
+	overlapped := t.overlapped
+	t.overlapped = len(t.r.tracking) > 1
+	t.r.trackMu.Unlock()
+
+	changes := fschange.Compare(t.last, snap)
+	t.last = snap
+	if overlapped {
+		if len(changes) > 0 {
+			t.unattributed = true
+		}
+		return nil
+	}
+	for i := range changes {
+		changes[i].Attempt = attempt
+	}
+	return changes
+}
+
+// close 结束追踪并释放快照；步骤返回前必须调用。
+func (t *changeTracker) close() {
+	if !t.enabled {
+		return
+	}
+	t.r.trackMu.Lock()
+	delete(t.r.tracking, t)
+	t.r.trackMu.Unlock()
+	t.enabled = false
+	t.last = fschange.Snapshot{}
+}
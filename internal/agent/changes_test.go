@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/yangruihan/go-pi-pro/internal/fschange"
+)
+
+func TestExecuteStepRecordsFileChangesPerAttempt(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.py"), []byte("print(1)\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "old.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	calls := 0
+	llm := funcLLM(func(prompt string) (string, error) {
+		calls++
+		switch calls {
+		case 1:
+			_ = os.WriteFile(filepath.Join(dir, "main.py"), []byte("print(2)\n"), 0o644)
+			_ = os.WriteFile(filepath.Join(dir, "build.log"), []byte("noise"), 0o644)
+		case 2:
+			_ = os.Remove(filepath.Join(dir, "old.txt"))
+			_ = os.WriteFile(filepath.Join(dir, "done.txt"), []byte("ok\n"), 0o644)
+		}
+		return "ok", nil
+	})
+	r := NewRunner(llm, RunnerOptions{AuditDir: t.TempDir(), WorkingDir: dir, MaxActRetries: 2, TrackChanges: true, ChangeIgnore: []string{"*.log"}})
+	step := PlanStep{ID: "s1", Title: "更新代码", Reason: "r", Risk: "low", Acceptance: []AcceptanceCriterion{
+		{Type: AcceptanceFileExists, Path: "done.txt"},
+	}}
+	log, err := r.executeStep(context.Background(), step, stepEnv{total: 1})
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	got := make([]string, 0, len(log.Changes))
+	for _, c := range log.Changes {
+		got = append(got, c.Kind+":"+c.Path+"@"+string(rune('0'+c.Attempt)))
+	}
+	want := "modified:main.py@1,created:done.txt@2,deleted:old.txt@2"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("unexpected changes: %v", got)
+	}
+	if !strings.Contains(log.Changes[0].Diff, "+print(2)") {
+		t.Fatalf("missing diff: %s", log.Changes[0].Diff)
+	}
+	if !strings.Contains(renderActionLogs([]ActionStepLog{log}), fschange.Summary(log.Changes)) {
+		t.Fatalf("render should include change summary")
+	}
+}
+
+func TestParallelStepsDoNotRecordEachOthersChanges(t *testing.T) {
+	dir := t.TempDir()
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	llm := funcLLM(func(prompt string) (string, error) {
+		for _, name := range []string{"A", "B", "C"} {
+			if !strings.Contains(prompt, "当前步骤："+name+"\n") {
+				continue
+			}
+			_ = os.WriteFile(filepath.Join(dir, strings.ToLower(name)+".txt"), []byte(name), 0o644)
+			if name != "C" {
+				// 等另一个并行步骤也完成写入，保证两者的观测区间重叠
+				arrived.Done()
+				arrived.Wait()
+			}
+		}
+		return "ok", nil
+	})
+	r := NewRunner(llm, RunnerOptions{AuditDir: t.TempDir(), WorkingDir: dir, MaxActRetries: 1, MaxParallel: 2, TrackChanges: true})
+	cp := &Checkpoint{RunID: "par", Phase: PhaseAct, Plan: Plan{Goal: "g", Steps: []PlanStep{
+		{ID: "s1", Title: "A", Risk: "low"},
+		{ID: "s2", Title: "B", Risk: "low"},
+		{ID: "s3", Title: "C", Risk: "low", DependsOn: []string{"s1", "s2"}},
+	}}}
+	logs, err := r.executePlan(context.Background(), cp)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	for _, l := range logs[:2] {
+		if len(l.Changes) != 0 || !l.ChangesUnattributed {
+			t.Fatalf("parallel step %s should not claim changes: %#v", l.StepID, l.Changes)
+		}
+	}
+	if c := logs[2]; c.ChangesUnattributed || len(c.Changes) != 1 || c.Changes[0].Path != "c.txt" {
+		t.Fatalf("step running alone should record its own changes: %#v", c)
+	}
+	if len(r.tracking) != 0 {
+		t.Fatalf("trackers should be released: %d", len(r.tracking))
+	}
+}
@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yangruihan/go-pi-pro/internal/audit"
+	"github.com/yangruihan/go-pi-pro/internal/todo"
+)
+
+const (
+	PhaseRead  = "read"
+	PhasePlan  = "plan"
+	PhaseAct   = "act"
+	PhaseFinal = "final"
+	PhaseDone  = "done"
+)
+
+// Checkpoint 记录一次运行的中间状态，Phase 表示下一个待执行的阶段。
+// 与审计共用 audit 包中的记录类型和 schema_version，旧检查点在读取时同样会被迁移。
+type Checkpoint struct {
+	SchemaVersion int                `json:"schema_version"`
+	RunID         string             `json:"run_id" redact:"-"`
+	StartedAt     string             `json:"started_at"`
+	UpdatedAt     string             `json:"updated_at"`
+	UserInput     string             `json:"user_input"`
+	Phase         string             `json:"phase"`
+	ReadSummary   string             `json:"read_summary"`
+	Plan          Plan               `json:"plan"`
+	PlanSource    string             `json:"plan_source,omitempty"`
+	ActionLogs    []ActionStepLog    `json:"action_logs"`
+	Replans       []ReplanRecord     `json:"replans,omitempty"`
+	Todos         []todo.Item        `json:"todos"`
+	ParentRunID   string             `json:"parent_run_id,omitempty" redact:"-"`
+	ForkedAt      string             `json:"forked_at,omitempty"`
+	LLMCalls      []CallUsage        `json:"llm_calls,omitempty"`
+	Transcript    []Exchange         `json:"transcript,omitempty"`
+	PlanReviews   []PlanReviewRecord `json:"plan_reviews,omitempty"`
+}
+
+func CheckpointPath(auditDir, runID string) string {
+	base := strings.TrimSpace(auditDir)
+	if base == "" {
+		base = filepath.Join(".gopi-pro", "runs")
+	}
+	return filepath.Join(base, "checkpoints", normalizeRunID(runID)+".json")
+}
+
+func AuditPath(auditDir, runID string) string {
+	base := strings.TrimSpace(auditDir)
+	if base == "" {
+		base = filepath.Join(".gopi-pro", "runs")
+	}
+	return filepath.Join(base, fmt.Sprintf("run-%s.json", normalizeRunID(runID)))
+}
+
+func LoadCheckpoint(path string) (Checkpoint, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	var cp Checkpoint
+	if err := audit.UpgradeJSON(b, &cp); err != nil {
+		return Checkpoint{}, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+	}
+	if strings.TrimSpace(cp.RunID) == "" {
+		return Checkpoint{}, fmt.Errorf("invalid checkpoint %s: missing run_id", path)
+	}
+	switch cp.Phase {
+	case PhaseRead, PhasePlan, PhaseAct, PhaseFinal, PhaseDone:
+	default:
+		return Checkpoint{}, fmt.Errorf("invalid checkpoint %s: unknown phase %q", path, cp.Phase)
+	}
+	return cp, nil
+}
+
+func (r *Runner) saveCheckpoint(cp *Checkpoint) error {
+	cp.SchemaVersion = audit.SchemaVersion
+	cp.UpdatedAt = time.Now().Format(time.RFC3339)
+	cp.Todos = r.todos.All()
+	cp.LLMCalls = r.usage.all()
+	cp.Transcript = r.usage.transcript()
+	// 其余字段保留原文供 --resume 原样继续，因此文件仅本人可读，运行成功结束后删除；transcript 只用于记录，写盘前脱敏
+	out := *cp
+	if _, err := r.redactedCopy(cp.Transcript, &out.Transcript); err != nil {
+		return err
+	}
+	path := CheckpointPath(r.opts.AuditDir, cp.RunID)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	_ = os.Remove(tmp)
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// removeCheckpoint 删除已成功结束的运行的检查点，它已不能再 --resume。
+func (r *Runner) removeCheckpoint(runID string) {
+	path := CheckpointPath(r.opts.AuditDir, runID)
+	_ = os.Remove(path)
+	_ = os.Remove(path + ".tmp")
+}
+
+func (r *Runner) newRunID(startedAt time.Time) string {
+	base := startedAt.Format("20060102-150405")
+	id := base
+	for n := 2; ; n++ {
+		_, auditErr := os.Stat(filepath.Join(r.opts.AuditDir, fmt.Sprintf("run-%s.json", id)))
+		_, cpErr := os.Stat(CheckpointPath(r.opts.AuditDir, id))
+		if os.IsNotExist(auditErr) && os.IsNotExist(cpErr) {
+			return id
+		}
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+func normalizeRunID(runID string) string {
+	id := strings.TrimSpace(runID)
+	id = strings.TrimSuffix(filepath.Base(id), ".json")
+	return strings.TrimPrefix(id, "run-")
+}
@@ -0,0 +1,181 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/yangruihan/go-pi-pro/internal/redact"
+	"github.com/yangruihan/go-pi-pro/internal/todo"
+)
+
+type funcLLM func(prompt string) (string, error)
+
+func (f funcLLM) Ask(_ context.Context, prompt string) (string, error) {
+	return f(prompt)
+}
+
+const testPlanJSON = `{"goal":"完成任务","steps":[{"id":"s1","title":"步骤一","reason":"a","risk":"low","requires_approval":false},{"id":"s2","title":"步骤二","reason":"b","risk":"low","requires_approval":false},{"id":"s3","title":"步骤三","reason":"c","risk":"low","requires_approval":false}]}`
+
+func TestRunResumeFromCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	failStep2 := true
+	actCalls := map[string]int{}
+	llm := funcLLM(func(prompt string) (string, error) {
+		switch {
+		case strings.HasPrefix(prompt, "你是read阶段"):
+			return "需求摘要", nil
+		case strings.HasPrefix(prompt, "你是plan阶段"):
+			return testPlanJSON, nil
+		case strings.HasPrefix(prompt, "你是act阶段"):
+			for _, title := range []string{"步骤一", "步骤二", "步骤三"} {
+				if strings.Contains(prompt, "当前步骤："+title) {
+					actCalls[title]++
+					if title == "步骤二" && failStep2 {
+						return "", errors.New("llm unavailable")
+					}
+					return title + " ok", nil
+				}
+			}
+		}
+		return "最终答复", nil
+	})
+
+	r := NewRunner(llm, RunnerOptions{AuditDir: dir, WorkingDir: dir, MaxActRetries: 1})
+	first, err := r.Run(context.Background(), "执行三个步骤")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if _, blocked := firstBlockedAction(first.ActionLogs); !blocked {
+		t.Fatalf("expected blocked run: %#v", first.ActionLogs)
+	}
+
+	cp, err := LoadCheckpoint(CheckpointPath(dir, first.RunID))
+	if err != nil {
+		t.Fatalf("load checkpoint: %v", err)
+	}
+	if cp.Phase != PhaseDone || len(cp.Todos) != 3 {
+		t.Fatalf("unexpected checkpoint: %#v", cp)
+	}
+
+	failStep2 = false
+	r2 := NewRunner(llm, RunnerOptions{AuditDir: dir, WorkingDir: dir, MaxActRetries: 1})
+	res, err := r2.Resume(context.Background(), CheckpointPath(dir, "run-"+first.RunID+".json"))
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if res.RunID != first.RunID {
+		t.Fatalf("run id changed: %s -> %s", first.RunID, res.RunID)
+	}
+	if actCalls["步骤一"] != 1 || actCalls["步骤二"] != 2 || actCalls["步骤三"] != 1 {
+		t.Fatalf("unexpected act calls: %#v", actCalls)
+	}
+	for _, l := range res.ActionLogs {
+		if l.Status != string(todo.StatusDone) {
+			t.Fatalf("expected all done: %#v", res.ActionLogs)
+		}
+	}
+
+	if _, err := r2.Resume(context.Background(), CheckpointPath(dir, first.RunID)); err == nil {
+		t.Fatalf("expected error resuming completed run")
+	}
+}
+
+func TestResumeKeepsSecretsFromTask(t *testing.T) {
+	redactor, err := redact.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const task = "在 .env 中设置 DB_PASSWORD=hunter2hunter2"
+	dir := t.TempDir()
+	fail := true
+	var resumedPrompts []string
+	llm := funcLLM(func(prompt string) (string, error) {
+		switch {
+		case strings.HasPrefix(prompt, "你是read阶段"):
+			return "需要写入 DB_PASSWORD=hunter2hunter2", nil
+		case strings.HasPrefix(prompt, "你是plan阶段"):
+			return strings.Replace(testPlanJSON, `"title":"步骤二"`, `"title":"步骤二：写入 DB_PASSWORD=hunter2hunter2"`, 1), nil
+		case strings.HasPrefix(prompt, "你是act阶段"):
+			if !fail {
+				resumedPrompts = append(resumedPrompts, prompt)
+			}
+			if fail && strings.Contains(prompt, "当前步骤：步骤二") {
+				return "", errors.New("llm unavailable")
+			}
+			return "ok", nil
+		}
+		return "最终答复", nil
+	})
+	opts := RunnerOptions{AuditDir: dir, WorkingDir: dir, MaxActRetries: 1, Redactor: redactor}
+	first, err := NewRunner(llm, opts).Run(context.Background(), task)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	path := CheckpointPath(dir, first.RunID)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("blocked run should keep its checkpoint: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+		t.Fatalf("checkpoint should be private, got %v", info.Mode().Perm())
+	}
+	cp, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.UserInput != task || strings.Contains(cp.Transcript[0].Prompt, "hunter2hunter2") {
+		t.Fatalf("checkpoint should keep the task verbatim and redact the transcript: %q / %q", cp.UserInput, cp.Transcript[0].Prompt)
+	}
+
+	fail = false
+	if _, err := NewRunner(llm, opts).Resume(context.Background(), path); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if len(resumedPrompts) == 0 {
+		t.Fatalf("resume should run the remaining steps")
+	}
+	for _, p := range resumedPrompts {
+		if strings.Contains(p, "[REDACTED") || !strings.Contains(p, "DB_PASSWORD=hunter2hunter2") {
+			t.Fatalf("resumed act prompt should carry the original text: %s", p)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("checkpoint should be removed once the run completes: %v", err)
+	}
+}
+
+func TestLoadCheckpointRejectsUnknownPhase(t *testing.T) {
+	dir := t.TempDir()
+	r := NewRunner(nil, RunnerOptions{AuditDir: dir})
+	cp := &Checkpoint{RunID: "x", Phase: "bogus"}
+	if err := r.saveCheckpoint(cp); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if _, err := LoadCheckpoint(CheckpointPath(dir, "x")); err == nil {
+		t.Fatalf("expected invalid phase error")
+	}
+}
+
+func TestLoadCheckpointMigratesLegacyActionLogs(t *testing.T) {
+	dir := t.TempDir()
+	path := CheckpointPath(dir, "old")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data := `{"run_id":"old","phase":"act","plan":{"goal":"g","steps":[{"id":"s1","title":"a"}]},"action_logs":[{"StepID":"s1","Title":"a","Status":"done","Attempts":1}]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(cp.ActionLogs) != 1 || cp.ActionLogs[0].StepID != "s1" || cp.ActionLogs[0].Status != "done" {
+		t.Fatalf("legacy action logs not migrated: %#v", cp.ActionLogs)
+	}
+}
@@ -0,0 +1,207 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/yangruihan/go-pi-pro/internal/todo"
+)
+
+type stepOutcome struct {
+	id  string
+	log ActionStepLog
+	err error
+}
+
+// executePlan 按 depends_on 构成的 DAG 调度步骤：依赖全部完成的步骤最多 MaxParallel 个并发执行，
+// 只有直接或间接依赖阻塞步骤的步骤才会被跳过。
+func (r *Runner) executePlan(ctx context.Context, cp *Checkpoint) ([]ActionStepLog, error) {
+	plan := cp.Plan
+	requestedFiles := detectRequestedFiles(cp.UserInput)
+
+	steps := make([]PlanStep, 0, len(plan.Steps))
+	for i, step := range plan.Steps {
+		if strings.TrimSpace(step.ID) == "" {
+			step.ID = fmt.Sprintf("s%d", i+1)
+		}
+		if strings.TrimSpace(step.Title) == "" {
+			continue
+		}
+		steps = append(steps, step)
+	}
+	deps := planDependencies(steps)
+	env := stepEnv{runID: cp.RunID, readSummary: cp.ReadSummary, requestedFiles: requestedFiles, total: len(plan.Steps)}
+	r.snapshotBase(ctx, cp.RunID)
+
+	logs := make(map[string]ActionStepLog, len(steps))
+	for _, l := range cp.ActionLogs {
+		if l.Status == string(todo.StatusDone) {
+			logs[l.StepID] = l
+		}
+	}
+	ordered := func() []ActionStepLog {
+		out := make([]ActionStepLog, 0, len(logs))
+		for _, s := range steps {
+			if l, ok := logs[s.ID]; ok {
+				out = append(out, l)
+			}
+		}
+		return out
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan stepOutcome)
+	started := make(map[string]bool, len(steps))
+	running := 0
+	var firstErr error
+
+	for {
+		for changed := firstErr == nil; changed; {
+			changed = false
+			for _, step := range steps {
+				if started[step.ID] {
+					continue
+				}
+				if _, ok := logs[step.ID]; ok {
+					started[step.ID] = true
+					continue
+				}
+				if be := r.budgetExceeded(); be != nil {
+					started[step.ID] = true
+					changed = true
+					r.todos.Upsert(step.Title, todo.StatusBlocked)
+					logs[step.ID] = blockedByBudget(step, be)
+					continue
+				}
+				ready, failedDep := dependencyState(deps[step.ID], logs)
+				if failedDep != "" {
+					started[step.ID] = true
+					changed = true
+					r.todos.Upsert(step.Title, todo.StatusSkipped)
+					logs[step.ID] = ActionStepLog{
+						StepID:    step.ID,
+						Title:     step.Title,
+						Status:    string(todo.StatusSkipped),
+						Attempts:  0,
+						ErrorText: fmt.Sprintf("前置步骤失败，已跳过：%s", failedDep),
+					}
+					continue
+				}
+				if !ready || running >= r.opts.MaxParallel {
+					continue
+				}
+				started[step.ID] = true
+				running++
+				go func(step PlanStep) {
+					log, err := r.executeStep(runCtx, step, env)
+					results <- stepOutcome{id: step.ID, log: log, err: err}
+				}(step)
+			}
+		}
+		if running == 0 {
+			break
+		}
+
+		res := <-results
+		running--
+		if res.err != nil {
+			if firstErr == nil {
+				firstErr = res.err
+				cancel()
+			}
+			continue
+		}
+		logs[res.id] = res.log
+		cp.ActionLogs = ordered()
+		_ = r.saveCheckpoint(cp)
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return ordered(), nil
+}
+
+// planDependencies 返回每个步骤的前置步骤；计划中没有任何 depends_on 时按顺序串行依赖，兼容旧计划。
+func planDependencies(steps []PlanStep) map[string][]string {
+	deps := make(map[string][]string, len(steps))
+	declared := false
+	for _, s := range steps {
+		if len(s.DependsOn) > 0 {
+			declared = true
+			break
+		}
+	}
+	for i, s := range steps {
+		switch {
+		case declared:
+			deps[s.ID] = s.DependsOn
+		case i > 0:
+			deps[s.ID] = []string{steps[i-1].ID}
+		}
+	}
+	return deps
+}
+
+func dependencyState(deps []string, logs map[string]ActionStepLog) (ready bool, failedDep string) {
+	ready = true
+	for _, id := range deps {
+		l, ok := logs[id]
+		if !ok {
+			ready = false
+			continue
+		}
+		if l.Status == string(todo.StatusBlocked) || (l.Status == string(todo.StatusSkipped) && strings.TrimSpace(l.ErrorText) != "") {
+			return false, l.Title
+		}
+	}
+	return ready, ""
+}
+
+func validateDependencies(steps []PlanStep) error {
+	index := make(map[string]int, len(steps))
+	for i, s := range steps {
+		index[s.ID] = i
+	}
+	for _, s := range steps {
+		for _, d := range s.DependsOn {
+			if d == s.ID {
+				return fmt.Errorf("step %s depends on itself", s.ID)
+			}
+			if _, ok := index[d]; !ok {
+				return fmt.Errorf("step %s depends on unknown step %s", s.ID, d)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(steps))
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visiting:
+			return fmt.Errorf("dependency cycle at step %s", steps[i].ID)
+		case visited:
+			return nil
+		}
+		state[i] = visiting
+		for _, d := range steps[i].DependsOn {
+			if err := visit(index[d]); err != nil {
+				return err
+			}
+		}
+		state[i] = visited
+		return nil
+	}
+	for i := range steps {
+		if err := visit(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yangruihan/go-pi-pro/internal/todo"
+)
+
+func TestValidateDependencies(t *testing.T) {
+	ok := []PlanStep{{ID: "s1"}, {ID: "s2", DependsOn: []string{"s1"}}, {ID: "s3", DependsOn: []string{"s1", "s2"}}}
+	if err := validateDependencies(ok); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	unknown := []PlanStep{{ID: "s1", DependsOn: []string{"s9"}}}
+	if err := validateDependencies(unknown); err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Fatalf("expected unknown dependency error, got %v", err)
+	}
+	cycle := []PlanStep{{ID: "s1", DependsOn: []string{"s3"}}, {ID: "s2", DependsOn: []string{"s1"}}, {ID: "s3", DependsOn: []string{"s2"}}}
+	if err := validateDependencies(cycle); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("expected cycle error, got %v", err)
+	}
+}
+
+func TestNormalizePlanRejectsDependencyCycle(t *testing.T) {
+	p := Plan{Steps: []PlanStep{
+		{ID: "s1", Title: "a", DependsOn: []string{"s2"}},
+		{ID: "s2", Title: "b", DependsOn: []string{" s1 ", "s1"}},
+	}}
+	if _, ok := normalizePlan(p); ok {
+		t.Fatalf("expected cycle to be rejected")
+	}
+	p.Steps[0].DependsOn = nil
+	n, ok := normalizePlan(p)
+	if !ok {
+		t.Fatalf("expected normalize success")
+	}
+	if len(n.Steps[1].DependsOn) != 1 || n.Steps[1].DependsOn[0] != "s1" {
+		t.Fatalf("depends_on not normalized: %#v", n.Steps[1].DependsOn)
+	}
+}
+
+func TestPlanDependenciesDefaultsToSequential(t *testing.T) {
+	deps := planDependencies([]PlanStep{{ID: "s1"}, {ID: "s2"}, {ID: "s3"}})
+	if len(deps["s1"]) != 0 || deps["s3"][0] != "s2" {
+		t.Fatalf("unexpected implicit deps: %#v", deps)
+	}
+}
+
+func TestExecutePlanRunsIndependentStepsInParallel(t *testing.T) {
+	var current, peak int32
+	var mu sync.Mutex
+	called := map[string]bool{}
+	llm := funcLLM(func(prompt string) (string, error) {
+		n := atomic.AddInt32(&current, 1)
+		defer atomic.AddInt32(&current, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		for _, title := range []string{"A", "B", "C", "D"} {
+			if strings.Contains(prompt, "当前步骤："+title+"\n") {
+				called[title] = true
+				if title == "B" {
+					return "", errors.New("boom")
+				}
+			}
+		}
+		return "ok", nil
+	})
+
+	dir := t.TempDir()
+	r := NewRunner(llm, RunnerOptions{AuditDir: dir, WorkingDir: dir, MaxActRetries: 1, MaxParallel: 3})
+	cp := &Checkpoint{RunID: "dag", Phase: PhaseAct, Plan: Plan{Goal: "g", Steps: []PlanStep{
+		{ID: "s1", Title: "A", Risk: "low"},
+		{ID: "s2", Title: "B", Risk: "low"},
+		{ID: "s3", Title: "C", Risk: "low", DependsOn: []string{"s2"}},
+		{ID: "s4", Title: "D", Risk: "low", DependsOn: []string{"s1"}},
+	}}}
+	logs, err := r.executePlan(context.Background(), cp)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if atomic.LoadInt32(&peak) < 2 {
+		t.Fatalf("expected parallel execution, peak=%d", peak)
+	}
+	want := map[string]todo.Status{"s1": todo.StatusDone, "s2": todo.StatusBlocked, "s3": todo.StatusSkipped, "s4": todo.StatusDone}
+	if len(logs) != 4 {
+		t.Fatalf("unexpected logs: %#v", logs)
+	}
+	for i, l := range logs {
+		if l.StepID != cp.Plan.Steps[i].ID {
+			t.Fatalf("logs not in plan order: %#v", logs)
+		}
+		if l.Status != string(want[l.StepID]) {
+			t.Fatalf("step %s status=%s want %s", l.StepID, l.Status, want[l.StepID])
+		}
+	}
+	if called["C"] {
+		t.Fatalf("dependent of blocked step must not run")
+	}
+}
@@ -0,0 +1,130 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yangruihan/go-pi-pro/internal/audit"
+	"github.com/yangruihan/go-pi-pro/internal/gitsnap"
+	"github.com/yangruihan/go-pi-pro/internal/todo"
+)
+
+type ForkOptions struct {
+	AtStepID     string
+	Instructions string
+	Steps        []PlanStep
+	RestoreTree  bool
+}
+
+// Fork 从历史运行 parentRunID 的审计中恢复计划，保留 AtStepID（含）之前已完成的步骤，
+// 然后以新的 run 继续执行剩余步骤。剩余步骤可以直接沿用、由 Steps 替换，或按 Instructions 让 LLM 重新规划。
+func (r *Runner) Fork(ctx context.Context, parentRunID string, opts ForkOptions) (StepResult, error) {
+	parentRunID = normalizeRunID(parentRunID)
+	parent, err := audit.Load(AuditPath(r.opts.AuditDir, parentRunID))
+	if err != nil {
+		return StepResult{}, err
+	}
+	atIndex := -1
+	for i, s := range parent.Plan.Steps {
+		if s.ID == strings.TrimSpace(opts.AtStepID) {
+			atIndex = i
+			break
+		}
+	}
+	if atIndex < 0 {
+		return StepResult{}, fmt.Errorf("step %q not found in run %s", opts.AtStepID, parentRunID)
+	}
+
+	kept, doneIDs := forkKeptLogs(parent, atIndex)
+	plan := parent.Plan
+	userInput := parent.UserInput
+	if instructions := strings.TrimSpace(opts.Instructions); instructions != "" {
+		userInput = fmt.Sprintf("%s\n\n分叉后的新指令：%s", strings.TrimSpace(parent.UserInput), instructions)
+	}
+	switch {
+	case len(opts.Steps) > 0:
+		if plan, err = mergeReplan(parent.Plan, doneIDs, Plan{Steps: opts.Steps}); err != nil {
+			return StepResult{}, err
+		}
+	case strings.TrimSpace(opts.Instructions) != "":
+		r.emitProgress("fork", "按新指令重新规划剩余步骤", 0, 0)
+		raw, err := r.ask(ctx, "replan", buildForkPrompt(parent.Plan, kept, opts.Instructions))
+		if err != nil {
+			return StepResult{}, err
+		}
+		if plan, err = mergeReplan(parent.Plan, doneIDs, r.parseRevisedPlan(raw)); err != nil {
+			return StepResult{}, err
+		}
+	}
+
+	if opts.RestoreTree && atIndex+1 < len(parent.Plan.Steps) {
+		ref := SnapshotRef(parentRunID, parent.Plan.Steps[atIndex+1].ID)
+		dir := r.resolveWorkingDir()
+		if !gitsnap.Exists(ctx, dir, ref) {
+			return StepResult{}, fmt.Errorf("no git snapshot %s to restore (was the parent run started with --git-snapshot?)", ref)
+		}
+		if err := gitsnap.Restore(ctx, dir, ref, r.snapshotExcludes()...); err != nil {
+			return StepResult{}, err
+		}
+	}
+
+	startedAt := time.Now()
+	r.todos = todo.New()
+	r.usage = newUsageLog(nil, nil)
+	for _, s := range plan.Steps {
+		status := todo.StatusTodo
+		if _, ok := doneIDs[s.ID]; ok {
+			status = todo.StatusDone
+		}
+		r.todos.Upsert(s.Title, status)
+	}
+	cp := &Checkpoint{
+		RunID:       r.newRunID(startedAt),
+		StartedAt:   startedAt.Format(time.RFC3339),
+		UserInput:   userInput,
+		Phase:       PhaseAct,
+		ReadSummary: parent.ReadSummary,
+		Plan:        plan,
+		ActionLogs:  kept,
+		ParentRunID: parentRunID,
+		ForkedAt:    parent.Plan.Steps[atIndex].ID,
+	}
+	_ = r.saveCheckpoint(cp)
+	r.emitProgress("fork", fmt.Sprintf("从 %s 的 %s 分叉为新运行 %s", parentRunID, cp.ForkedAt, cp.RunID), len(plan.Steps), countCompleted(r.todos.All()))
+	return r.runFrom(ctx, cp, startedAt)
+}
+
+func forkKeptLogs(parent audit.Run, atIndex int) ([]ActionStepLog, map[string]struct{}) {
+	upTo := make(map[string]struct{}, atIndex+1)
+	for _, s := range parent.Plan.Steps[:atIndex+1] {
+		upTo[s.ID] = struct{}{}
+	}
+	kept := make([]ActionStepLog, 0, len(upTo))
+	doneIDs := make(map[string]struct{}, len(upTo))
+	for _, l := range parent.ActionLogs {
+		if _, ok := upTo[l.StepID]; ok && l.Status == string(todo.StatusDone) {
+			kept = append(kept, l)
+			doneIDs[l.StepID] = struct{}{}
+		}
+	}
+	return kept, doneIDs
+}
+
+func buildForkPrompt(plan Plan, doneLogs []ActionStepLog, instructions string) string {
+	planJSON, _ := json.MarshalIndent(plan, "", "  ")
+	return fmt.Sprintf(`你是replan阶段。用户从一次历史运行的中途分叉，希望按新的指令换一种方式完成剩余部分。请基于已完成步骤，只输出剩余部分的计划（严格JSON，不要输出其它文字）。
+JSON Schema:
+%s
+要求：不要重复已完成步骤；新步骤id不得与已有步骤id重复；depends_on 可以引用已完成步骤的id。
+acceptance 可选，写法与原计划相同。
+原计划：
+%s
+
+已完成步骤：
+%s
+
+新指令：%s`, remainderPlanSchema, string(planJSON), renderActionLogs(doneLogs), strings.TrimSpace(instructions))
+}
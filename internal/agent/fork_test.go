@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/yangruihan/go-pi-pro/internal/audit"
+	"github.com/yangruihan/go-pi-pro/internal/llmtest"
+	"github.com/yangruihan/go-pi-pro/internal/todo"
+)
+
+func forkTestRunner(t *testing.T, llm *llmtest.LLM) *Runner {
+	t.Helper()
+	dir := t.TempDir()
+	return NewRunner(llm, RunnerOptions{AuditDir: dir, WorkingDir: dir, MaxActRetries: 1})
+}
+
+func TestForkKeepsCompletedStepsAndLinksParent(t *testing.T) {
+	llm := llmtest.New()
+	llm.On(llmtest.PhaseRead).Reply("摘要")
+	llm.On(llmtest.PhasePlan).Reply(testPlanJSON)
+	llm.On(llmtest.PhaseAct).Reply("ok")
+	llm.On(llmtest.PhaseFinal).Reply("完成")
+	r := forkTestRunner(t, llm)
+
+	parent, err := r.Run(context.Background(), "执行三个步骤")
+	if err != nil {
+		t.Fatalf("parent run: %v", err)
+	}
+	actBefore := llm.CallCount(llmtest.PhaseAct)
+
+	child, err := r.Fork(context.Background(), parent.RunID, ForkOptions{
+		AtStepID: "s2",
+		Steps:    []PlanStep{{ID: "s3", Title: "换一种方式完成步骤三", DependsOn: []string{"s2"}}},
+	})
+	if err != nil {
+		t.Fatalf("fork: %v", err)
+	}
+	if child.RunID == parent.RunID || child.ParentRunID != parent.RunID {
+		t.Fatalf("fork must be a new run linked to its parent: %#v", child)
+	}
+	if got := llm.CallCount(llmtest.PhaseAct) - actBefore; got != 1 {
+		t.Fatalf("only the new step should execute, act calls=%d", got)
+	}
+	if len(child.ActionLogs) != 3 || child.ActionLogs[0].StepID != "s1" || child.ActionLogs[1].StepID != "s2" {
+		t.Fatalf("unexpected fork logs: %#v", child.ActionLogs)
+	}
+	if !strings.Contains(child.ActionLogs[2].Title, "换一种方式") || child.ActionLogs[2].Status != string(todo.StatusDone) {
+		t.Fatalf("replacement step not executed: %#v", child.ActionLogs[2])
+	}
+
+	rec, err := audit.Load(child.AuditPath)
+	if err != nil {
+		t.Fatalf("load audit: %v", err)
+	}
+	if rec.ParentRunID != parent.RunID || rec.ForkedAt != "s2" {
+		t.Fatalf("audit should link to parent: parent=%q forked_at=%q", rec.ParentRunID, rec.ForkedAt)
+	}
+}
+
+func TestForkWithInstructionsReplansRemainder(t *testing.T) {
+	llm := llmtest.New()
+	llm.On(llmtest.PhaseRead).Reply("摘要")
+	llm.On(llmtest.PhasePlan).Reply(testPlanJSON)
+	llm.On(llmtest.PhaseReplan).Matching("新指令：改用 Go 实现").Reply(`{"goal":"g","steps":[{"id":"r1","title":"用 Go 重写","reason":"r","risk":"low","requires_approval":false}]}`)
+	llm.On(llmtest.PhaseAct).Reply("ok")
+	llm.On(llmtest.PhaseFinal).Reply("完成")
+	r := forkTestRunner(t, llm)
+
+	parent, err := r.Run(context.Background(), "执行三个步骤")
+	if err != nil {
+		t.Fatalf("parent run: %v", err)
+	}
+	child, err := r.Fork(context.Background(), parent.RunID, ForkOptions{AtStepID: "s1", Instructions: "改用 Go 实现"})
+	if err != nil {
+		t.Fatalf("fork: %v", err)
+	}
+	titles := make([]string, 0)
+	for _, s := range child.Plan.Steps {
+		titles = append(titles, s.Title)
+	}
+	if strings.Join(titles, ",") != "步骤一,用 Go 重写" {
+		t.Fatalf("unexpected forked plan: %v", titles)
+	}
+
+	if _, err := r.Fork(context.Background(), parent.RunID, ForkOptions{AtStepID: "s9"}); err == nil {
+		t.Fatalf("expected error for unknown step")
+	}
+}
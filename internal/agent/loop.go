@@ -8,40 +8,208 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/yangruihan/go-pi-pro/internal/audit"
+	"github.com/yangruihan/go-pi-pro/internal/fschange"
 	"github.com/yangruihan/go-pi-pro/internal/todo"
 )
 
 type Runner struct {
-	llm   LLM
-	todos *todo.Store
-	opts  RunnerOptions
+	llm        LLM
+	todos      *todo.Store
+	opts       RunnerOptions
+	progressMu sync.Mutex
+	approvalMu sync.Mutex
+	usage      *usageLog
+
+	trackMu  sync.Mutex
+	tracking map[*changeTracker]struct{}
+	fsLatest fschange.Snapshot // 最近一次快照，供下一次快照沿用未变文件的哈希
+
+	budgetMu    sync.Mutex
+	budgetErr   *BudgetExceeded
+	budgetStart time.Time
+	deadline    time.Time
+	// 已发出但尚未记录用量的调用数与其 prompt 的估算 token，由 budgetMu 保护
+	inflightCalls  int
+	inflightTokens int
 }
 
 func NewRunner(llm LLM, opts RunnerOptions) *Runner {
 	if opts.MaxActRetries <= 0 {
 		opts.MaxActRetries = 2
 	}
+	if opts.MaxParallel <= 0 {
+		opts.MaxParallel = 1
+	}
+	if opts.PlanRepairRounds <= 0 {
+		opts.PlanRepairRounds = 1
+	}
+	if opts.PlanMinSteps <= 0 {
+		opts.PlanMinSteps = defaultPlanMinSteps
+	}
+	if opts.PlanMaxSteps <= 0 {
+		opts.PlanMaxSteps = defaultPlanMaxSteps
+	}
+	if opts.PlanMaxSteps < opts.PlanMinSteps {
+		opts.PlanMaxSteps = opts.PlanMinSteps
+	}
 	if strings.TrimSpace(opts.AuditDir) == "" {
 		opts.AuditDir = filepath.Join(".gopi-pro", "runs")
 	}
-	return &Runner{llm: llm, todos: todo.New(), opts: opts}
+	return &Runner{llm: llm, todos: todo.New(), opts: opts, usage: newUsageLog(nil, nil)}
 }
 
 func (r *Runner) Run(ctx context.Context, userInput string) (StepResult, error) {
 	startedAt := time.Now()
 	r.todos = todo.New()
-	r.emitProgress("read", "分析用户请求", 0, 0)
+	r.usage = newUsageLog(nil, nil)
+	cp := &Checkpoint{
+		RunID:     r.newRunID(startedAt),
+		StartedAt: startedAt.Format(time.RFC3339),
+		UserInput: userInput,
+		Phase:     PhaseRead,
+	}
+	return r.runFrom(ctx, cp, startedAt)
+}
 
-	readPrompt := buildReadPrompt(userInput)
-	readSummary, err := r.llm.Ask(ctx, readPrompt)
+func (r *Runner) Resume(ctx context.Context, checkpointPath string) (StepResult, error) {
+	cp, err := LoadCheckpoint(checkpointPath)
 	if err != nil {
 		return StepResult{}, err
 	}
-	r.emitProgress("read", "完成需求提炼", 0, 0)
+	if cp.Phase == PhaseDone {
+		if _, blocked := firstBlockedAction(cp.ActionLogs); !blocked {
+			return StepResult{}, fmt.Errorf("run %s already completed", cp.RunID)
+		}
+		cp.Phase = PhaseAct
+	}
+	startedAt, err := time.Parse(time.RFC3339, cp.StartedAt)
+	if err != nil {
+		startedAt = time.Now()
+	}
+	r.todos = todo.Restore(cp.Todos)
+	r.usage = newUsageLog(cp.LLMCalls, cp.Transcript)
+	r.emitProgress("resume", fmt.Sprintf("从检查点恢复运行: %s", cp.RunID), len(cp.Plan.Steps), countCompleted(r.todos.All()))
+	return r.runFrom(ctx, &cp, startedAt)
+}
+
+func (r *Runner) runFrom(ctx context.Context, cp *Checkpoint, startedAt time.Time) (StepResult, error) {
+	r.startBudget()
+	// 预算在 read/plan 阶段耗尽时，检查点停留在该阶段，提高预算后可以 --resume 继续
+	resumePhase := PhaseDone
+	if cp.Phase == PhaseRead {
+		r.emitProgress("read", "分析用户请求", 0, 0)
+		readSummary, err := r.ask(ctx, "read", buildReadPrompt(cp.UserInput, r.sessionHistory()))
+		switch {
+		case isBudgetError(err):
+			resumePhase, cp.Phase = PhaseRead, PhaseFinal
+		case err != nil:
+			return StepResult{}, err
+		default:
+			cp.ReadSummary = strings.TrimSpace(readSummary)
+			cp.Phase = PhasePlan
+			_ = r.saveCheckpoint(cp)
+			r.emitProgress("read", "完成需求提炼", 0, 0)
+		}
+	}
+	readSummary := cp.ReadSummary
+
+	if cp.Phase == PhasePlan {
+		r.emitProgress("plan", "生成执行计划", 0, 0)
+		plan, err := r.buildPlan(ctx, readSummary, "")
+		if err == nil {
+			plan, err = r.reviewPlan(ctx, cp, plan)
+		}
+		switch {
+		case isBudgetError(err):
+			resumePhase, cp.Phase = PhasePlan, PhaseFinal
+		case err != nil:
+			return StepResult{}, err
+		default:
+			cp.Plan = plan
+			for _, step := range plan.Steps {
+				r.todos.Upsert(step.Title, todo.StatusTodo)
+			}
+			cp.Phase = PhaseAct
+			_ = r.saveCheckpoint(cp)
+			r.emitProgress("plan", "计划生成完成", 0, 0)
+			r.emitProgress("todo", "初始化待办项", len(plan.Steps), countCompleted(r.todos.All()))
+		}
+	}
+
+	if cp.Phase == PhaseAct {
+		for {
+			actionLogs, err := r.executePlan(ctx, cp)
+			if err != nil {
+				return StepResult{}, err
+			}
+			cp.ActionLogs = actionLogs
+			blocked, ok := firstBlockedAction(actionLogs)
+			if !ok || len(cp.Replans) >= r.opts.MaxReplans || r.budgetExceeded() != nil {
+				break
+			}
+			if !r.replan(ctx, cp, blocked) {
+				break
+			}
+			_ = r.saveCheckpoint(cp)
+		}
+		cp.Phase = PhaseFinal
+		_ = r.saveCheckpoint(cp)
+	}
+	plan := cp.Plan
+	actionLogs := cp.ActionLogs
 
-	r.emitProgress("plan", "生成执行计划", 0, 0)
+	actionText := renderActionLogs(actionLogs)
+	r.emitProgress("final", "生成最终答复", len(plan.Steps), countCompleted(r.todos.All()))
+	final := ""
+	if be := r.budgetExceeded(); be != nil {
+		final = buildBudgetFinal(plan.Goal, be, actionLogs)
+	} else if blocked, ok := firstBlockedAction(actionLogs); ok {
+		final = buildBlockedFinal(plan.Goal, blocked)
+	} else {
+		finalPrompt := fmt.Sprintf("基于以下执行记录，输出最终答复（先结论后细节，中文，简洁）。\n\n计划目标：%s\n\n%s", plan.Goal, actionText)
+		generated, ferr := r.ask(ctx, "final", finalPrompt)
+		switch {
+		case isBudgetError(ferr):
+			final = buildBudgetFinal(plan.Goal, r.budgetExceeded(), actionLogs)
+		case ferr != nil:
+			return StepResult{}, ferr
+		default:
+			final = generated
+		}
+	}
+	cp.Phase = resumePhase
+	if _, blocked := firstBlockedAction(actionLogs); resumePhase == PhaseDone && !blocked && r.budgetExceeded() == nil {
+		r.removeCheckpoint(cp.RunID)
+	} else {
+		_ = r.saveCheckpoint(cp)
+	}
+
+	auditPath, auditErr := r.saveRunAudit(cp, startedAt, strings.TrimSpace(final))
+	if auditErr != nil {
+		auditPath = ""
+	}
+
+	res := StepResult{
+		RunID:       cp.RunID,
+		ReadSummary: readSummary,
+		Plan:        plan,
+		ActionLogs:  actionLogs,
+		Replans:     cp.Replans,
+		Final:       strings.TrimSpace(final),
+		AuditPath:   auditPath,
+		ParentRunID: cp.ParentRunID,
+		Usage:       summarizeUsage(r.usage.all(), r.opts.Currency),
+		Budget:      r.budgetExceeded(),
+	}
+	_ = r.recordSessionTurn(cp, res)
+	return res, nil
+}
+
+func (r *Runner) buildPlan(ctx context.Context, readSummary, feedback string) (Plan, error) {
 	planPrompt := fmt.Sprintf(`你是plan阶段。基于read摘要输出严格JSON，不要输出其它文字。
 JSON Schema:
 {
@@ -52,212 +220,238 @@ JSON Schema:
       "title": "string",
       "reason": "string",
       "risk": "low|medium|high",
-      "requires_approval": true|false
+      "requires_approval": true|false,
+      "depends_on": ["s1"],
+      "acceptance": [
+        {"type": "file_exists", "path": "string"},
+        {"type": "file_contains", "path": "string", "pattern": "regex"},
+        {"type": "command_exit", "command": "string", "exit_code": 0},
+        {"type": "json_path_equals", "path": "string", "json_path": "$.a.b", "value": "any"}
+      ]
     }
   ]
 }
-要求：steps 3-7条，按执行顺序。
-read摘要：%s`, readSummary)
-	planRaw, err := r.llm.Ask(ctx, planPrompt)
-	if err != nil {
-		return StepResult{}, err
+要求：steps %d-%d条，按执行顺序。depends_on 列出必须先完成的步骤id，互不依赖的步骤可并行执行。
+acceptance 可选，只写能在本地自动校验的验收条件，没有把握时留空。
+read摘要：%s`, r.opts.PlanMinSteps, r.opts.PlanMaxSteps, readSummary)
+	if strings.TrimSpace(feedback) != "" {
+		planPrompt = fmt.Sprintf("%s\n\n%s", planPrompt, feedback)
 	}
-	plan := parsePlan(planRaw)
-	if fixed, ok := normalizePlan(plan); ok {
-		plan = fixed
-	} else {
-		repairPrompt := fmt.Sprintf(`你是plan修复阶段。将下面内容修复为严格JSON，不要输出其它文字。
-Schema:
-{"goal":"string","steps":[{"id":"s1","title":"string","reason":"string","risk":"low|medium|high","requires_approval":true}]}
-原始内容：
-%s`, planRaw)
-		repairedRaw, rerr := r.llm.Ask(ctx, repairPrompt)
-		if rerr == nil {
-			repaired := parsePlan(repairedRaw)
-			if fixed2, ok2 := normalizePlan(repaired); ok2 {
-				plan = fixed2
-			}
-		}
-	}
-	if _, ok := normalizePlan(plan); !ok {
-		return StepResult{}, fmt.Errorf("invalid plan: unable to normalize plan output")
-	}
-	r.emitProgress("plan", "计划生成完成", 0, 0)
-
-	for _, step := range plan.Steps {
-		r.todos.Upsert(step.Title, todo.StatusTodo)
+	planRaw, err := r.ask(ctx, "plan", planPrompt)
+	if err != nil {
+		return Plan{}, err
 	}
-	r.emitProgress("todo", "初始化待办项", len(plan.Steps), countCompleted(r.todos.All()))
+	raw := planRaw
+	plan, errs := r.validatePlanOutput(raw)
+	for round := 1; len(errs) > 0 && round <= r.opts.PlanRepairRounds; round++ {
+		r.emitProgress("plan", fmt.Sprintf("计划未通过校验，第 %d 次修复（%d 个错误）", round, len(errs)), 0, 0)
+		repairPrompt := fmt.Sprintf(`你是plan修复阶段。下面的计划未通过JSON Schema校验，请按错误逐条修正，只输出符合Schema的严格JSON，不要输出其它文字。
+JSON Schema:
+%s
 
-	requestedFiles := detectRequestedFiles(userInput)
+校验错误：
+- %s
 
-	actionLogs := make([]ActionStepLog, 0, len(plan.Steps))
-	for i, step := range plan.Steps {
-		if strings.TrimSpace(step.ID) == "" {
-			step.ID = fmt.Sprintf("s%d", i+1)
+原始内容：
+%s`, r.planSchemaText(), strings.Join(errs, "\n- "), raw)
+		repairedRaw, rerr := r.askAttempt(ctx, "repair", round, repairPrompt)
+		if isBudgetError(rerr) {
+			return Plan{}, rerr
 		}
-		if strings.TrimSpace(step.Title) == "" {
-			continue
+		if rerr != nil {
+			break
 		}
-
-		if isIntentConfirmationStep(step) {
-			r.todos.Upsert(step.Title, todo.StatusDone)
-			r.emitProgress("act", fmt.Sprintf("步骤完成: %s", step.Title), len(plan.Steps), countCompleted(r.todos.All()))
-			actionLogs = append(actionLogs, ActionStepLog{
-				StepID:         step.ID,
-				Title:          step.Title,
-				Status:         string(todo.StatusDone),
-				Attempts:       1,
-				Output:         fmt.Sprintf("已基于read阶段完成用户意图确认：%s", strings.TrimSpace(readSummary)),
-				ToolCalls:      0,
-				WriteToolCalls: 0,
-			})
-			continue
+		raw = repairedRaw
+		plan, errs = r.validatePlanOutput(raw)
+	}
+	if len(errs) > 0 {
+		if r.opts.PlanBulletFallback {
+			if fixed, ok := normalizePlan(parsePlan(planRaw)); ok {
+				r.emitProgress("plan", "计划未通过校验，按列表格式兜底解析", 0, 0)
+				return fixed, nil
+			}
 		}
+		return Plan{}, fmt.Errorf("invalid plan: %s", strings.Join(errs, "; "))
+	}
+	return plan, nil
+}
 
-		if isLocalProbeStep(step) {
-			r.todos.Upsert(step.Title, todo.StatusDone)
-			r.emitProgress("act", fmt.Sprintf("步骤完成: %s", step.Title), len(plan.Steps), countCompleted(r.todos.All()))
-			actionLogs = append(actionLogs, ActionStepLog{
-				StepID:         step.ID,
-				Title:          step.Title,
-				Status:         string(todo.StatusDone),
-				Attempts:       1,
-				Output:         r.buildLocalProbeOutput(step, requestedFiles),
-				ToolCalls:      0,
-				WriteToolCalls: 0,
-			})
-			continue
-		}
+type stepEnv struct {
+	runID          string
+	readSummary    string
+	requestedFiles []string
+	total          int
+}
 
-		if (strings.EqualFold(step.Risk, "high") || step.RequiresApproval) && r.opts.Approver != nil {
-			approved, aerr := r.opts.Approver(ctx, step)
-			if aerr != nil {
-				return StepResult{}, aerr
+func (r *Runner) executeStep(ctx context.Context, step PlanStep, env stepEnv) (ActionStepLog, error) {
+	requestedFiles, total := env.requestedFiles, env.total
+	if isIntentConfirmationStep(step) {
+		r.todos.Upsert(step.Title, todo.StatusDone)
+		r.emitProgress("act", fmt.Sprintf("步骤完成: %s", step.Title), total, countCompleted(r.todos.All()))
+		return ActionStepLog{
+			StepID:         step.ID,
+			Title:          step.Title,
+			Status:         string(todo.StatusDone),
+			Attempts:       1,
+			Output:         fmt.Sprintf("已基于read阶段完成用户意图确认：%s", strings.TrimSpace(env.readSummary)),
+			ToolCalls:      0,
+			WriteToolCalls: 0,
+		}, nil
+	}
+
+	if isLocalProbeStep(step) {
+		r.todos.Upsert(step.Title, todo.StatusDone)
+		r.emitProgress("act", fmt.Sprintf("步骤完成: %s", step.Title), total, countCompleted(r.todos.All()))
+		return ActionStepLog{
+			StepID:         step.ID,
+			Title:          step.Title,
+			Status:         string(todo.StatusDone),
+			Attempts:       1,
+			Output:         r.buildLocalProbeOutput(step, requestedFiles),
+			ToolCalls:      0,
+			WriteToolCalls: 0,
+		}, nil
+	}
+
+	decision, err := r.decide(ctx, step, requestedFiles)
+	if err != nil {
+		return ActionStepLog{}, err
+	}
+	if !decision.Approved {
+		r.todos.Upsert(step.Title, todo.StatusSkipped)
+		if decision.Action == PolicyDeny {
+			r.emitProgress("act", fmt.Sprintf("策略拒绝执行（规则 %s）: %s", decision.Rule, step.Title), total, countCompleted(r.todos.All()))
+		}
+		return ActionStepLog{StepID: step.ID, Title: step.Title, Status: string(todo.StatusSkipped), Attempts: 0, ApprovalDenied: true, Policy: &decision}, nil
+	}
+
+	snapshot := r.snapshotStep(ctx, env.runID, step.ID, fmt.Sprintf("gopi-pro %s before %s: %s", env.runID, step.ID, step.Title))
+	r.todos.Upsert(step.Title, todo.StatusInProgress)
+	r.emitProgress("act", fmt.Sprintf("执行步骤: %s", step.Title), total, countCompleted(r.todos.All()))
+	var success bool
+	var lastErr error
+	var out string
+	lastToolCalls := -1
+	lastWriteToolCalls := -1
+	attempts := 0
+	stepWriteIntent := isStrictWriteFileStep(step, requestedFiles)
+	stepExpectedFiles := expectedFilesForStep(step, requestedFiles)
+	var acceptance []AcceptanceResult
+	acceptanceFailures := ""
+	var changes []fschange.Change
+	tracker := r.newChangeTracker()
+	defer tracker.close()
+	gate := r.acceptanceCommandGate(step)
+
+	for attempt := 1; attempt <= r.opts.MaxActRetries; attempt++ {
+		attempts = attempt
+		actPrompt := fmt.Sprintf("你是act阶段。只执行当前一步并简洁汇报结果。\n当前步骤：%s\n步骤原因：%s\n步骤风险：%s\n完整todo：\n%s", step.Title, step.Reason, step.Risk, r.todos.Render())
+		if stepWriteIntent {
+			if len(stepExpectedFiles) > 0 {
+				actPrompt = fmt.Sprintf("%s\n\n强约束：这是写文件步骤，必须通过真实工具调用完成文件写入，严禁仅口头描述完成。目标文件：%s。若无法写入请明确失败原因。", actPrompt, strings.Join(stepExpectedFiles, ", "))
+			} else {
+				actPrompt = fmt.Sprintf("%s\n\n强约束：这是写文件步骤，必须通过真实工具调用完成文件写入，严禁仅口头描述完成。若无法写入请明确失败原因。", actPrompt)
 			}
-			if !approved {
-				r.todos.Upsert(step.Title, todo.StatusSkipped)
-				actionLogs = append(actionLogs, ActionStepLog{StepID: step.ID, Title: step.Title, Status: string(todo.StatusSkipped), Attempts: 0})
-				continue
+			if attempt > 1 && lastErr != nil {
+				actPrompt = fmt.Sprintf("%s\n上次失败原因：%s\n本次必须先完成 write_file 工具调用，再输出结果。", actPrompt, strings.TrimSpace(lastErr.Error()))
 			}
 		}
-
-		r.todos.Upsert(step.Title, todo.StatusInProgress)
-		r.emitProgress("act", fmt.Sprintf("执行步骤: %s", step.Title), len(plan.Steps), countCompleted(r.todos.All()))
-		var success bool
-		var lastErr error
-		var out string
-		lastToolCalls := -1
-		lastWriteToolCalls := -1
-		attempts := 0
-		stepWriteIntent := isStrictWriteFileStep(step, requestedFiles)
-		stepExpectedFiles := expectedFilesForStep(step, requestedFiles)
-
-		for attempt := 1; attempt <= r.opts.MaxActRetries; attempt++ {
-			attempts = attempt
-			actPrompt := fmt.Sprintf("你是act阶段。只执行当前一步并简洁汇报结果。\n当前步骤：%s\n步骤原因：%s\n步骤风险：%s\n完整todo：\n%s", step.Title, step.Reason, step.Risk, r.todos.Render())
-			if stepWriteIntent {
-				if len(stepExpectedFiles) > 0 {
-					actPrompt = fmt.Sprintf("%s\n\n强约束：这是写文件步骤，必须通过真实工具调用完成文件写入，严禁仅口头描述完成。目标文件：%s。若无法写入请明确失败原因。", actPrompt, strings.Join(stepExpectedFiles, ", "))
-				} else {
-					actPrompt = fmt.Sprintf("%s\n\n强约束：这是写文件步骤，必须通过真实工具调用完成文件写入，严禁仅口头描述完成。若无法写入请明确失败原因。", actPrompt)
-				}
-				if attempt > 1 && lastErr != nil {
-					actPrompt = fmt.Sprintf("%s\n上次失败原因：%s\n本次必须先完成 write_file 工具调用，再输出结果。", actPrompt, strings.TrimSpace(lastErr.Error()))
-				}
+		if len(step.Acceptance) > 0 {
+			actPrompt = fmt.Sprintf("%s\n\n验收标准（执行后将在本地自动校验）：\n%s", actPrompt, renderAcceptanceCriteria(step.Acceptance))
+			if acceptanceFailures != "" {
+				actPrompt = fmt.Sprintf("%s\n上次验收未通过：\n%s\n本次必须修正以上问题。", actPrompt, acceptanceFailures)
 			}
-			resp, toolCalls, writeToolCalls, askErr := askWithStats(ctx, r.llm, actPrompt)
-			if askErr != nil {
-				lastErr = askErr
-				continue
-			}
-			lastToolCalls = toolCalls
-			lastWriteToolCalls = writeToolCalls
-			out = strings.TrimSpace(resp)
-			if stepWriteIntent && len(stepExpectedFiles) > 0 {
-				missing := findMissingFiles(stepExpectedFiles, r.resolveWorkingDir())
-				if len(missing) > 0 {
-					lastErr = fmt.Errorf("%s", buildWriteFailureReason(missing, toolCalls, writeToolCalls))
-					continue
-				}
-			}
-			success = true
-			break
 		}
-
-		if success {
-			r.todos.Upsert(step.Title, todo.StatusDone)
-			r.emitProgress("act", fmt.Sprintf("步骤完成: %s", step.Title), len(plan.Steps), countCompleted(r.todos.All()))
-			actionLogs = append(actionLogs, ActionStepLog{StepID: step.ID, Title: step.Title, Status: string(todo.StatusDone), Attempts: attempts, Output: out, ToolCalls: normalizeStat(lastToolCalls), WriteToolCalls: normalizeStat(lastWriteToolCalls)})
+		acceptanceFailures = ""
+		resp, toolCalls, writeToolCalls, askErr := r.askStats(ctx, "act", step.ID, attempt, actPrompt)
+		changes = append(changes, tracker.observe(attempt)...)
+		if askErr != nil {
+			lastErr = askErr
+			if isBudgetError(askErr) {
+				break
+			}
 			continue
 		}
-
-		r.todos.Upsert(step.Title, todo.StatusBlocked)
-		r.emitProgress("act", fmt.Sprintf("步骤阻塞: %s", step.Title), len(plan.Steps), countCompleted(r.todos.All()))
-		errText := "act failed"
-		if lastErr != nil {
-			errText = lastErr.Error()
-		}
-		actionLogs = append(actionLogs, ActionStepLog{StepID: step.ID, Title: step.Title, Status: string(todo.StatusBlocked), Attempts: attempts, ErrorText: errText, ToolCalls: normalizeStat(lastToolCalls), WriteToolCalls: normalizeStat(lastWriteToolCalls)})
-
-		for j := i + 1; j < len(plan.Steps); j++ {
-			next := plan.Steps[j]
-			if strings.TrimSpace(next.ID) == "" {
-				next.ID = fmt.Sprintf("s%d", j+1)
+		lastToolCalls = toolCalls
+		lastWriteToolCalls = writeToolCalls
+		out = strings.TrimSpace(resp)
+		if stepWriteIntent && len(stepExpectedFiles) > 0 {
+			missing := findMissingFiles(stepExpectedFiles, r.resolveWorkingDir())
+			if len(missing) > 0 {
+				lastErr = fmt.Errorf("%s", buildWriteFailureReason(missing, toolCalls, writeToolCalls))
+				continue
 			}
-			if strings.TrimSpace(next.Title) == "" {
+		}
+		if len(step.Acceptance) > 0 {
+			r.emitProgress("verify", fmt.Sprintf("校验验收标准: %s", step.Title), total, countCompleted(r.todos.All()))
+			acceptance = verifyAcceptance(ctx, step.Acceptance, r.resolveWorkingDir(), gate)
+			if failed := failedAcceptance(acceptance); len(failed) > 0 {
+				acceptanceFailures = renderAcceptanceFailures(failed)
+				lastErr = fmt.Errorf("验收未通过：\n%s", acceptanceFailures)
+				if deniedAcceptance(acceptance) {
+					break
+				}
 				continue
 			}
-			r.todos.Upsert(next.Title, todo.StatusSkipped)
-			actionLogs = append(actionLogs, ActionStepLog{
-				StepID:    next.ID,
-				Title:     next.Title,
-				Status:    string(todo.StatusSkipped),
-				Attempts:  0,
-				ErrorText: fmt.Sprintf("前置步骤失败，已跳过：%s", step.Title),
-			})
 		}
+		success = true
 		break
 	}
 
-	actionText := renderActionLogs(actionLogs)
-	r.emitProgress("final", "生成最终答复", len(plan.Steps), countCompleted(r.todos.All()))
-	final := ""
-	if blocked, ok := firstBlockedAction(actionLogs); ok {
-		final = buildBlockedFinal(plan.Goal, blocked)
-	} else {
-		finalPrompt := fmt.Sprintf("基于以下执行记录，输出最终答复（先结论后细节，中文，简洁）。\n\n计划目标：%s\n\n%s", plan.Goal, actionText)
-		generated, ferr := r.llm.Ask(ctx, finalPrompt)
-		if ferr != nil {
-			return StepResult{}, ferr
-		}
-		final = generated
+	if success {
+		r.todos.Upsert(step.Title, todo.StatusDone)
+		r.emitProgress("act", fmt.Sprintf("步骤完成: %s", step.Title), total, countCompleted(r.todos.All()))
+		return ActionStepLog{StepID: step.ID, Title: step.Title, Status: string(todo.StatusDone), Attempts: attempts, Output: out, ToolCalls: normalizeStat(lastToolCalls), WriteToolCalls: normalizeStat(lastWriteToolCalls), Acceptance: acceptance, Snapshot: snapshot, Changes: changes, ChangesUnattributed: tracker.unattributed, Policy: &decision}, nil
 	}
 
-	auditPath, auditErr := r.saveRunAudit(startedAt, userInput, strings.TrimSpace(readSummary), plan, actionLogs, strings.TrimSpace(final))
-	if auditErr != nil {
-		auditPath = ""
+	r.todos.Upsert(step.Title, todo.StatusBlocked)
+	r.emitProgress("act", fmt.Sprintf("步骤阻塞: %s", step.Title), total, countCompleted(r.todos.All()))
+	errText := "act failed"
+	if lastErr != nil {
+		errText = lastErr.Error()
 	}
+	rolledBack, rbErr := r.rollbackBlockedStep(ctx, env.runID, step, snapshot)
+	if rbErr != nil {
+		errText = fmt.Sprintf("%s；回滚失败：%v", errText, rbErr)
+	}
+	return ActionStepLog{StepID: step.ID, Title: step.Title, Status: string(todo.StatusBlocked), Attempts: attempts, ErrorText: errText, ToolCalls: normalizeStat(lastToolCalls), WriteToolCalls: normalizeStat(lastWriteToolCalls), Acceptance: acceptance, Snapshot: snapshot, RolledBack: rolledBack, Changes: changes, ChangesUnattributed: tracker.unattributed, Policy: &decision}, nil
+}
 
-	return StepResult{
-		ReadSummary: strings.TrimSpace(readSummary),
-		Plan:        plan,
-		ActionLogs:  actionLogs,
-		Final:       strings.TrimSpace(final),
-		AuditPath:   auditPath,
-	}, nil
+// decide 按策略决定步骤能否执行，需要询问时调用审批人（未设置审批人时视为批准）。
+func (r *Runner) decide(ctx context.Context, step PlanStep, requestedFiles []string) (PolicyDecision, error) {
+	decision := r.opts.Policy.Evaluate(PolicyInput{Step: step, Files: policyFiles(step, requestedFiles), WorkingDir: r.resolveWorkingDir()})
+	switch decision.Action {
+	case PolicyAllow:
+		decision.Approved = true
+	case PolicyAsk:
+		decision.Approved = true
+		if r.opts.Approver != nil {
+			r.approvalMu.Lock()
+			approved, err := r.opts.Approver(ctx, step)
+			r.approvalMu.Unlock()
+			if err != nil {
+				return decision, err
+			}
+			decision.Asked = true
+			decision.Approved = approved
+		}
+	}
+	return decision, nil
 }
 
 func (r *Runner) emitProgress(phase, message string, total, completed int) {
 	if r.opts.OnProgress == nil {
 		return
 	}
+	r.progressMu.Lock()
+	defer r.progressMu.Unlock()
 	r.opts.OnProgress(ProgressEvent{
 		Phase:     phase,
 		Message:   message,
 		Total:     total,
 		Completed: completed,
 		TodoText:  r.TodosText(),
+		Todos:     r.todos.All(),
 	})
 }
 
@@ -265,13 +459,17 @@ func (r *Runner) TodosText() string {
 	return r.todos.Render()
 }
 
-func buildReadPrompt(userInput string) string {
-	return fmt.Sprintf(`你是read阶段。提炼用户请求要点，不执行任何操作。
+func buildReadPrompt(userInput, history string) string {
+	prompt := `你是read阶段。提炼用户请求要点，不执行任何操作。
 你可以访问当前会话历史。
 如果用户在问“我刚才问过什么/之前问过什么/历史问题”，必须先基于会话历史中的用户消息进行归纳回答；
 只有当历史里确实没有可用的更早用户消息时，才可以说明无法回忆。
 输出要求：只输出提炼后的结论，不要输出工具调用或多余前后缀。
-用户请求：%s`, userInput)
+`
+	if strings.TrimSpace(history) != "" {
+		prompt += fmt.Sprintf("本会话此前各轮记录（由 gopi-pro 保存，可作为会话历史使用）：\n%s\n", history)
+	}
+	return prompt + "用户请求：" + userInput
 }
 
 func parsePlan(raw string) Plan {
@@ -471,16 +669,48 @@ func normalizePlan(p Plan) (Plan, bool) {
 		if s.Reason == "" {
 			s.Reason = "根据规划执行"
 		}
+		s.DependsOn = normalizeDependsOn(s.DependsOn)
+		acceptance, err := normalizeAcceptance(s.Acceptance)
+		if err != nil {
+			return Plan{}, false
+		}
+		s.Acceptance = acceptance
 		normalized = append(normalized, s)
 	}
 
 	if len(normalized) == 0 {
 		return Plan{}, false
 	}
+	if err := validateDependencies(normalized); err != nil {
+		return Plan{}, false
+	}
 	p.Steps = normalized
 	return p, true
 }
 
+func normalizeDependsOn(deps []string) []string {
+	if len(deps) == 0 {
+		return nil
+	}
+	seen := make(map[string]struct{}, len(deps))
+	out := make([]string, 0, len(deps))
+	for _, d := range deps {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+		if _, ok := seen[d]; ok {
+			continue
+		}
+		seen[d] = struct{}{}
+		out = append(out, d)
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
 func stripCodeFence(s string) string {
 	s = strings.TrimSpace(s)
 	if !strings.HasPrefix(s, "```") {
@@ -513,6 +743,12 @@ func renderActionLogs(logs []ActionStepLog) string {
 		if l.ToolCalls > 0 || l.WriteToolCalls > 0 {
 			_, _ = fmt.Fprintf(&b, "\n  tool_calls: %d (write_file=%d)", l.ToolCalls, l.WriteToolCalls)
 		}
+		if len(l.Changes) > 0 {
+			_, _ = fmt.Fprintf(&b, "\n  changes: %s", fschange.Summary(l.Changes))
+		}
+		if len(l.Acceptance) > 0 {
+			_, _ = fmt.Fprintf(&b, "\n  acceptance: %d/%d passed", len(l.Acceptance)-len(failedAcceptance(l.Acceptance)), len(l.Acceptance))
+		}
 		if strings.TrimSpace(l.Output) != "" {
 			_, _ = fmt.Fprintf(&b, "\n  output: %s", strings.TrimSpace(l.Output))
 		}
@@ -632,48 +868,54 @@ func isLocalProbeStep(step PlanStep) bool {
 	return false
 }
 
-type runAudit struct {
-	StartedAt   string          `json:"started_at"`
-	FinishedAt  string          `json:"finished_at"`
-	DurationMs  int64           `json:"duration_ms"`
-	UserInput   string          `json:"user_input"`
-	ReadSummary string          `json:"read_summary"`
-	Plan        Plan            `json:"plan"`
-	ActionLogs  []ActionStepLog `json:"action_logs"`
-	Final       string          `json:"final"`
-	Todos       string          `json:"todos"`
-}
-
-func (r *Runner) saveRunAudit(startedAt time.Time, userInput, readSummary string, plan Plan, logs []ActionStepLog, final string) (string, error) {
-	base := strings.TrimSpace(r.opts.AuditDir)
-	if base == "" {
-		base = filepath.Join(".gopi-pro", "runs")
-	}
-	if err := os.MkdirAll(base, 0o755); err != nil {
-		return "", err
-	}
-
-	fileName := fmt.Sprintf("run-%s.json", startedAt.Format("20060102-150405"))
-	path := filepath.Join(base, fileName)
+func (r *Runner) saveRunAudit(cp *Checkpoint, startedAt time.Time, final string) (string, error) {
+	path := AuditPath(r.opts.AuditDir, cp.RunID)
 	finishedAt := time.Now()
-	payload := runAudit{
+	calls := r.usage.all()
+	budget := r.budgetExceeded()
+	workingDir, _ := filepath.Abs(r.resolveWorkingDir())
+	payload := audit.Run{
+		RunID:       cp.RunID,
 		StartedAt:   startedAt.Format(time.RFC3339),
 		FinishedAt:  finishedAt.Format(time.RFC3339),
 		DurationMs:  finishedAt.Sub(startedAt).Milliseconds(),
-		UserInput:   userInput,
-		ReadSummary: readSummary,
-		Plan:        plan,
-		ActionLogs:  logs,
+		Outcome:     StepResult{ActionLogs: cp.ActionLogs, Budget: budget}.Outcome(),
+		WorkingDir:  workingDir,
+		UserInput:   cp.UserInput,
+		ReadSummary: cp.ReadSummary,
+		Plan:        cp.Plan,
+		PlanSource:  cp.PlanSource,
+		ActionLogs:  cp.ActionLogs,
+		Replans:     cp.Replans,
 		Final:       final,
 		Todos:       r.TodosText(),
+		ParentRunID: cp.ParentRunID,
+		ForkedAt:    cp.ForkedAt,
+		Usage:       summarizeUsage(calls, r.opts.Currency),
+		LLMCalls:    calls,
+		Budget:      budget,
+		PlanReviews: cp.PlanReviews,
+		Transcript:  r.usage.transcript(),
 	}
-	b, err := json.MarshalIndent(payload, "", "  ")
-	if err != nil {
-		return "", err
+	if r.opts.Redactor != nil {
+		var err error
+		if payload, err = r.redactAudit(payload); err != nil {
+			return "", err
+		}
+	}
+	if r.opts.Transcript == TranscriptFile && len(payload.Transcript) > 0 {
+		file := audit.TranscriptPath(path)
+		if err := audit.SaveTranscript(file, payload.Transcript); err != nil {
+			return "", err
+		}
+		payload.TranscriptFile = filepath.Base(file)
+		payload.Transcript = nil
 	}
-	if err := os.WriteFile(path, b, 0o644); err != nil {
+	if err := audit.Save(path, payload); err != nil {
 		return "", err
 	}
+	// 索引只是缓存，写入失败时 audit list 会在下次读取时从审计文件重建
+	_ = audit.IndexRun(path, payload)
 	return path, nil
 }
 
@@ -696,6 +938,21 @@ func parseBullets(s string) []string {
 	return out
 }
 
+func (s StepResult) Outcome() string {
+	if s.Budget != nil {
+		return OutcomeBlocked
+	}
+	if _, ok := firstBlockedAction(s.ActionLogs); ok {
+		return OutcomeBlocked
+	}
+	for _, l := range s.ActionLogs {
+		if l.ApprovalDenied {
+			return OutcomeApprovalDenied
+		}
+	}
+	return OutcomeDone
+}
+
 func firstBlockedAction(logs []ActionStepLog) (ActionStepLog, bool) {
 	for _, l := range logs {
 		if strings.EqualFold(strings.TrimSpace(l.Status), string(todo.StatusBlocked)) {
@@ -66,7 +66,7 @@ func TestNormalizePlan(t *testing.T) {
 }
 
 func TestBuildReadPromptIncludesHistoryInstruction(t *testing.T) {
-	p := buildReadPrompt("我刚才问过你哪些问题")
+	p := buildReadPrompt("我刚才问过你哪些问题", "")
 	if !strings.Contains(p, "你可以访问当前会话历史") {
 		t.Fatalf("missing history instruction: %s", p)
 	}
@@ -220,6 +220,21 @@ func TestFirstBlockedAction(t *testing.T) {
 	}
 }
 
+func TestStepResultOutcome(t *testing.T) {
+	done := StepResult{ActionLogs: []ActionStepLog{{Status: string(todo.StatusDone)}}}
+	if done.Outcome() != OutcomeDone {
+		t.Fatalf("expected done, got %s", done.Outcome())
+	}
+	denied := StepResult{ActionLogs: []ActionStepLog{{Status: string(todo.StatusSkipped), ApprovalDenied: true}}}
+	if denied.Outcome() != OutcomeApprovalDenied {
+		t.Fatalf("expected approval_denied, got %s", denied.Outcome())
+	}
+	denied.ActionLogs = append(denied.ActionLogs, ActionStepLog{Status: string(todo.StatusBlocked)})
+	if denied.Outcome() != OutcomeBlocked {
+		t.Fatalf("blocked should win over approval_denied, got %s", denied.Outcome())
+	}
+}
+
 func TestBuildBlockedFinal(t *testing.T) {
 	text := buildBlockedFinal("写入文件", ActionStepLog{Title: "将代码写入 sort.py 文件", ErrorText: "未观测到 write_file"})
 	if !strings.Contains(text, "任务未完成") || !strings.Contains(text, "将代码写入 sort.py 文件") {
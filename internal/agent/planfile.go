@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yangruihan/go-pi-pro/internal/todo"
+	"gopkg.in/yaml.v3"
+)
+
+// PlanSourceUser 标记由调用方直接提供（而非 LLM 生成）的计划。
+const PlanSourceUser = "user"
+
+func LoadPlan(file string) (Plan, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return Plan{}, err
+	}
+	format := "yaml"
+	if strings.EqualFold(filepath.Ext(file), ".json") {
+		format = "json"
+	}
+	p, err := ParsePlan(b, format)
+	if err != nil {
+		return Plan{}, fmt.Errorf("plan %s: %w", file, err)
+	}
+	return p, nil
+}
+
+// ParsePlan 解析并校验计划文件。YAML 先转换为 JSON，使字段名与 LLM 输出的计划保持一致（depends_on、requires_approval 等）。
+func ParsePlan(data []byte, format string) (Plan, error) {
+	switch format {
+	case "json":
+	case "yaml", "yml":
+		var doc any
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return Plan{}, err
+		}
+		b, err := json.Marshal(doc)
+		if err != nil {
+			return Plan{}, err
+		}
+		data = b
+	default:
+		return Plan{}, fmt.Errorf("unsupported plan format %q", format)
+	}
+	var p Plan
+	if err := json.Unmarshal(data, &p); err != nil {
+		return Plan{}, err
+	}
+	return validatePlan(p)
+}
+
+// validatePlan 在 normalizePlan 之前给出具体的错误原因，便于修正手写的计划文件。
+func validatePlan(p Plan) (Plan, error) {
+	if len(p.Steps) == 0 {
+		return Plan{}, fmt.Errorf("plan has no steps")
+	}
+	ids := make(map[string]int, len(p.Steps))
+	for i, s := range p.Steps {
+		if strings.TrimSpace(s.Title) == "" {
+			return Plan{}, fmt.Errorf("step %d: title is required", i+1)
+		}
+		if _, err := normalizeAcceptance(s.Acceptance); err != nil {
+			return Plan{}, fmt.Errorf("step %d: %w", i+1, err)
+		}
+		id := strings.TrimSpace(s.ID)
+		if id == "" {
+			continue
+		}
+		if j, ok := ids[id]; ok {
+			return Plan{}, fmt.Errorf("step %d: duplicate id %q (also used by step %d)", i+1, id, j+1)
+		}
+		ids[id] = i
+	}
+	// 缺省 id 由 normalizePlan 按位置生成为 s<序号>，不能与其它步骤显式写出的 id 相同，否则依赖会挂到错误的步骤上
+	for i, s := range p.Steps {
+		if strings.TrimSpace(s.ID) != "" {
+			continue
+		}
+		if j, ok := ids[fmt.Sprintf("s%d", i+1)]; ok {
+			return Plan{}, fmt.Errorf("step %d: generated id %q collides with step %d; give the step an explicit id", i+1, fmt.Sprintf("s%d", i+1), j+1)
+		}
+	}
+	fixed, ok := normalizePlan(p)
+	if !ok {
+		if err := validateDependencies(p.Steps); err != nil {
+			return Plan{}, err
+		}
+		return Plan{}, fmt.Errorf("invalid plan")
+	}
+	return fixed, nil
+}
+
+// RunPlan 跳过 read 与 plan 阶段，直接按给定计划执行 act，沿用重试、文件校验、审批与审计。
+// userInput 为空时使用计划目标。
+func (r *Runner) RunPlan(ctx context.Context, userInput string, plan Plan) (StepResult, error) {
+	plan, err := validatePlan(plan)
+	if err != nil {
+		return StepResult{}, err
+	}
+	if strings.TrimSpace(userInput) == "" {
+		userInput = plan.Goal
+	}
+	startedAt := time.Now()
+	r.todos = todo.New()
+	r.usage = newUsageLog(nil, nil)
+	for _, step := range plan.Steps {
+		r.todos.Upsert(step.Title, todo.StatusTodo)
+	}
+	cp := &Checkpoint{
+		RunID:       r.newRunID(startedAt),
+		StartedAt:   startedAt.Format(time.RFC3339),
+		UserInput:   userInput,
+		Phase:       PhaseAct,
+		ReadSummary: fmt.Sprintf("（使用用户提供的计划，跳过 read/plan 阶段）%s", plan.Goal),
+		Plan:        plan,
+		PlanSource:  PlanSourceUser,
+	}
+	_ = r.saveCheckpoint(cp)
+	r.emitProgress("todo", "按用户提供的计划初始化待办项", len(plan.Steps), 0)
+	return r.runFrom(ctx, cp, startedAt)
+}
@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yangruihan/go-pi-pro/internal/audit"
+	"github.com/yangruihan/go-pi-pro/internal/llmtest"
+	"github.com/yangruihan/go-pi-pro/internal/todo"
+)
+
+const runbookYAML = `goal: 发布版本
+steps:
+  - id: build
+    title: 构建产物
+    risk: low
+    acceptance:
+      - type: file_exists
+        path: dist/app
+  - id: publish
+    title: 发布产物
+    risk: high
+    requires_approval: true
+    depends_on: [build]
+`
+
+func TestLoadPlanYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.yaml")
+	if err := os.WriteFile(path, []byte(runbookYAML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadPlan(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(p.Steps) != 2 || !p.Steps[1].RequiresApproval || p.Steps[1].DependsOn[0] != "build" {
+		t.Fatalf("unexpected plan: %#v", p)
+	}
+	if len(p.Steps[0].Acceptance) != 1 || p.Steps[0].Reason == "" {
+		t.Fatalf("plan should be normalized: %#v", p.Steps[0])
+	}
+}
+
+func TestParsePlanErrors(t *testing.T) {
+	cases := map[string]string{
+		`{"steps":[]}`:                                          "no steps",
+		`{"steps":[{"id":"a","title":""}]}`:                     "title is required",
+		`{"steps":[{"id":"a","title":"x","depends_on":["z"]}]}`: "z",
+		`{"steps":[{"id":"a","title":"x"},{"id":" a ","title":"y"},{"id":"b","title":"z","depends_on":["a"]}]}`: "duplicate id \"a\"",
+		`{"steps":[{"title":"x"},{"id":"s1","title":"y"}]}`:                                                     "generated id \"s1\" collides with step 2",
+	}
+	for input, want := range cases {
+		if _, err := ParsePlan([]byte(input), "json"); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: want error containing %q, got %v", input, want, err)
+		}
+	}
+}
+
+func TestRunPlanSkipsReadAndPlan(t *testing.T) {
+	llm := llmtest.New()
+	llm.On(llmtest.PhaseAct).Reply("完成")
+	llm.On(llmtest.PhaseFinal).Reply("全部完成")
+
+	plan, err := ParsePlan([]byte(scenarioPlanJSON), "json")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	res, err := newScenarioRunner(t, llm, RunnerOptions{}).RunPlan(context.Background(), "", plan)
+	if err != nil {
+		t.Fatalf("run plan: %v", err)
+	}
+	if llm.CallCount(llmtest.PhaseRead) != 0 || llm.CallCount(llmtest.PhasePlan) != 0 || llm.CallCount(llmtest.PhaseAct) != 2 {
+		t.Fatalf("unexpected calls: %#v", llm.Calls())
+	}
+	for _, l := range res.ActionLogs {
+		if l.Status != string(todo.StatusDone) {
+			t.Fatalf("step not done: %#v", l)
+		}
+	}
+	rec, err := audit.Load(res.AuditPath)
+	if err != nil {
+		t.Fatalf("load audit: %v", err)
+	}
+	if rec.PlanSource != PlanSourceUser || rec.UserInput != "交付功能" {
+		t.Fatalf("audit should record user plan: source=%q input=%q", rec.PlanSource, rec.UserInput)
+	}
+}
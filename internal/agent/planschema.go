@@ -0,0 +1,88 @@
+package agent
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/yangruihan/go-pi-pro/internal/jsonschema"
+)
+
+const (
+	defaultPlanMinSteps = 3
+	defaultPlanMaxSteps = 7
+)
+
+//go:embed plan.schema.json
+var planSchemaJSON []byte
+
+// planSchema 返回按 Runner 配置的步骤数范围调整后的计划 Schema。
+func (r *Runner) planSchema() jsonschema.Schema {
+	s, err := jsonschema.Parse(planSchemaJSON)
+	if err != nil {
+		panic(fmt.Sprintf("plan.schema.json: %v", err))
+	}
+	steps := s["properties"].(map[string]any)["steps"].(map[string]any)
+	steps["minItems"] = float64(r.opts.PlanMinSteps)
+	steps["maxItems"] = float64(r.opts.PlanMaxSteps)
+	return s
+}
+
+func (r *Runner) planSchemaText() string {
+	b, _ := json.MarshalIndent(r.planSchema(), "", "  ")
+	return string(b)
+}
+
+// validatePlanOutput 按 Schema 严格校验 LLM 的计划输出，并补充 Schema 无法表达的约束（验收条件字段、依赖关系）。
+// 返回的错误带 JSON 路径，会原样写入修复 prompt。
+func (r *Runner) validatePlanOutput(raw string) (Plan, []string) {
+	text := stripCodeFence(strings.TrimSpace(raw))
+	if text == "" {
+		return Plan{}, []string{"$: empty output, expected a JSON object"}
+	}
+	var errs []string
+	for _, e := range r.planSchema().ValidateJSON([]byte(text)) {
+		errs = append(errs, e.Error())
+	}
+	if len(errs) > 0 {
+		return Plan{}, errs
+	}
+	var p Plan
+	if err := json.Unmarshal([]byte(text), &p); err != nil {
+		return Plan{}, []string{fmt.Sprintf("$: %v", err)}
+	}
+	seen := make(map[string]int, len(p.Steps))
+	for i, s := range p.Steps {
+		if j, ok := seen[s.ID]; ok {
+			errs = append(errs, fmt.Sprintf("$.steps[%d].id: duplicate id %q (also used by $.steps[%d])", i, s.ID, j))
+		}
+		seen[s.ID] = i
+		if _, err := normalizeAcceptance(s.Acceptance); err != nil {
+			errs = append(errs, fmt.Sprintf("$.steps[%d].acceptance: %v", i, err))
+		}
+	}
+	if err := validateDependencies(p.Steps); err != nil {
+		errs = append(errs, fmt.Sprintf("$.steps: %v", err))
+	}
+	if len(errs) > 0 {
+		return Plan{}, errs
+	}
+	fixed, ok := normalizePlan(p)
+	if !ok {
+		return Plan{}, []string{"$: plan could not be normalized"}
+	}
+	return fixed, nil
+}
+
+// parseRevisedPlan 解析 replan/fork 阶段的计划输出；只有开启 PlanBulletFallback 时才接受列表格式。
+func (r *Runner) parseRevisedPlan(raw string) Plan {
+	var p Plan
+	if err := json.Unmarshal([]byte(stripCodeFence(strings.TrimSpace(raw))), &p); err == nil {
+		return p
+	}
+	if r.opts.PlanBulletFallback {
+		return parsePlan(raw)
+	}
+	return Plan{}
+}
@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/yangruihan/go-pi-pro/internal/llmtest"
+)
+
+func TestValidatePlanOutputErrors(t *testing.T) {
+	r := NewRunner(llmtest.New(), RunnerOptions{})
+	_, errs := r.validatePlanOutput("```json\n" + `{"goal":"g","steps":[{"id":"s1","title":"a","reason":"r","risk":"extreme"},{"id":"s2","reason":"r","risk":"low","depends_on":["s9"]}]}` + "\n```")
+	joined := strings.Join(errs, "\n")
+	for _, want := range []string{
+		"$.steps: expected at least 3 items, got 2",
+		`$.steps[0].risk: value "extreme" is not one of ["low","medium","high"]`,
+		`$.steps[1]: missing required property "title"`,
+	} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("missing %q in:\n%s", want, joined)
+		}
+	}
+
+	r = NewRunner(llmtest.New(), RunnerOptions{PlanMinSteps: 1})
+	_, errs = r.validatePlanOutput(`{"goal":"g","steps":[{"id":"s1","title":"a","reason":"r","risk":"low","depends_on":["s9"]}]}`)
+	if len(errs) != 1 || !strings.Contains(errs[0], "s9") {
+		t.Fatalf("dependency error expected: %v", errs)
+	}
+}
+
+func TestPlanRepairRoundsReceiveValidationErrors(t *testing.T) {
+	llm := llmtest.New()
+	llm.On(llmtest.PhaseRead).Reply("摘要")
+	llm.On(llmtest.PhasePlan).Reply(`{"goal":"g","steps":[{"id":"s1","title":"a","reason":"r","risk":"extreme"}]}`)
+	llm.On(llmtest.PhaseRepair).Reply("还是不对").Times(1)
+	llm.On(llmtest.PhaseRepair).Reply(scenarioPlanJSON)
+	llm.On(llmtest.PhaseAct).Reply("完成")
+	llm.On(llmtest.PhaseFinal).Reply("全部完成")
+
+	res, err := newScenarioRunner(t, llm, RunnerOptions{PlanRepairRounds: 2}).Run(context.Background(), "交付功能")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(res.Plan.Steps) != 2 || llm.CallCount(llmtest.PhaseRepair) != 2 {
+		t.Fatalf("expected second repair round to succeed: %#v", res.Plan)
+	}
+	var repairs []string
+	for _, c := range llm.Calls() {
+		if c.Phase == llmtest.PhaseRepair {
+			repairs = append(repairs, c.Prompt)
+		}
+	}
+	if !strings.Contains(repairs[0], `$.steps[0].risk: value "extreme"`) || !strings.Contains(repairs[1], "invalid JSON") {
+		t.Fatalf("repair prompts should carry the validation errors:\n%s", strings.Join(repairs, "\n---\n"))
+	}
+}
+
+func TestPlanBulletFallbackIsOptIn(t *testing.T) {
+	script := func() *llmtest.LLM {
+		llm := llmtest.New()
+		llm.On(llmtest.PhaseRead).Reply("摘要")
+		llm.On(llmtest.PhasePlan).Reply("- 步骤一\n- 步骤二\n- 步骤三")
+		llm.On(llmtest.PhaseRepair).Reply("- 步骤一\n- 步骤二\n- 步骤三")
+		llm.On(llmtest.PhaseAct).Reply("完成")
+		llm.On(llmtest.PhaseFinal).Reply("全部完成")
+		return llm
+	}
+	if _, err := newScenarioRunner(t, script(), RunnerOptions{}).Run(context.Background(), "交付功能"); err == nil || !strings.Contains(err.Error(), "invalid plan") {
+		t.Fatalf("bullets must be rejected by default, got %v", err)
+	}
+	res, err := newScenarioRunner(t, script(), RunnerOptions{PlanBulletFallback: true}).Run(context.Background(), "交付功能")
+	if err != nil {
+		t.Fatalf("run with bullet fallback: %v", err)
+	}
+	if len(res.Plan.Steps) != 3 || res.Plan.Steps[0].Title != "步骤一" {
+		t.Fatalf("unexpected fallback plan: %#v", res.Plan)
+	}
+}
@@ -0,0 +1,225 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/yangruihan/go-pi-pro/internal/audit"
+)
+
+const (
+	PolicyAllow = "allow"
+	PolicyDeny  = "deny"
+	PolicyAsk   = "ask"
+)
+
+// builtinPolicyRule 标记未配置策略（或没有规则命中且未设置 default）时的内置行为：
+// 高风险或 requires_approval 的步骤询问审批人，其余直接放行。
+const builtinPolicyRule = "builtin"
+
+type PolicyRule struct {
+	Name       string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Action     string   `json:"action" yaml:"action"`
+	Risk       []string `json:"risk,omitempty" yaml:"risk,omitempty"`
+	Title      string   `json:"title,omitempty" yaml:"title,omitempty"`
+	Reason     string   `json:"reason,omitempty" yaml:"reason,omitempty"`
+	Files      []string `json:"files,omitempty" yaml:"files,omitempty"`
+	WorkingDir string   `json:"working_dir,omitempty" yaml:"working_dir,omitempty"`
+
+	title  *regexp.Regexp
+	reason *regexp.Regexp
+}
+
+type Policy struct {
+	Default string       `json:"default,omitempty" yaml:"default,omitempty"`
+	Rules   []PolicyRule `json:"rules" yaml:"rules"`
+}
+
+type PolicyInput struct {
+	Step       PlanStep
+	Files      []string
+	WorkingDir string
+}
+
+type PolicyDecision = audit.PolicyDecision
+
+func LoadPolicy(file string) (*Policy, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	format := "yaml"
+	if strings.EqualFold(filepath.Ext(file), ".json") {
+		format = "json"
+	}
+	p, err := ParsePolicy(b, format)
+	if err != nil {
+		return nil, fmt.Errorf("policy %s: %w", file, err)
+	}
+	return p, nil
+}
+
+func ParsePolicy(data []byte, format string) (*Policy, error) {
+	var p Policy
+	switch format {
+	case "json":
+		if err := json.Unmarshal(data, &p); err != nil {
+			return nil, err
+		}
+	case "yaml", "yml":
+		if err := yaml.Unmarshal(data, &p); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported policy format %q", format)
+	}
+	if err := p.compile(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *Policy) compile() error {
+	p.Default = strings.ToLower(strings.TrimSpace(p.Default))
+	if p.Default != "" && !validPolicyAction(p.Default) {
+		return fmt.Errorf("invalid default action %q", p.Default)
+	}
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		rule.Action = strings.ToLower(strings.TrimSpace(rule.Action))
+		if !validPolicyAction(rule.Action) {
+			return fmt.Errorf("rule %s: invalid action %q (want allow, deny or ask)", rule.label(i), rule.Action)
+		}
+		var err error
+		if strings.TrimSpace(rule.Title) != "" {
+			if rule.title, err = regexp.Compile(rule.Title); err != nil {
+				return fmt.Errorf("rule %s: invalid title pattern: %w", rule.label(i), err)
+			}
+		}
+		if strings.TrimSpace(rule.Reason) != "" {
+			if rule.reason, err = regexp.Compile(rule.Reason); err != nil {
+				return fmt.Errorf("rule %s: invalid reason pattern: %w", rule.label(i), err)
+			}
+		}
+		for _, f := range rule.Files {
+			if _, err := path.Match(filepath.ToSlash(f), ""); err != nil {
+				return fmt.Errorf("rule %s: invalid files pattern %q", rule.label(i), f)
+			}
+		}
+	}
+	return nil
+}
+
+// Evaluate 按顺序匹配规则，返回第一条命中规则的动作。nil 策略等价于内置行为。
+func (p *Policy) Evaluate(in PolicyInput) PolicyDecision {
+	decision := PolicyDecision{At: time.Now().Format(time.RFC3339)}
+	if p != nil {
+		for i := range p.Rules {
+			if p.Rules[i].matches(in) {
+				decision.Action = p.Rules[i].Action
+				decision.Rule = p.Rules[i].label(i)
+				return decision
+			}
+		}
+		if p.Default != "" {
+			decision.Action = p.Default
+			decision.Rule = "default"
+			return decision
+		}
+	}
+	decision.Rule = builtinPolicyRule
+	decision.Action = PolicyAllow
+	if strings.EqualFold(in.Step.Risk, "high") || in.Step.RequiresApproval {
+		decision.Action = PolicyAsk
+	}
+	return decision
+}
+
+func (rule *PolicyRule) label(i int) string {
+	if name := strings.TrimSpace(rule.Name); name != "" {
+		return name
+	}
+	return fmt.Sprintf("#%d", i+1)
+}
+
+func (rule *PolicyRule) matches(in PolicyInput) bool {
+	if len(rule.Risk) > 0 {
+		found := false
+		for _, r := range rule.Risk {
+			if strings.EqualFold(strings.TrimSpace(r), strings.TrimSpace(in.Step.Risk)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if rule.title != nil && !rule.title.MatchString(in.Step.Title) {
+		return false
+	}
+	if rule.reason != nil && !rule.reason.MatchString(in.Step.Reason) {
+		return false
+	}
+	if len(rule.Files) > 0 && !anyFileMatches(rule.Files, in.Files) {
+		return false
+	}
+	if dir := strings.TrimSpace(rule.WorkingDir); dir != "" && !dirMatches(dir, in.WorkingDir) {
+		return false
+	}
+	return true
+}
+
+func anyFileMatches(patterns, files []string) bool {
+	for _, f := range files {
+		f = strings.TrimPrefix(filepath.ToSlash(strings.TrimSpace(f)), "./")
+		if f == "" {
+			continue
+		}
+		for _, pat := range patterns {
+			pat = strings.TrimPrefix(filepath.ToSlash(strings.TrimSpace(pat)), "./")
+			if ok, _ := path.Match(pat, f); ok {
+				return true
+			}
+			if ok, _ := path.Match(pat, path.Base(f)); ok {
+				return true
+			}
+			if strings.HasPrefix(f, strings.TrimSuffix(pat, "/")+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func dirMatches(pattern, dir string) bool {
+	pattern = filepath.ToSlash(filepath.Clean(pattern))
+	dir = filepath.ToSlash(filepath.Clean(dir))
+	if ok, _ := path.Match(pattern, dir); ok {
+		return true
+	}
+	return dir == pattern || strings.HasPrefix(dir, strings.TrimSuffix(pattern, "/")+"/")
+}
+
+func validPolicyAction(a string) bool {
+	return a == PolicyAllow || a == PolicyDeny || a == PolicyAsk
+}
+
+// policyFiles 汇总策略匹配用的目标文件：步骤文本中推断出的文件和验收条件引用的路径。
+func policyFiles(step PlanStep, requestedFiles []string) []string {
+	files := append([]string(nil), expectedFilesForStep(step, requestedFiles)...)
+	for _, c := range step.Acceptance {
+		if strings.TrimSpace(c.Path) != "" {
+			files = append(files, c.Path)
+		}
+	}
+	return files
+}
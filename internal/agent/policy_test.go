@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yangruihan/go-pi-pro/internal/todo"
+)
+
+const testPolicyYAML = `
+default: allow
+rules:
+  - name: no-rm
+    title: "(?i)删除|rm -rf"
+    action: deny
+  - name: secrets
+    files: ["*.env", "secrets/"]
+    action: ask
+  - risk: [high]
+    working_dir: /srv/prod
+    action: ask
+`
+
+func TestParsePolicyYAMLAndEvaluate(t *testing.T) {
+	p, err := ParsePolicy([]byte(testPolicyYAML), "yaml")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	cases := []struct {
+		in     PolicyInput
+		action string
+		rule   string
+	}{
+		{PolicyInput{Step: PlanStep{Title: "删除 build 目录", Risk: "low"}}, PolicyDeny, "no-rm"},
+		{PolicyInput{Step: PlanStep{Title: "更新配置", Risk: "low"}, Files: []string{"config/.env"}}, PolicyAsk, "secrets"},
+		{PolicyInput{Step: PlanStep{Title: "写入密钥", Risk: "low"}, Files: []string{"secrets/key.pem"}}, PolicyAsk, "secrets"},
+		{PolicyInput{Step: PlanStep{Title: "部署", Risk: "high"}, WorkingDir: "/srv/prod/app"}, PolicyAsk, "#3"},
+		{PolicyInput{Step: PlanStep{Title: "部署", Risk: "high"}, WorkingDir: "/home/dev/app"}, PolicyAllow, "default"},
+	}
+	for _, c := range cases {
+		d := p.Evaluate(c.in)
+		if d.Action != c.action || d.Rule != c.rule {
+			t.Fatalf("%q: got %s/%s want %s/%s", c.in.Step.Title, d.Action, d.Rule, c.action, c.rule)
+		}
+	}
+}
+
+func TestNilPolicyKeepsBuiltinBehaviour(t *testing.T) {
+	var p *Policy
+	if d := p.Evaluate(PolicyInput{Step: PlanStep{Risk: "high"}}); d.Action != PolicyAsk || d.Rule != builtinPolicyRule {
+		t.Fatalf("high risk should ask: %#v", d)
+	}
+	if d := p.Evaluate(PolicyInput{Step: PlanStep{Risk: "low"}}); d.Action != PolicyAllow {
+		t.Fatalf("low risk should be allowed: %#v", d)
+	}
+}
+
+func TestLoadPolicyRejectsInvalidRules(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "policy.json")
+	if err := os.WriteFile(bad, []byte(`{"rules":[{"title":"x","action":"maybe"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPolicy(bad); err == nil || !strings.Contains(err.Error(), "invalid action") {
+		t.Fatalf("expected invalid action error, got %v", err)
+	}
+	if err := os.WriteFile(bad, []byte(`{"rules":[{"title":"(","action":"deny"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPolicy(bad); err == nil {
+		t.Fatalf("expected invalid pattern error")
+	}
+}
+
+func TestPolicyDecisionsRecordedInActionLogs(t *testing.T) {
+	dir := t.TempDir()
+	plan := `{"goal":"g","steps":[{"id":"s1","title":"删除缓存","reason":"r","risk":"low","requires_approval":false},{"id":"s2","title":"部署服务","reason":"r","risk":"high","requires_approval":true},{"id":"s3","title":"整理日志","reason":"r","risk":"low","requires_approval":false}]}`
+	llm := funcLLM(func(prompt string) (string, error) {
+		switch {
+		case strings.HasPrefix(prompt, "你是read阶段"):
+			return "摘要", nil
+		case strings.HasPrefix(prompt, "你是plan阶段"):
+			return plan, nil
+		}
+		return "ok", nil
+	})
+	policy, err := ParsePolicy([]byte(`{"rules":[{"name":"no-delete","title":"删除","action":"deny"},{"risk":["high"],"action":"ask"}],"default":"allow"}`), "json")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	asked := 0
+	r := NewRunner(llm, RunnerOptions{AuditDir: dir, WorkingDir: dir, MaxActRetries: 1, Policy: policy, Approver: func(_ context.Context, step PlanStep) (bool, error) {
+		asked++
+		return true, nil
+	}})
+	res, err := r.Run(context.Background(), "清理并部署")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if asked != 1 {
+		t.Fatalf("expected exactly one approval prompt, got %d", asked)
+	}
+	want := []struct {
+		status string
+		action string
+		rule   string
+	}{
+		{string(todo.StatusSkipped), PolicyDeny, "no-delete"},
+		{string(todo.StatusDone), PolicyAsk, "#2"},
+		{string(todo.StatusDone), PolicyAllow, "default"},
+	}
+	for i, w := range want {
+		l := res.ActionLogs[i]
+		if l.Status != w.status || l.Policy == nil || l.Policy.Action != w.action || l.Policy.Rule != w.rule {
+			t.Fatalf("step %d: unexpected log %#v policy=%#v", i, l, l.Policy)
+		}
+	}
+	if !res.ActionLogs[1].Policy.Asked || !res.ActionLogs[1].Policy.Approved {
+		t.Fatalf("ask decision should record approver answer: %#v", res.ActionLogs[1].Policy)
+	}
+	if res.Outcome() != OutcomeApprovalDenied {
+		t.Fatalf("denied step should surface as approval_denied, got %s", res.Outcome())
+	}
+}
@@ -0,0 +1,40 @@
+package agent
+
+import (
+	"encoding/json"
+
+	"github.com/yangruihan/go-pi-pro/internal/audit"
+	"github.com/yangruihan/go-pi-pro/internal/redact"
+)
+
+// redactedCopy 把 v 经 JSON 深拷贝到 out 后脱敏，避免改到运行中仍在使用的数据。
+func (r *Runner) redactedCopy(v, out any) (redact.Counts, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		return nil, err
+	}
+	return r.opts.Redactor.Value(out), nil
+}
+
+// redactAudit 脱敏整条审计记录的副本，并汇总写盘前与 prompt 发送前的替换次数。
+func (r *Runner) redactAudit(run audit.Run) (audit.Run, error) {
+	var clean audit.Run
+	counts, err := r.redactedCopy(run, &clean)
+	if err != nil {
+		return run, err
+	}
+	summary := &audit.Redactions{Audit: counts.Total()}
+	for _, c := range clean.LLMCalls {
+		prompts := redact.Counts(c.Redactions)
+		summary.Prompts += prompts.Total()
+		counts.Add(prompts)
+	}
+	if len(counts) > 0 {
+		summary.ByRule = counts
+	}
+	clean.Redactions = summary
+	return clean, nil
+}
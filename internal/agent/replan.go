@@ -0,0 +1,157 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yangruihan/go-pi-pro/internal/todo"
+)
+
+// replan 在步骤阻塞后请求 LLM 给出剩余部分的修订计划。成功时替换 cp.Plan 并只保留已完成步骤的日志；
+// 无论成败都会在 cp.Replans 中追加一条记录。
+func (r *Runner) replan(ctx context.Context, cp *Checkpoint, blocked ActionStepLog) bool {
+	round := len(cp.Replans) + 1
+	record := ReplanRecord{
+		Round:        round,
+		At:           time.Now().Format(time.RFC3339),
+		FailedStepID: blocked.StepID,
+		FailedTitle:  blocked.Title,
+		Reason:       strings.TrimSpace(blocked.ErrorText),
+		PreviousPlan: cp.Plan,
+	}
+	r.emitProgress("replan", fmt.Sprintf("步骤阻塞，重新规划剩余步骤（第 %d 次）: %s", round, blocked.Title), len(cp.Plan.Steps), countCompleted(r.todos.All()))
+
+	doneLogs := make([]ActionStepLog, 0, len(cp.ActionLogs))
+	doneIDs := make(map[string]struct{}, len(cp.ActionLogs))
+	for _, l := range cp.ActionLogs {
+		if l.Status == string(todo.StatusDone) {
+			doneLogs = append(doneLogs, l)
+			doneIDs[l.StepID] = struct{}{}
+		}
+	}
+
+	raw, err := r.ask(ctx, "replan", buildReplanPrompt(cp.Plan, doneLogs, blocked))
+	if err != nil {
+		record.Error = err.Error()
+		cp.Replans = append(cp.Replans, record)
+		return false
+	}
+	revised, err := mergeReplan(cp.Plan, doneIDs, r.parseRevisedPlan(raw))
+	if err != nil {
+		record.Error = err.Error()
+		cp.Replans = append(cp.Replans, record)
+		return false
+	}
+	record.RevisedPlan = revised
+	cp.Replans = append(cp.Replans, record)
+
+	for _, s := range cp.Plan.Steps {
+		if _, ok := doneIDs[s.ID]; !ok {
+			r.todos.Upsert(s.Title, todo.StatusSkipped)
+		}
+	}
+	for _, s := range revised.Steps {
+		if _, ok := doneIDs[s.ID]; !ok {
+			r.todos.Upsert(s.Title, todo.StatusTodo)
+		}
+	}
+	cp.Plan = revised
+	cp.ActionLogs = doneLogs
+	r.emitProgress("replan", "修订计划生成完成", len(revised.Steps), countCompleted(r.todos.All()))
+	return true
+}
+
+func buildReplanPrompt(plan Plan, doneLogs []ActionStepLog, blocked ActionStepLog) string {
+	planJSON, _ := json.MarshalIndent(plan, "", "  ")
+	return fmt.Sprintf(`你是replan阶段。原计划在执行中有步骤被阻塞，请基于已完成步骤和失败原因，只输出剩余部分的修订计划（严格JSON，不要输出其它文字）。
+JSON Schema:
+%s
+要求：不要重复已完成步骤；新步骤id不得与已有步骤id重复；depends_on 可以引用已完成步骤的id；必须换一种方式绕开失败原因。
+acceptance 可选，写法与原计划相同。
+原计划：
+%s
+
+已完成步骤：
+%s
+
+失败步骤：%s
+失败原因：%s`, remainderPlanSchema, string(planJSON), renderActionLogs(doneLogs), strings.TrimSpace(blocked.Title), strings.TrimSpace(blocked.ErrorText))
+}
+
+// remainderPlanSchema 是 replan 与 fork 要求 LLM 输出的剩余计划格式。
+const remainderPlanSchema = `{"goal":"string","steps":[{"id":"r1","title":"string","reason":"string","risk":"low|medium|high","requires_approval":true,"depends_on":["s1"],"acceptance":[{"type":"file_exists|file_contains|command_exit|json_path_equals","path":"string","pattern":"regex","command":"string","exit_code":0,"json_path":"$.a.b","value":"any"}]}]}`
+
+// mergeReplan 把已完成步骤与修订的剩余步骤合并成新计划并重新规范化。
+func mergeReplan(previous Plan, doneIDs map[string]struct{}, remainder Plan) (Plan, error) {
+	merged := Plan{Goal: previous.Goal, Steps: make([]PlanStep, 0, len(previous.Steps)+len(remainder.Steps))}
+	if strings.TrimSpace(remainder.Goal) != "" && remainder.Goal != "完成用户请求" {
+		merged.Goal = remainder.Goal
+	}
+	doneTitles := make(map[string]struct{}, len(doneIDs))
+	for _, s := range previous.Steps {
+		if _, ok := doneIDs[s.ID]; ok {
+			merged.Steps = append(merged.Steps, s)
+			doneTitles[strings.ToLower(strings.TrimSpace(s.Title))] = struct{}{}
+		}
+	}
+	taken := make(map[string]struct{}, len(previous.Steps)+len(remainder.Steps))
+	for id := range doneIDs {
+		taken[id] = struct{}{}
+	}
+	// 与已完成步骤重名的新步骤改用新 id，剩余步骤中对旧 id 的依赖随之指向新 id；
+	// 步骤依赖自己的旧 id 时只可能是指已完成步骤，保持不变。
+	renamed := make(map[string]string)
+	added := 0
+	for _, s := range remainder.Steps {
+		if strings.TrimSpace(s.Title) == "" {
+			continue
+		}
+		if _, ok := doneTitles[strings.ToLower(strings.TrimSpace(s.Title))]; ok {
+			continue
+		}
+		s.ID = strings.TrimSpace(s.ID)
+		if _, ok := taken[s.ID]; ok || s.ID == "" {
+			id := freshStepID(taken)
+			if _, done := doneIDs[s.ID]; done {
+				renamed[s.ID] = id
+			}
+			s.ID = id
+		}
+		taken[s.ID] = struct{}{}
+		merged.Steps = append(merged.Steps, s)
+		added++
+	}
+	if added == 0 {
+		return Plan{}, fmt.Errorf("invalid replan: no remaining steps")
+	}
+	if len(renamed) > 0 {
+		for i := len(merged.Steps) - added; i < len(merged.Steps); i++ {
+			s := &merged.Steps[i]
+			deps := make([]string, 0, len(s.DependsOn))
+			for _, dep := range s.DependsOn {
+				if id, ok := renamed[strings.TrimSpace(dep)]; ok && id != s.ID {
+					dep = id
+				}
+				deps = append(deps, dep)
+			}
+			s.DependsOn = deps
+		}
+	}
+	normalized, ok := normalizePlan(merged)
+	if !ok {
+		return Plan{}, fmt.Errorf("invalid replan: unable to normalize revised plan")
+	}
+	return normalized, nil
+}
+
+func freshStepID(taken map[string]struct{}) string {
+	for i := 1; ; i++ {
+		id := fmt.Sprintf("r%d", i)
+		if _, ok := taken[id]; !ok {
+			return id
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/yangruihan/go-pi-pro/internal/audit"
+	"github.com/yangruihan/go-pi-pro/internal/todo"
+)
+
+func TestMergeReplanKeepsDoneSteps(t *testing.T) {
+	previous := Plan{Goal: "g", Steps: []PlanStep{
+		{ID: "s1", Title: "a", Risk: "low"},
+		{ID: "s2", Title: "b", Risk: "low"},
+		{ID: "s3", Title: "c", Risk: "low"},
+	}}
+	remainder := Plan{Steps: []PlanStep{
+		{ID: "s1", Title: "a"},
+		{ID: "s1", Title: "b2", DependsOn: []string{"s1"}},
+		{Title: "c"},
+	}}
+	merged, err := mergeReplan(previous, map[string]struct{}{"s1": {}}, remainder)
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if len(merged.Steps) != 3 || merged.Steps[0].ID != "s1" || merged.Steps[1].Title != "b2" {
+		t.Fatalf("unexpected merged plan: %#v", merged.Steps)
+	}
+	if merged.Steps[1].ID == "s1" {
+		t.Fatalf("colliding id should be renamed: %#v", merged.Steps)
+	}
+	if deps := merged.Steps[1].DependsOn; len(deps) != 1 || deps[0] != "s1" {
+		t.Fatalf("self reference should keep pointing at the done step: %#v", merged.Steps[1])
+	}
+	if _, err := mergeReplan(previous, map[string]struct{}{"s1": {}}, Plan{Steps: []PlanStep{{Title: "a"}}}); err == nil {
+		t.Fatalf("expected error for empty remainder")
+	}
+}
+
+func TestMergeReplanRemapsRenamedDependencies(t *testing.T) {
+	previous := Plan{Goal: "g", Steps: []PlanStep{
+		{ID: "s1", Title: "a", Risk: "low"},
+		{ID: "r1", Title: "b", Risk: "low"},
+		{ID: "s3", Title: "c", Risk: "low"},
+	}}
+	remainder := Plan{Steps: []PlanStep{
+		{ID: "s1", Title: "b2", Acceptance: []AcceptanceCriterion{{Type: "file_exists", Path: "out.txt"}}},
+		{ID: "r2", Title: "c2", DependsOn: []string{"s1", "r1"}},
+	}}
+	merged, err := mergeReplan(previous, map[string]struct{}{"s1": {}, "r1": {}}, remainder)
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if len(merged.Steps) != 4 {
+		t.Fatalf("unexpected merged plan: %#v", merged.Steps)
+	}
+	renamed := merged.Steps[2]
+	if renamed.Title != "b2" || renamed.ID == "s1" || renamed.ID == "r1" || len(renamed.Acceptance) != 1 {
+		t.Fatalf("colliding id should get a fresh id and keep acceptance: %#v", renamed)
+	}
+	if deps := merged.Steps[3].DependsOn; len(deps) != 2 || deps[0] != renamed.ID || deps[1] != "r1" {
+		t.Fatalf("depends_on should follow the renamed step: %#v", deps)
+	}
+	if !strings.Contains(buildReplanPrompt(previous, nil, ActionStepLog{}), `"acceptance"`) {
+		t.Fatalf("replan schema should include acceptance")
+	}
+}
+
+func TestRunReplansBlockedStep(t *testing.T) {
+	dir := t.TempDir()
+	replanCalls := 0
+	llm := funcLLM(func(prompt string) (string, error) {
+		switch {
+		case strings.HasPrefix(prompt, "你是read阶段"):
+			return "需求摘要", nil
+		case strings.HasPrefix(prompt, "你是plan阶段"):
+			return testPlanJSON, nil
+		case strings.HasPrefix(prompt, "你是replan阶段"):
+			replanCalls++
+			if !strings.Contains(prompt, "llm refused") {
+				t.Errorf("replan prompt missing failure reason: %s", prompt)
+			}
+			return `{"goal":"完成任务","steps":[{"id":"r1","title":"步骤二替代","reason":"换方式","risk":"low","requires_approval":false},{"id":"r2","title":"步骤三","reason":"c","risk":"low","requires_approval":false}]}`, nil
+		case strings.Contains(prompt, "当前步骤：步骤二\n"):
+			return "", errors.New("llm refused")
+		case strings.HasPrefix(prompt, "你是act阶段"):
+			return "ok", nil
+		}
+		return "最终答复", nil
+	})
+
+	r := NewRunner(llm, RunnerOptions{AuditDir: dir, WorkingDir: dir, MaxActRetries: 1, MaxReplans: 2})
+	res, err := r.Run(context.Background(), "执行三个步骤")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if replanCalls != 1 || len(res.Replans) != 1 {
+		t.Fatalf("expected one replan, calls=%d records=%d", replanCalls, len(res.Replans))
+	}
+	if _, blocked := firstBlockedAction(res.ActionLogs); blocked {
+		t.Fatalf("expected run to recover: %#v", res.ActionLogs)
+	}
+	titles := make([]string, 0, len(res.ActionLogs))
+	for _, l := range res.ActionLogs {
+		titles = append(titles, l.Title)
+		if l.Status != string(todo.StatusDone) {
+			t.Fatalf("unexpected status: %#v", l)
+		}
+	}
+	if strings.Join(titles, ",") != "步骤一,步骤二替代,步骤三" {
+		t.Fatalf("unexpected steps: %v", titles)
+	}
+	if res.Final != "最终答复" {
+		t.Fatalf("unexpected final: %s", res.Final)
+	}
+
+	rec, err := audit.Load(res.AuditPath)
+	if err != nil {
+		t.Fatalf("load audit: %v", err)
+	}
+	if len(rec.Replans) != 1 || rec.Replans[0].FailedStepID != "s2" || len(rec.Replans[0].RevisedPlan.Steps) != 3 {
+		t.Fatalf("unexpected audit replans: %#v", rec.Replans)
+	}
+}
+
+func TestRunStopsAfterMaxReplans(t *testing.T) {
+	dir := t.TempDir()
+	replanCalls := 0
+	llm := funcLLM(func(prompt string) (string, error) {
+		switch {
+		case strings.HasPrefix(prompt, "你是read阶段"):
+			return "需求摘要", nil
+		case strings.HasPrefix(prompt, "你是plan阶段"):
+			return testPlanJSON, nil
+		case strings.HasPrefix(prompt, "你是replan阶段"):
+			replanCalls++
+			return `{"goal":"完成任务","steps":[{"id":"r1","title":"步骤二","reason":"再试","risk":"low","requires_approval":false}]}`, nil
+		case strings.Contains(prompt, "当前步骤：步骤二\n"):
+			return "", errors.New("still failing")
+		case strings.HasPrefix(prompt, "你是act阶段"):
+			return "ok", nil
+		}
+		return "最终答复", nil
+	})
+
+	r := NewRunner(llm, RunnerOptions{AuditDir: dir, WorkingDir: dir, MaxActRetries: 1, MaxReplans: 2})
+	res, err := r.Run(context.Background(), "执行三个步骤")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if replanCalls != 2 || len(res.Replans) != 2 {
+		t.Fatalf("expected replans bounded by MaxReplans, calls=%d", replanCalls)
+	}
+	if _, blocked := firstBlockedAction(res.ActionLogs); !blocked {
+		t.Fatalf("expected blocked result")
+	}
+	if !strings.Contains(res.Final, "任务未完成") {
+		t.Fatalf("unexpected final: %s", res.Final)
+	}
+}
@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yangruihan/go-pi-pro/internal/audit"
+)
+
+const (
+	PlanReviewApprove = "approve"
+	PlanReviewReplan  = "replan"
+	PlanReviewReject  = "reject"
+)
+
+// ErrPlanRejected 表示审阅人放弃了计划，运行在发送任何 act prompt 之前停止。
+var ErrPlanRejected = errors.New("plan rejected by reviewer")
+
+// PlanReview 是审阅人的决定：approve 时按 Plan（可能已被编辑）执行；replan 时把 Feedback 交给 LLM 重新规划后再次审阅。
+type PlanReview struct {
+	Action   string
+	Plan     Plan
+	Feedback string
+}
+
+type PlanReviewRecord = audit.PlanReviewRecord
+
+// reviewPlan 在执行前反复请审阅人确认计划，直到批准或放弃。未配置 PlanReviewer 时原样返回。
+func (r *Runner) reviewPlan(ctx context.Context, cp *Checkpoint, plan Plan) (Plan, error) {
+	if r.opts.PlanReviewer == nil {
+		return plan, nil
+	}
+	for {
+		r.emitProgress("review", "等待审阅计划", len(plan.Steps), 0)
+		review, err := r.opts.PlanReviewer(ctx, clonePlan(plan))
+		if err != nil {
+			return Plan{}, err
+		}
+		record := PlanReviewRecord{Round: len(cp.PlanReviews) + 1, At: time.Now().Format(time.RFC3339), Action: review.Action}
+		switch review.Action {
+		case PlanReviewApprove:
+			fixed, ok := normalizePlan(review.Plan)
+			if !ok {
+				record.Error = "invalid plan after review"
+				cp.PlanReviews = append(cp.PlanReviews, record)
+				r.emitProgress("review", "审阅后的计划无效（为空或依赖关系错误），请重新审阅", len(plan.Steps), 0)
+				continue
+			}
+			record.Edited = !samePlan(plan, fixed)
+			cp.PlanReviews = append(cp.PlanReviews, record)
+			return fixed, nil
+		case PlanReviewReplan:
+			record.Feedback = strings.TrimSpace(review.Feedback)
+			r.emitProgress("plan", "按审阅意见重新规划", 0, 0)
+			revised, err := r.buildPlan(ctx, cp.ReadSummary, buildReviewFeedback(plan, record.Feedback))
+			if err != nil {
+				if isBudgetError(err) {
+					cp.PlanReviews = append(cp.PlanReviews, record)
+					return Plan{}, err
+				}
+				record.Error = err.Error()
+				r.emitProgress("review", fmt.Sprintf("重新规划失败，沿用当前计划：%v", err), len(plan.Steps), 0)
+			} else {
+				plan = revised
+			}
+			cp.PlanReviews = append(cp.PlanReviews, record)
+		case PlanReviewReject:
+			cp.PlanReviews = append(cp.PlanReviews, record)
+			_ = r.saveCheckpoint(cp)
+			return Plan{}, ErrPlanRejected
+		default:
+			return Plan{}, fmt.Errorf("unknown plan review action %q", review.Action)
+		}
+	}
+}
+
+func buildReviewFeedback(plan Plan, feedback string) string {
+	planJSON, _ := json.MarshalIndent(plan, "", "  ")
+	return fmt.Sprintf("用户审阅了上一版计划并要求修改，请按修改意见输出完整的新计划。\n上一版计划：\n%s\n修改意见：%s", string(planJSON), feedback)
+}
+
+// clonePlan 复制步骤及其切片字段，避免审阅人原地修改影响当前计划。
+func clonePlan(p Plan) Plan {
+	steps := make([]PlanStep, len(p.Steps))
+	for i, s := range p.Steps {
+		s.DependsOn = append([]string(nil), s.DependsOn...)
+		s.Acceptance = append([]AcceptanceCriterion(nil), s.Acceptance...)
+		steps[i] = s
+	}
+	p.Steps = steps
+	return p
+}
+
+func samePlan(a, b Plan) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/yangruihan/go-pi-pro/internal/audit"
+	"github.com/yangruihan/go-pi-pro/internal/llmtest"
+)
+
+func TestPlanReviewerReplanThenEditedApprove(t *testing.T) {
+	llm := llmtest.New()
+	llm.On(llmtest.PhaseRead).Reply("摘要")
+	llm.On(llmtest.PhasePlan).Matching("修改意见：只保留实现").Reply(`{"goal":"交付功能","steps":[{"id":"s1","title":"实现功能","reason":"r","risk":"low"}]}`)
+	llm.On(llmtest.PhasePlan).Reply(scenarioPlanJSON)
+	llm.On(llmtest.PhaseAct).Reply("完成")
+	llm.On(llmtest.PhaseFinal).Reply("全部完成")
+
+	rounds := 0
+	reviewer := func(_ context.Context, plan Plan) (PlanReview, error) {
+		rounds++
+		if rounds == 1 {
+			if len(plan.Steps) != 2 {
+				t.Fatalf("first review should see original plan: %#v", plan)
+			}
+			return PlanReview{Action: PlanReviewReplan, Feedback: "只保留实现"}, nil
+		}
+		plan.Steps[0].Title = "实现功能（审阅后）"
+		return PlanReview{Action: PlanReviewApprove, Plan: plan}, nil
+	}
+	r := newScenarioRunner(t, llm, RunnerOptions{PlanReviewer: reviewer})
+	res, err := r.Run(context.Background(), "交付功能")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(res.Plan.Steps) != 1 || res.Plan.Steps[0].Title != "实现功能（审阅后）" {
+		t.Fatalf("edited plan not used: %#v", res.Plan)
+	}
+	calls := llm.Calls()
+	if !strings.Contains(calls[3].Prompt, "实现功能（审阅后）") {
+		t.Fatalf("act prompt should use the edited step")
+	}
+	rec, err := audit.Load(res.AuditPath)
+	if err != nil {
+		t.Fatalf("load audit: %v", err)
+	}
+	if len(rec.PlanReviews) != 2 || rec.PlanReviews[0].Action != PlanReviewReplan || !rec.PlanReviews[1].Edited {
+		t.Fatalf("unexpected review records: %#v", rec.PlanReviews)
+	}
+}
+
+func TestPlanReviewerRejectSendsNoActPrompt(t *testing.T) {
+	llm := llmtest.New()
+	llm.On(llmtest.PhaseRead).Reply("摘要")
+	llm.On(llmtest.PhasePlan).Reply(scenarioPlanJSON)
+
+	reviewer := func(context.Context, Plan) (PlanReview, error) {
+		return PlanReview{Action: PlanReviewReject}, nil
+	}
+	_, err := newScenarioRunner(t, llm, RunnerOptions{PlanReviewer: reviewer}).Run(context.Background(), "交付功能")
+	if !errors.Is(err, ErrPlanRejected) {
+		t.Fatalf("expected ErrPlanRejected, got %v", err)
+	}
+	if llm.CallCount(llmtest.PhaseAct) != 0 {
+		t.Fatalf("no act prompt may be sent after rejection")
+	}
+}
@@ -0,0 +1,155 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/yangruihan/go-pi-pro/internal/llmtest"
+	"github.com/yangruihan/go-pi-pro/internal/todo"
+)
+
+const scenarioPlanJSON = `{"goal":"交付功能","steps":[{"id":"s1","title":"实现功能","reason":"r","risk":"low","requires_approval":false},{"id":"s2","title":"补充测试","reason":"r","risk":"low","requires_approval":false}]}`
+
+func newScenarioRunner(t *testing.T, llm *llmtest.LLM, opts RunnerOptions) *Runner {
+	t.Helper()
+	dir := t.TempDir()
+	opts.AuditDir = dir
+	opts.WorkingDir = dir
+	if opts.MaxActRetries == 0 {
+		opts.MaxActRetries = 2
+	}
+	// 场景计划刻意保持简短，放宽默认的 3-7 步限制
+	if opts.PlanMinSteps == 0 {
+		opts.PlanMinSteps = 1
+	}
+	return NewRunner(llm, opts)
+}
+
+func TestScenarioPlanRepairFallback(t *testing.T) {
+	llm := llmtest.New()
+	llm.On(llmtest.PhaseRead).Reply("摘要")
+	llm.On(llmtest.PhasePlan).Reply("  ")
+	llm.On(llmtest.PhaseRepair).Reply(scenarioPlanJSON)
+	llm.On(llmtest.PhaseAct).Reply("完成")
+	llm.On(llmtest.PhaseFinal).Reply("全部完成")
+
+	res, err := newScenarioRunner(t, llm, RunnerOptions{}).Run(context.Background(), "交付功能")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if llm.CallCount(llmtest.PhaseRepair) != 1 {
+		t.Fatalf("expected one repair call, calls=%#v", llm.Calls())
+	}
+	if res.Plan.Goal != "交付功能" || len(res.Plan.Steps) != 2 {
+		t.Fatalf("repaired plan not used: %#v", res.Plan)
+	}
+	if res.Outcome() != OutcomeDone || res.Final != "全部完成" {
+		t.Fatalf("unexpected result: outcome=%s final=%q", res.Outcome(), res.Final)
+	}
+}
+
+func TestScenarioActRetrySucceeds(t *testing.T) {
+	llm := llmtest.New()
+	llm.On(llmtest.PhaseRead).Reply("摘要")
+	llm.On(llmtest.PhasePlan).Reply(scenarioPlanJSON)
+	llm.On(llmtest.PhaseAct).Matching("当前步骤：实现功能").Fail(errors.New("rate limited")).Times(1)
+	llm.On(llmtest.PhaseAct).ReplyWithStats("完成", 3, 0)
+	llm.On(llmtest.PhaseFinal).Reply("全部完成")
+
+	res, err := newScenarioRunner(t, llm, RunnerOptions{MaxActRetries: 2}).Run(context.Background(), "交付功能")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	first := res.ActionLogs[0]
+	if first.Status != string(todo.StatusDone) || first.Attempts != 2 || first.ToolCalls != 3 {
+		t.Fatalf("unexpected retry log: %#v", first)
+	}
+	if res.Outcome() != OutcomeDone {
+		t.Fatalf("unexpected outcome %s", res.Outcome())
+	}
+}
+
+func TestScenarioApprovalDenied(t *testing.T) {
+	llm := llmtest.New()
+	llm.On(llmtest.PhaseRead).Reply("摘要")
+	llm.On(llmtest.PhasePlan).Reply(`{"goal":"g","steps":[{"id":"s1","title":"检查环境","reason":"r","risk":"low","requires_approval":false},{"id":"s2","title":"推送到生产","reason":"r","risk":"high","requires_approval":true}]}`)
+	llm.On(llmtest.PhaseAct).Reply("完成")
+	llm.On(llmtest.PhaseFinal).Reply("部分完成")
+
+	var asked []string
+	approver := func(_ context.Context, step PlanStep) (bool, error) {
+		asked = append(asked, step.ID)
+		return false, nil
+	}
+	res, err := newScenarioRunner(t, llm, RunnerOptions{Approver: approver}).Run(context.Background(), "发布")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(asked) != 1 || asked[0] != "s2" {
+		t.Fatalf("approver should be asked only for s2: %v", asked)
+	}
+	if llm.CallCount(llmtest.PhaseAct) != 1 {
+		t.Fatalf("denied step must not reach act, calls=%d", llm.CallCount(llmtest.PhaseAct))
+	}
+	if res.ActionLogs[1].Status != string(todo.StatusSkipped) || !res.ActionLogs[1].ApprovalDenied {
+		t.Fatalf("unexpected denied log: %#v", res.ActionLogs[1])
+	}
+	if res.Outcome() != OutcomeApprovalDenied {
+		t.Fatalf("unexpected outcome %s", res.Outcome())
+	}
+}
+
+func TestScenarioBlockedCascadeAndAudit(t *testing.T) {
+	llm := llmtest.New()
+	llm.On(llmtest.PhaseRead).Reply("摘要")
+	llm.On(llmtest.PhasePlan).Reply(`{"goal":"g","steps":[{"id":"s1","title":"准备数据","reason":"r","risk":"low","requires_approval":false},{"id":"s2","title":"训练模型","reason":"r","risk":"low","requires_approval":false,"depends_on":["s1"]},{"id":"s3","title":"编写文档","reason":"r","risk":"low","requires_approval":false,"depends_on":[]}]}`)
+	llm.On(llmtest.PhaseAct).Matching("当前步骤：准备数据").Fail(errors.New("dataset missing"))
+	llm.On(llmtest.PhaseAct).Reply("完成")
+
+	r := newScenarioRunner(t, llm, RunnerOptions{MaxActRetries: 2})
+	res, err := r.Run(context.Background(), "训练并写文档")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	want := []todo.Status{todo.StatusBlocked, todo.StatusSkipped, todo.StatusDone}
+	for i, st := range want {
+		if res.ActionLogs[i].Status != string(st) {
+			t.Fatalf("step %d status=%s want %s", i, res.ActionLogs[i].Status, st)
+		}
+	}
+	if res.ActionLogs[0].Attempts != 2 || !strings.Contains(res.ActionLogs[0].ErrorText, "dataset missing") {
+		t.Fatalf("unexpected blocked log: %#v", res.ActionLogs[0])
+	}
+	if llm.CallCount(llmtest.PhaseFinal) != 0 || !strings.Contains(res.Final, "任务未完成") {
+		t.Fatalf("blocked run should use the local blocked final: %q", res.Final)
+	}
+	if res.Outcome() != OutcomeBlocked {
+		t.Fatalf("unexpected outcome %s", res.Outcome())
+	}
+
+	b, err := os.ReadFile(res.AuditPath)
+	if err != nil {
+		t.Fatalf("read audit: %v", err)
+	}
+	var audit map[string]any
+	if err := json.Unmarshal(b, &audit); err != nil {
+		t.Fatalf("audit json: %v", err)
+	}
+	if audit["run_id"] != res.RunID || audit["user_input"] != "训练并写文档" {
+		t.Fatalf("unexpected audit header: %v", audit)
+	}
+	if audit["schema_version"] != float64(3) || audit["outcome"] != OutcomeBlocked || audit["working_dir"] == "" {
+		t.Fatalf("audit should carry schema_version, outcome and working_dir: %v %v %v", audit["schema_version"], audit["outcome"], audit["working_dir"])
+	}
+	logs, _ := audit["action_logs"].([]any)
+	if len(logs) != 3 {
+		t.Fatalf("audit should contain all action logs: %v", audit["action_logs"])
+	}
+	if first, _ := logs[0].(map[string]any); first["step_id"] != "s1" || first["status"] == nil {
+		t.Fatalf("action logs should use snake_case keys: %v", logs[0])
+	}
+}
@@ -0,0 +1,155 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// sessionHistoryTurns 是注入 read prompt 的最近轮次数，更早的轮次只保留在磁盘上。
+const sessionHistoryTurns = 8
+
+var sessionNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+type SessionTurn struct {
+	RunID       string   `json:"run_id" redact:"-"`
+	At          string   `json:"at"`
+	UserInput   string   `json:"user_input"`
+	ReadSummary string   `json:"read_summary"`
+	Goal        string   `json:"goal"`
+	Steps       []string `json:"steps,omitempty"`
+	Final       string   `json:"final"`
+	Outcome     string   `json:"outcome"`
+}
+
+type Session struct {
+	Name      string        `json:"name" redact:"-"`
+	CreatedAt string        `json:"created_at"`
+	UpdatedAt string        `json:"updated_at"`
+	Turns     []SessionTurn `json:"turns"`
+}
+
+func ValidateSessionName(name string) error {
+	if !sessionNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid session name %q (use letters, digits, '.', '_' or '-')", name)
+	}
+	return nil
+}
+
+func SessionPath(sessionDir, name string) string {
+	base := strings.TrimSpace(sessionDir)
+	if base == "" {
+		base = filepath.Join(".gopi-pro", "sessions")
+	}
+	return filepath.Join(base, name+".json")
+}
+
+// LoadSession 读取会话文件，文件不存在时返回一个空会话。
+func LoadSession(sessionDir, name string) (Session, error) {
+	if err := ValidateSessionName(name); err != nil {
+		return Session{}, err
+	}
+	b, err := os.ReadFile(SessionPath(sessionDir, name))
+	if os.IsNotExist(err) {
+		return Session{Name: name, CreatedAt: time.Now().Format(time.RFC3339), Turns: make([]SessionTurn, 0)}, nil
+	}
+	if err != nil {
+		return Session{}, err
+	}
+	var s Session
+	if err := json.Unmarshal(b, &s); err != nil {
+		return Session{}, fmt.Errorf("session %s: %w", name, err)
+	}
+	s.Name = name
+	return s, nil
+}
+
+func (s *Session) Save(sessionDir string) error {
+	s.UpdatedAt = time.Now().Format(time.RFC3339)
+	path := SessionPath(sessionDir, s.Name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (r *Runner) sessionEnabled() bool {
+	return strings.TrimSpace(r.opts.SessionName) != ""
+}
+
+func (r *Runner) sessionHistory() string {
+	if !r.sessionEnabled() {
+		return ""
+	}
+	s, err := LoadSession(r.opts.SessionDir, r.opts.SessionName)
+	if err != nil {
+		return ""
+	}
+	return renderSessionHistory(s.Turns, sessionHistoryTurns)
+}
+
+// recordSessionTurn 在运行结束后把本轮追加到会话；每次重新读取文件，避免覆盖其它进程写入的轮次。
+func (r *Runner) recordSessionTurn(cp *Checkpoint, res StepResult) error {
+	if !r.sessionEnabled() {
+		return nil
+	}
+	s, err := LoadSession(r.opts.SessionDir, r.opts.SessionName)
+	if err != nil {
+		return err
+	}
+	steps := make([]string, 0, len(res.Plan.Steps))
+	for _, st := range res.Plan.Steps {
+		steps = append(steps, st.Title)
+	}
+	s.Turns = append(s.Turns, SessionTurn{
+		RunID:       cp.RunID,
+		At:          time.Now().Format(time.RFC3339),
+		UserInput:   cp.UserInput,
+		ReadSummary: res.ReadSummary,
+		Goal:        res.Plan.Goal,
+		Steps:       steps,
+		Final:       res.Final,
+		Outcome:     res.Outcome(),
+	})
+	r.opts.Redactor.Value(&s)
+	return s.Save(r.opts.SessionDir)
+}
+
+func renderSessionHistory(turns []SessionTurn, max int) string {
+	if len(turns) == 0 {
+		return ""
+	}
+	start := 0
+	if max > 0 && len(turns) > max {
+		start = len(turns) - max
+	}
+	var b strings.Builder
+	if start > 0 {
+		fmt.Fprintf(&b, "（更早的 %d 轮已省略）\n", start)
+	}
+	for i := start; i < len(turns); i++ {
+		t := turns[i]
+		fmt.Fprintf(&b, "%d. 用户：%s\n", i+1, truncateText(oneLine(t.UserInput), 200))
+		if strings.TrimSpace(t.Goal) != "" {
+			fmt.Fprintf(&b, "   目标：%s\n", truncateText(oneLine(t.Goal), 120))
+		}
+		fmt.Fprintf(&b, "   结果（%s）：%s\n", t.Outcome, truncateText(oneLine(t.Final), 300))
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yangruihan/go-pi-pro/internal/llmtest"
+)
+
+func TestSessionHistoryInjectedIntoReadPrompt(t *testing.T) {
+	dir := t.TempDir()
+	llm := llmtest.New()
+	llm.On(llmtest.PhaseRead).Reply("摘要")
+	llm.On(llmtest.PhasePlan).Reply(`{"goal":"写排序","steps":[{"id":"s1","title":"实现快速排序","reason":"r","risk":"low","requires_approval":false}]}`)
+	llm.On(llmtest.PhaseAct).Reply("完成")
+	llm.On(llmtest.PhaseFinal).Reply("已实现快速排序")
+
+	opts := RunnerOptions{AuditDir: dir, WorkingDir: dir, SessionDir: filepath.Join(dir, "sessions"), SessionName: "demo", PlanMinSteps: 1}
+	if _, err := NewRunner(llm, opts).Run(context.Background(), "帮我写快速排序"); err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	if _, err := NewRunner(llm, opts).Run(context.Background(), "我刚才让你做了什么"); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+
+	var reads []string
+	for _, c := range llm.Calls() {
+		if c.Phase == llmtest.PhaseRead {
+			reads = append(reads, c.Prompt)
+		}
+	}
+	if len(reads) != 2 {
+		t.Fatalf("expected two read prompts, got %d", len(reads))
+	}
+	if strings.Contains(reads[0], "本会话此前各轮记录") {
+		t.Fatalf("first turn must not carry history: %s", reads[0])
+	}
+	if !strings.Contains(reads[1], "帮我写快速排序") || !strings.Contains(reads[1], "已实现快速排序") {
+		t.Fatalf("second read prompt should include previous turn: %s", reads[1])
+	}
+
+	s, err := LoadSession(opts.SessionDir, "demo")
+	if err != nil {
+		t.Fatalf("load session: %v", err)
+	}
+	if len(s.Turns) != 2 || s.Turns[0].Goal != "写排序" || s.Turns[0].Outcome != OutcomeDone {
+		t.Fatalf("unexpected session: %#v", s.Turns)
+	}
+}
+
+func TestRenderSessionHistoryKeepsRecentTurns(t *testing.T) {
+	turns := make([]SessionTurn, 0)
+	for _, in := range []string{"一", "二", "三"} {
+		turns = append(turns, SessionTurn{UserInput: "问题" + in, Final: "回答\n" + in, Outcome: OutcomeDone})
+	}
+	text := renderSessionHistory(turns, 2)
+	if strings.Contains(text, "问题一") || !strings.Contains(text, "更早的 1 轮已省略") || !strings.Contains(text, "3. 用户：问题三") {
+		t.Fatalf("unexpected history: %s", text)
+	}
+	if strings.Contains(text, "回答\n") {
+		t.Fatalf("history should be compacted to single lines: %s", text)
+	}
+}
+
+func TestValidateSessionName(t *testing.T) {
+	for _, bad := range []string{"", "../x", "a/b", ".hidden"} {
+		if ValidateSessionName(bad) == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+	if err := ValidateSessionName("work-1.a_b"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/yangruihan/go-pi-pro/internal/gitsnap"
+)
+
+const baseSnapshotName = "base"
+
+func (r *Runner) gitSnapshotsEnabled(ctx context.Context) bool {
+	return r.opts.GitSnapshots && gitsnap.IsRepo(ctx, r.resolveWorkingDir())
+}
+
+// snapshotBase 记录整个 act 阶段开始前的工作区；恢复运行时保留最初的快照。
+func (r *Runner) snapshotBase(ctx context.Context, runID string) {
+	if !r.gitSnapshotsEnabled(ctx) {
+		return
+	}
+	wd := r.resolveWorkingDir()
+	ref := gitsnap.RefName(runID, baseSnapshotName)
+	if gitsnap.Exists(ctx, wd, ref) {
+		return
+	}
+	if _, err := gitsnap.Snapshot(ctx, wd, ref, fmt.Sprintf("gopi-pro %s base", runID), r.snapshotExcludes()...); err != nil {
+		r.emitProgress("snapshot", fmt.Sprintf("工作区快照失败: %v", err), 0, 0)
+	}
+}
+
+func (r *Runner) snapshotStep(ctx context.Context, runID, stepID, message string) string {
+	if !r.gitSnapshotsEnabled(ctx) {
+		return ""
+	}
+	commit, err := gitsnap.Snapshot(ctx, r.resolveWorkingDir(), gitsnap.RefName(runID, stepID), message, r.snapshotExcludes()...)
+	if err != nil {
+		r.emitProgress("snapshot", fmt.Sprintf("步骤快照失败: %s: %v", stepID, err), 0, 0)
+		return ""
+	}
+	return commit
+}
+
+// rollbackBlockedStep 把阻塞步骤的改动回滚到步骤开始前的快照。并行执行时整树回滚会波及其它步骤，因此跳过。
+func (r *Runner) rollbackBlockedStep(ctx context.Context, runID string, step PlanStep, snapshot string) (bool, error) {
+	if !r.opts.RollbackBlocked || snapshot == "" {
+		return false, nil
+	}
+	if r.opts.MaxParallel > 1 {
+		r.emitProgress("rollback", fmt.Sprintf("并行执行时跳过自动回滚: %s", step.Title), 0, 0)
+		return false, nil
+	}
+	if err := gitsnap.Restore(ctx, r.resolveWorkingDir(), gitsnap.RefName(runID, step.ID), r.snapshotExcludes()...); err != nil {
+		return false, err
+	}
+	r.emitProgress("rollback", fmt.Sprintf("已回滚阻塞步骤的改动: %s", step.Title), 0, 0)
+	return true, nil
+}
+
+func (r *Runner) snapshotExcludes() []string {
+	return SnapshotExcludes(r.opts.AuditDir, r.opts.SessionDir)
+}
+
+// SnapshotExcludes 返回快照与回滚不应触碰的 gopi-pro 状态目录（审计、检查点、索引与会话），
+// 它们位于工作目录内时会被排除。
+func SnapshotExcludes(auditDir, sessionDir string) []string {
+	if strings.TrimSpace(auditDir) == "" {
+		auditDir = filepath.Join(".gopi-pro", "runs")
+	}
+	return []string{auditDir, filepath.Dir(SessionPath(sessionDir, "_"))}
+}
+
+func SnapshotRef(runID, stepID string) string {
+	if stepID == "" {
+		stepID = baseSnapshotName
+	}
+	return gitsnap.RefName(normalizeRunID(runID), stepID)
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestExecuteStepRollsBackBlockedStep(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	for _, args := range [][]string{{"init", "-q"}, {"config", "user.email", "t@example.com"}, {"config", "user.name", "t"}} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v %s", args, err, out)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "keep.txt"), []byte("original"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	llm := funcLLM(func(prompt string) (string, error) {
+		_ = os.WriteFile(filepath.Join(dir, "keep.txt"), []byte("clobbered"), 0o644)
+		_ = os.WriteFile(filepath.Join(dir, "junk.txt"), []byte("junk"), 0o644)
+		return "ok", nil
+	})
+	r := NewRunner(llm, RunnerOptions{AuditDir: filepath.Join(dir, ".gopi-pro", "runs"), WorkingDir: dir, MaxActRetries: 1, GitSnapshots: true, RollbackBlocked: true})
+	step := PlanStep{ID: "s1", Title: "修改文件", Reason: "r", Risk: "high", Acceptance: []AcceptanceCriterion{
+		{Type: AcceptanceFileContains, Path: "keep.txt", Pattern: "^expected$"},
+	}}
+	log, err := r.executeStep(context.Background(), step, stepEnv{runID: "run1", total: 1})
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if log.Status != "blocked" || log.Snapshot == "" || !log.RolledBack {
+		t.Fatalf("unexpected log: %#v", log)
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "keep.txt"))
+	if string(b) != "original" {
+		t.Fatalf("file not rolled back: %s", b)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "junk.txt")); !os.IsNotExist(err) {
+		t.Fatalf("created file not removed")
+	}
+}
+
+func TestRollbackBlockedStepInSubdirectory(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo := t.TempDir()
+	for _, args := range [][]string{{"init", "-q"}, {"config", "user.email", "t@example.com"}, {"config", "user.name", "t"}} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v %s", args, err, out)
+		}
+	}
+	dir := filepath.Join(repo, "app")
+	auditDir := filepath.Join(dir, "audits")
+	for _, p := range []string{filepath.Join(dir, "keep.txt"), filepath.Join(repo, "sibling.txt")} {
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("original"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	llm := funcLLM(func(prompt string) (string, error) {
+		_ = os.WriteFile(filepath.Join(dir, "keep.txt"), []byte("clobbered"), 0o644)
+		_ = os.WriteFile(filepath.Join(repo, "sibling.txt"), []byte("edited elsewhere"), 0o644)
+		_ = os.MkdirAll(auditDir, 0o755)
+		_ = os.WriteFile(filepath.Join(auditDir, "run-run1.json"), []byte("{}"), 0o644)
+		return "ok", nil
+	})
+	r := NewRunner(llm, RunnerOptions{AuditDir: auditDir, WorkingDir: dir, MaxActRetries: 1, GitSnapshots: true, RollbackBlocked: true})
+	step := PlanStep{ID: "s1", Title: "修改文件", Reason: "r", Risk: "high", Acceptance: []AcceptanceCriterion{
+		{Type: AcceptanceFileContains, Path: "keep.txt", Pattern: "^expected$"},
+	}}
+	log, err := r.executeStep(context.Background(), step, stepEnv{runID: "run1", total: 1})
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if log.Status != "blocked" || !log.RolledBack {
+		t.Fatalf("unexpected log: %#v", log)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "keep.txt")); string(b) != "original" {
+		t.Fatalf("file in working dir not rolled back: %s", b)
+	}
+	if b, _ := os.ReadFile(filepath.Join(repo, "sibling.txt")); string(b) != "edited elsewhere" {
+		t.Fatalf("file outside working dir must not be touched: %s", b)
+	}
+	if _, err := os.Stat(filepath.Join(auditDir, "run-run1.json")); err != nil {
+		t.Fatalf("audit dir must survive rollback: %v", err)
+	}
+}
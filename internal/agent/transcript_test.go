@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yangruihan/go-pi-pro/internal/audit"
+	"github.com/yangruihan/go-pi-pro/internal/llmtest"
+)
+
+func newTranscriptLLM() *llmtest.LLM {
+	llm := llmtest.New()
+	llm.On(llmtest.PhaseRead).Reply("摘要")
+	llm.On(llmtest.PhasePlan).Reply("不是JSON")
+	llm.On(llmtest.PhaseRepair).Reply(scenarioPlanJSON)
+	llm.On(llmtest.PhaseAct).Matching("实现功能").Fail(errors.New("boom")).Times(1)
+	llm.On(llmtest.PhaseAct).Reply("完成")
+	llm.On(llmtest.PhaseFinal).Reply("全部完成")
+	return llm
+}
+
+func TestRunRecordsTranscriptInAudit(t *testing.T) {
+	res, err := newScenarioRunner(t, newTranscriptLLM(), RunnerOptions{}).Run(context.Background(), "交付功能")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	rec, err := audit.Load(res.AuditPath)
+	if err != nil {
+		t.Fatalf("load audit: %v", err)
+	}
+	var got []string
+	for i, e := range rec.Transcript {
+		if e.Seq != i+1 || e.Prompt == "" || e.At == "" {
+			t.Fatalf("exchange %d incomplete: %#v", i, e)
+		}
+		got = append(got, fmt.Sprintf("%s/%s/%d", e.Phase, e.StepID, e.Attempt))
+	}
+	want := "read//0,plan//0,repair//1,act/s1/1,act/s1/2,act/s2/1,final//0"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("unexpected transcript order:\n got %s\nwant %s", strings.Join(got, ","), want)
+	}
+	if rec.Transcript[1].Response != "不是JSON" || !strings.Contains(rec.Transcript[2].Prompt, "校验错误") {
+		t.Fatalf("plan/repair exchanges should keep raw text: %#v", rec.Transcript[1:3])
+	}
+	if rec.Transcript[3].Error != "boom" || rec.Transcript[4].Response != "完成" {
+		t.Fatalf("act attempts should record error and response: %#v", rec.Transcript[3:5])
+	}
+}
+
+func TestRunTranscriptSidecarAndOff(t *testing.T) {
+	res, err := newScenarioRunner(t, newTranscriptLLM(), RunnerOptions{Transcript: TranscriptFile}).Run(context.Background(), "交付功能")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	rec, err := audit.Load(res.AuditPath)
+	if err != nil {
+		t.Fatalf("load audit: %v", err)
+	}
+	if len(rec.Transcript) != 0 || rec.TranscriptFile != filepath.Base(audit.TranscriptPath(res.AuditPath)) {
+		t.Fatalf("sidecar mode should only reference the file: %q %d", rec.TranscriptFile, len(rec.Transcript))
+	}
+	exchanges, err := audit.ReadTranscript(res.AuditPath, rec)
+	if err != nil {
+		t.Fatalf("read transcript: %v", err)
+	}
+	if len(exchanges) != 7 || exchanges[6].Phase != "final" {
+		t.Fatalf("unexpected sidecar transcript: %#v", exchanges)
+	}
+
+	res, err = newScenarioRunner(t, newTranscriptLLM(), RunnerOptions{Transcript: TranscriptOff}).Run(context.Background(), "交付功能")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if rec, err = audit.Load(res.AuditPath); err != nil || len(rec.Transcript) != 0 || rec.TranscriptFile != "" {
+		t.Fatalf("transcript off should record nothing: %v %#v", err, rec.Transcript)
+	}
+}
@@ -1,6 +1,27 @@
 package agent
 
-import "context"
+import (
+	"context"
+	"time"
+
+	"github.com/yangruihan/go-pi-pro/internal/audit"
+	"github.com/yangruihan/go-pi-pro/internal/redact"
+	"github.com/yangruihan/go-pi-pro/internal/todo"
+	"github.com/yangruihan/go-pi-pro/internal/usage"
+)
+
+const (
+	OutcomeDone           = audit.OutcomeDone
+	OutcomeBlocked        = audit.OutcomeBlocked
+	OutcomeApprovalDenied = audit.OutcomeApprovalDenied
+)
+
+// Transcript 模式：audit 内嵌在审计中（默认），file 写入审计旁的 .transcript.jsonl，off 不记录。
+const (
+	TranscriptAudit = "audit"
+	TranscriptFile  = "file"
+	TranscriptOff   = "off"
+)
 
 type LLM interface {
 	Ask(ctx context.Context, prompt string) (string, error)
@@ -12,50 +33,72 @@ type LLMWithStats interface {
 
 type Approver func(ctx context.Context, step PlanStep) (bool, error)
 
+// PlanReviewer 在计划生成后、执行任何步骤前审阅计划，可以批准、编辑、要求重新规划或放弃。
+type PlanReviewer func(ctx context.Context, plan Plan) (PlanReview, error)
+
 type ProgressEvent struct {
-	Phase     string
-	Message   string
-	Total     int
-	Completed int
-	TodoText  string
+	Phase     string      `json:"phase"`
+	Message   string      `json:"message"`
+	Total     int         `json:"total"`
+	Completed int         `json:"completed"`
+	TodoText  string      `json:"todo_text,omitempty"`
+	Todos     []todo.Item `json:"todos,omitempty"`
 }
 
 type RunnerOptions struct {
 	MaxActRetries int
+	MaxParallel   int
+	MaxReplans    int
+	// PlanRepairRounds 是计划未通过 Schema 校验时最多请求修复的轮数，默认 1。
+	PlanRepairRounds int
+	// PlanMinSteps/PlanMaxSteps 限定 LLM 计划的步骤数，默认 3-7。
+	PlanMinSteps int
+	PlanMaxSteps int
+	// PlanBulletFallback 开启后，计划修复仍失败时把输出按列表逐行解析为步骤（旧行为）。
+	PlanBulletFallback bool
+	GitSnapshots       bool
+	RollbackBlocked    bool
+	TrackChanges       bool
+	ChangeIgnore       []string
+	Policy             *Policy
+	// AcceptanceCommands 开启后才执行 command_exit 验收命令，且每条命令都经过 Policy 与 Approver；
+	// 关闭时命令验收被跳过。
+	AcceptanceCommands bool
+	Price              *usage.Price
+	Currency           string
+	MaxLLMCalls        int
+	MaxTokens          int
+	MaxWallTime        time.Duration
+	Transcript         string
+	// Redactor 非空时，审计（含 transcript）写盘前对所有文本脱敏；RedactPrompts 另外在 prompt 发出前脱敏。
+	Redactor      *redact.Redactor
+	RedactPrompts bool
 	Approver      Approver
+	PlanReviewer  PlanReviewer
 	AuditDir      string
+	SessionDir    string
+	SessionName   string
 	WorkingDir    string
 	OnProgress    func(ProgressEvent)
 }
 
-type PlanStep struct {
-	ID               string `json:"id"`
-	Title            string `json:"title"`
-	Reason           string `json:"reason"`
-	Risk             string `json:"risk"`
-	RequiresApproval bool   `json:"requires_approval"`
-}
-
-type Plan struct {
-	Goal  string     `json:"goal"`
-	Steps []PlanStep `json:"steps"`
-}
-
-type ActionStepLog struct {
-	StepID         string
-	Title          string
-	Status         string
-	Attempts       int
-	Output         string
-	ErrorText      string
-	ToolCalls      int
-	WriteToolCalls int
-}
+// 计划与执行记录同时是审计格式的一部分，定义在 audit 包中。
+type (
+	PlanStep      = audit.PlanStep
+	Plan          = audit.Plan
+	ActionStepLog = audit.ActionStepLog
+	ReplanRecord  = audit.ReplanRecord
+)
 
 type StepResult struct {
-	ReadSummary string
-	Plan        Plan
-	ActionLogs  []ActionStepLog
-	Final       string
-	AuditPath   string
+	RunID       string          `json:"run_id"`
+	ReadSummary string          `json:"read_summary"`
+	Plan        Plan            `json:"plan"`
+	ActionLogs  []ActionStepLog `json:"action_logs"`
+	Replans     []ReplanRecord  `json:"replans,omitempty"`
+	Final       string          `json:"final"`
+	AuditPath   string          `json:"audit_path,omitempty"`
+	ParentRunID string          `json:"parent_run_id,omitempty"`
+	Usage       UsageSummary    `json:"usage"`
+	Budget      *BudgetExceeded `json:"budget_exceeded,omitempty"`
 }
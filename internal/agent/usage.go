@@ -0,0 +1,190 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/yangruihan/go-pi-pro/internal/audit"
+	"github.com/yangruihan/go-pi-pro/internal/redact"
+	"github.com/yangruihan/go-pi-pro/internal/usage"
+)
+
+type CallUsage = audit.CallUsage
+
+type PhaseUsage = audit.PhaseUsage
+
+type UsageSummary = audit.UsageSummary
+
+type Exchange = audit.Exchange
+
+// usageLog 按调用顺序记录每次 LLM 调用的用量，以及（未关闭 transcript 时）完整的 prompt 与响应。
+type usageLog struct {
+	mu        sync.Mutex
+	calls     []CallUsage
+	exchanges []Exchange
+}
+
+func newUsageLog(calls []CallUsage, exchanges []Exchange) *usageLog {
+	return &usageLog{calls: append([]CallUsage(nil), calls...), exchanges: append([]Exchange(nil), exchanges...)}
+}
+
+func (u *usageLog) add(c CallUsage) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.calls = append(u.calls, c)
+}
+
+func (u *usageLog) all() []CallUsage {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]CallUsage(nil), u.calls...)
+}
+
+func (u *usageLog) addExchange(e Exchange) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	e.Seq = len(u.exchanges) + 1
+	u.exchanges = append(u.exchanges, e)
+}
+
+func (u *usageLog) transcript() []Exchange {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]Exchange(nil), u.exchanges...)
+}
+
+func (r *Runner) ask(ctx context.Context, phase, prompt string) (string, error) {
+	return r.askAttempt(ctx, phase, 0, prompt)
+}
+
+func (r *Runner) askAttempt(ctx context.Context, phase string, attempt int, prompt string) (string, error) {
+	call := r.newCall(phase, "", attempt, prompt)
+	release, err := r.reserveCall(call.prompt)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	budgetCtx, cancel := r.budgetContext(ctx)
+	defer cancel()
+	callCtx, sink := usage.WithSink(budgetCtx)
+	start := time.Now()
+	text, err := r.llm.Ask(callCtx, call.prompt)
+	r.recordUsage(call, text, start, sink, err)
+	return text, r.callError(ctx, budgetCtx, call.phase, err)
+}
+
+func (r *Runner) askStats(ctx context.Context, phase, stepID string, attempt int, prompt string) (string, int, int, error) {
+	call := r.newCall(phase, stepID, attempt, prompt)
+	release, err := r.reserveCall(call.prompt)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	defer release()
+	budgetCtx, cancel := r.budgetContext(ctx)
+	defer cancel()
+	callCtx, sink := usage.WithSink(budgetCtx)
+	start := time.Now()
+	text, toolCalls, writeToolCalls, err := askWithStats(callCtx, r.llm, call.prompt)
+	r.recordUsage(call, text, start, sink, err)
+	return text, toolCalls, writeToolCalls, r.callError(ctx, budgetCtx, call.phase, err)
+}
+
+// LLMError 表示 LLM 调用本身失败（而非预算耗尽或调用方取消），便于调用方区分退出原因。
+type LLMError struct {
+	Phase string
+	Err   error
+}
+
+func (e *LLMError) Error() string { return e.Err.Error() }
+
+func (e *LLMError) Unwrap() error { return e.Err }
+
+// callError 把墙钟预算截止转换为预算错误；调用方未取消时，其余失败包装为 *LLMError。
+func (r *Runner) callError(ctx, budgetCtx context.Context, phase string, err error) error {
+	err = r.budgetCallError(ctx, budgetCtx, err)
+	if err == nil || isBudgetError(err) || ctx.Err() != nil {
+		return err
+	}
+	return &LLMError{Phase: phase, Err: err}
+}
+
+type llmCall struct {
+	phase    string
+	stepID   string
+	attempt  int
+	prompt   string
+	redacted redact.Counts
+}
+
+// newCall 在开启 RedactPrompts 时先对 prompt 脱敏，之后发送、用量估算与 transcript 都使用脱敏后的文本。
+func (r *Runner) newCall(phase, stepID string, attempt int, prompt string) llmCall {
+	call := llmCall{phase: phase, stepID: stepID, attempt: attempt, prompt: prompt}
+	if r.opts.RedactPrompts && r.opts.Redactor != nil {
+		call.prompt, call.redacted = r.opts.Redactor.String(prompt)
+	}
+	return call
+}
+
+// recordUsage 优先使用底层客户端上报的真实用量，没有时按 prompt/响应文本估算。
+func (r *Runner) recordUsage(call llmCall, text string, start time.Time, sink *usage.Sink, err error) {
+	tokens, reported := sink.Tokens()
+	if !reported {
+		tokens = usage.Tokens{Input: usage.Estimate(call.prompt), Output: usage.Estimate(text)}
+	}
+	c := CallUsage{
+		Phase:        call.phase,
+		StepID:       call.stepID,
+		At:           start.Format(time.RFC3339),
+		LatencyMs:    time.Since(start).Milliseconds(),
+		InputTokens:  tokens.Input,
+		OutputTokens: tokens.Output,
+		Estimated:    !reported,
+	}
+	if r.opts.Price != nil {
+		c.Cost = r.opts.Price.Cost(tokens)
+	}
+	if err != nil {
+		c.Error = err.Error()
+	}
+	if call.redacted.Total() > 0 {
+		c.Redactions = call.redacted
+	}
+	r.usage.add(c)
+	if r.opts.Transcript != TranscriptOff {
+		r.usage.addExchange(Exchange{
+			Phase:     call.phase,
+			StepID:    call.stepID,
+			Attempt:   call.attempt,
+			At:        c.At,
+			LatencyMs: c.LatencyMs,
+			Prompt:    call.prompt,
+			Response:  text,
+			Error:     c.Error,
+		})
+	}
+}
+
+func summarizeUsage(calls []CallUsage, currency string) UsageSummary {
+	s := UsageSummary{Currency: currency, ByPhase: make(map[string]PhaseUsage)}
+	for _, c := range calls {
+		s.Calls++
+		s.InputTokens += c.InputTokens
+		s.OutputTokens += c.OutputTokens
+		s.LatencyMs += c.LatencyMs
+		s.Cost += c.Cost
+		s.Estimated = s.Estimated || c.Estimated
+		p := s.ByPhase[c.Phase]
+		p.Calls++
+		p.InputTokens += c.InputTokens
+		p.OutputTokens += c.OutputTokens
+		p.LatencyMs += c.LatencyMs
+		p.Cost += c.Cost
+		s.ByPhase[c.Phase] = p
+	}
+	s.TotalTokens = s.InputTokens + s.OutputTokens
+	if s.Cost == 0 {
+		s.Currency = ""
+	}
+	return s
+}
@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/yangruihan/go-pi-pro/internal/audit"
+	"github.com/yangruihan/go-pi-pro/internal/llmtest"
+	"github.com/yangruihan/go-pi-pro/internal/usage"
+)
+
+func TestRunUsageByPhase(t *testing.T) {
+	llm := llmtest.New()
+	llm.On(llmtest.PhaseRead).Reply("摘要").Usage(100, 10)
+	llm.On(llmtest.PhasePlan).Reply(scenarioPlanJSON).Usage(200, 50)
+	llm.On(llmtest.PhaseAct).Reply("完成").Usage(300, 20)
+	llm.On(llmtest.PhaseFinal).Reply("全部完成")
+
+	r := newScenarioRunner(t, llm, RunnerOptions{
+		Price:    &usage.Price{Input: 1, Output: 10},
+		Currency: "USD",
+	})
+	res, err := r.Run(context.Background(), "交付功能")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	u := res.Usage
+	if u.Calls != 5 || len(u.ByPhase) != 4 {
+		t.Fatalf("unexpected usage: %#v", u)
+	}
+	act := u.ByPhase["act"]
+	if act.Calls != 2 || act.InputTokens != 600 || act.OutputTokens != 40 {
+		t.Fatalf("act usage: %#v", act)
+	}
+	// final 没有上报用量，按文本估算
+	if !u.Estimated || u.ByPhase["final"].InputTokens == 0 {
+		t.Fatalf("final should be estimated: %#v", u)
+	}
+	if u.TotalTokens != u.InputTokens+u.OutputTokens || u.Cost <= 0 || u.Currency != "USD" {
+		t.Fatalf("totals: %#v", u)
+	}
+
+	rec, err := audit.Load(res.AuditPath)
+	if err != nil {
+		t.Fatalf("load audit: %v", err)
+	}
+	if len(rec.LLMCalls) != 5 || rec.Usage.TotalTokens != u.TotalTokens {
+		t.Fatalf("audit usage mismatch: %#v", rec.Usage)
+	}
+	if rec.LLMCalls[2].Phase != "act" || rec.LLMCalls[2].StepID != "s1" {
+		t.Fatalf("act call should carry step id: %#v", rec.LLMCalls[2])
+	}
+}
+
+func TestSummarizeUsageDropsCurrencyWithoutCost(t *testing.T) {
+	s := summarizeUsage([]CallUsage{{Phase: "read", InputTokens: 3, OutputTokens: 2}}, "USD")
+	if s.Currency != "" || s.TotalTokens != 5 || s.ByPhase["read"].Calls != 1 {
+		t.Fatalf("unexpected summary: %#v", s)
+	}
+}
@@ -0,0 +1,95 @@
+// Package audit 定义运行审计（<audit-dir>/run-<run-id>.json）的磁盘格式。
+//
+// 写入方（agent.Runner）与所有读取方（show-audit、fork、测试）都使用这里的 Run，
+// 读取时经 Upgrade 把旧版本文件迁移到当前版本。字段只增不改；需要改名或改结构时
+// 提升 SchemaVersion，并在 migrations 中追加一步迁移。
+//
+// 版本历史：
+//
+//	1  未写 schema_version 的旧文件。action_logs 中的键为 Go 字段名（StepID、Status、ErrorText…）。
+//	2  增加 schema_version；action_logs 改用 snake_case 键（step_id、status、error…）。
+//	3  增加 outcome（旧文件按 action_logs 与 budget_exceeded 推导）与 working_dir（旧文件为空）。
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SchemaVersion 是当前写入的审计格式版本。
+const SchemaVersion = 3
+
+// 运行结果，与 run 子命令的退出码对应。
+const (
+	OutcomeDone           = "done"
+	OutcomeBlocked        = "blocked"
+	OutcomeApprovalDenied = "approval_denied"
+)
+
+// Run 是一次运行的完整审计记录。
+type Run struct {
+	SchemaVersion int    `json:"schema_version"`
+	RunID         string `json:"run_id" redact:"-"`
+	StartedAt     string `json:"started_at"`
+	FinishedAt    string `json:"finished_at"`
+	DurationMs    int64  `json:"duration_ms"`
+	Outcome       string `json:"outcome"`
+	WorkingDir    string `json:"working_dir,omitempty" redact:"-"`
+	// UserInput 为用户任务；ReadSummary 为 read 阶段的需求摘要。
+	UserInput   string `json:"user_input"`
+	ReadSummary string `json:"read_summary"`
+	// Plan 为最终执行的计划（含重规划后的步骤）；PlanSource 为 "user" 时表示来自计划文件。
+	Plan       Plan            `json:"plan"`
+	PlanSource string          `json:"plan_source,omitempty"`
+	ActionLogs []ActionStepLog `json:"action_logs"`
+	Replans    []ReplanRecord  `json:"replans,omitempty"`
+	Final      string          `json:"final"`
+	// Todos 为结束时 todo 列表的文本形式。
+	Todos       string             `json:"todos"`
+	ParentRunID string             `json:"parent_run_id,omitempty" redact:"-"`
+	ForkedAt    string             `json:"forked_at,omitempty"`
+	Usage       UsageSummary       `json:"usage"`
+	LLMCalls    []CallUsage        `json:"llm_calls,omitempty"`
+	Budget      *BudgetExceeded    `json:"budget_exceeded,omitempty"`
+	PlanReviews []PlanReviewRecord `json:"plan_reviews,omitempty"`
+	Redactions  *Redactions        `json:"redactions,omitempty"`
+	// Transcript 为全部 LLM 调用的 prompt 与响应；写入旁路文件时为空，TranscriptFile 为相对审计文件所在目录的文件名。
+	Transcript     []Exchange `json:"transcript,omitempty"`
+	TranscriptFile string     `json:"transcript_file,omitempty" redact:"-"`
+}
+
+// Load 读取审计文件，必要时迁移到当前版本。
+func Load(path string) (Run, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Run{}, err
+	}
+	run, err := Decode(b)
+	if err != nil {
+		return Run{}, fmt.Errorf("audit %s: %w", path, err)
+	}
+	return run, nil
+}
+
+func Decode(data []byte) (Run, error) {
+	var run Run
+	if err := UpgradeJSON(data, &run); err != nil {
+		return Run{}, err
+	}
+	return run, nil
+}
+
+// Save 以当前版本写入审计文件。
+func Save(path string, run Run) error {
+	run.SchemaVersion = SchemaVersion
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
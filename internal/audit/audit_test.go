@@ -0,0 +1,80 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadMigratesLegacyActionLogs(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "run-old.json")
+	data := `{
+  "run_id": "20250101-120000",
+  "plan": {"goal": "g", "steps": [{"id": "s1", "title": "a"}, {"id": "s2", "title": "b"}]},
+  "action_logs": [
+    {"StepID": "s1", "Title": "a", "Status": "done", "Attempts": 1, "Output": "ok", "ErrorText": "", "ToolCalls": 2, "WriteToolCalls": 1, "Policy": {"action": "allow", "rule": "builtin", "approved": true}},
+    {"StepID": "s2", "Title": "b", "Status": "blocked", "Attempts": 3, "ErrorText": "boom", "ApprovalDenied": false, "RolledBack": true}
+  ],
+  "duration_ms": 1234
+}`
+	if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	run, err := Load(file)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if run.SchemaVersion != SchemaVersion || run.DurationMs != 1234 || run.Outcome != OutcomeBlocked {
+		t.Fatalf("unexpected header: %#v", run)
+	}
+	if len(run.ActionLogs) != 2 {
+		t.Fatalf("unexpected logs: %#v", run.ActionLogs)
+	}
+	first, second := run.ActionLogs[0], run.ActionLogs[1]
+	if first.StepID != "s1" || first.Status != "done" || first.ToolCalls != 2 || first.WriteToolCalls != 1 || first.Policy == nil || first.Policy.Rule != "builtin" {
+		t.Fatalf("first log not migrated: %#v", first)
+	}
+	if second.StepID != "s2" || second.ErrorText != "boom" || !second.RolledBack || second.Attempts != 3 {
+		t.Fatalf("second log not migrated: %#v", second)
+	}
+}
+
+func TestSaveLoadRoundTrip(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "runs", "run-x.json")
+	in := Run{
+		RunID:      "x",
+		Plan:       Plan{Goal: "g", Steps: []PlanStep{{ID: "s1", Title: "a", Risk: "low"}}},
+		ActionLogs: []ActionStepLog{{StepID: "s1", Title: "a", Status: "done", Attempts: 1, ErrorText: "e"}},
+		Budget:     &BudgetExceeded{Budget: BudgetTokens, Limit: 10, Used: 12},
+	}
+	if err := Save(file, in); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{`"schema_version": 3`, `"step_id": "s1"`, `"error": "e"`} {
+		if !strings.Contains(string(b), key) {
+			t.Fatalf("saved audit should contain %s:\n%s", key, b)
+		}
+	}
+	out, err := Load(file)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if out.ActionLogs[0].StepID != "s1" || out.ActionLogs[0].ErrorText != "e" || out.Budget == nil || out.Budget.Used != 12 {
+		t.Fatalf("round trip mismatch: %#v", out)
+	}
+}
+
+func TestDecodeRejectsNewerVersion(t *testing.T) {
+	_, err := Decode([]byte(`{"schema_version": 99, "run_id": "x"}`))
+	if err == nil || !strings.Contains(err.Error(), "newer than supported") {
+		t.Fatalf("expected version error, got %v", err)
+	}
+	if _, err := Decode([]byte(`{"schema_version": "2"}`)); err == nil {
+		t.Fatalf("expected invalid schema_version error")
+	}
+}
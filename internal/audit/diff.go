@@ -0,0 +1,259 @@
+package audit
+
+import (
+	"strings"
+
+	"github.com/yangruihan/go-pi-pro/internal/fschange"
+)
+
+// 步骤对比结果的类别。
+const (
+	StepSame    = "same"
+	StepChanged = "changed"
+	StepAdded   = "added"
+	StepRemoved = "removed"
+)
+
+// RunDiff 是两次运行的对比结果，A 为基准、B 为新运行。文本字段相同时为 nil。
+type RunDiff struct {
+	A           RunRef      `json:"a"`
+	B           RunRef      `json:"b"`
+	ReadSummary *TextChange `json:"read_summary,omitempty"`
+	Goal        *TextChange `json:"goal,omitempty"`
+	Final       *TextChange `json:"final,omitempty"`
+	Steps       []StepDiff  `json:"steps"`
+}
+
+type RunRef struct {
+	RunID       string `json:"run_id"`
+	StartedAt   string `json:"started_at"`
+	Outcome     string `json:"outcome"`
+	DurationMs  int64  `json:"duration_ms"`
+	TotalTokens int    `json:"total_tokens"`
+	Steps       int    `json:"steps"`
+}
+
+type TextChange struct {
+	A    string `json:"a"`
+	B    string `json:"b"`
+	Diff string `json:"diff"`
+}
+
+// StepSide 是步骤在某一次运行中的计划与执行情况；Index 从 1 开始，Status 为空表示没有执行记录。
+type StepSide struct {
+	Index            int    `json:"index"`
+	ID               string `json:"id"`
+	Title            string `json:"title"`
+	Risk             string `json:"risk"`
+	RequiresApproval bool   `json:"requires_approval"`
+	Status           string `json:"status,omitempty"`
+	Attempts         int    `json:"attempts"`
+	ToolCalls        int    `json:"tool_calls"`
+	WriteToolCalls   int    `json:"write_tool_calls"`
+}
+
+// StepDiff 中 Fields 列出发生变化的字段（risk、requires_approval、status、attempts、tool_calls、write_tool_calls）；
+// Moved 表示该步骤在两次计划中的相对顺序不同。
+type StepDiff struct {
+	Change string    `json:"change"`
+	A      *StepSide `json:"a,omitempty"`
+	B      *StepSide `json:"b,omitempty"`
+	Fields []string  `json:"fields,omitempty"`
+	Moved  bool      `json:"moved,omitempty"`
+}
+
+// Diff 对比两次运行。步骤按标题（忽略大小写与多余空白）配对，未配对的为新增或删除；
+// 步骤 id 由规划器按位置编号，不作为配对依据。
+func Diff(a, b Run) RunDiff {
+	d := RunDiff{
+		A:           runRef(a),
+		B:           runRef(b),
+		ReadSummary: textChange("read_summary", a.ReadSummary, b.ReadSummary),
+		Goal:        textChange("goal", a.Plan.Goal, b.Plan.Goal),
+		Final:       textChange("final", a.Final, b.Final),
+	}
+	sa, sb := stepSides(a), stepSides(b)
+	pairOf := pairSteps(sa, sb)
+	moved := movedSteps(pairOf, len(sb))
+
+	d.Steps = make([]StepDiff, 0, len(sa)+len(sb))
+	matchedA := make(map[int]bool, len(pairOf))
+	for _, ia := range pairOf {
+		matchedA[ia] = true
+	}
+	nextA := 0
+	flushRemoved := func(upTo int) {
+		for ; nextA < upTo; nextA++ {
+			if !matchedA[nextA] {
+				d.Steps = append(d.Steps, StepDiff{Change: StepRemoved, A: &sa[nextA]})
+			}
+		}
+	}
+	// 删除的步骤放在 A 中相邻的未移动步骤之后，并排在同一位置新增的步骤之前
+	nextAnchor := func(from int) int {
+		for ib := from; ib < len(sb); ib++ {
+			if ia, ok := pairOf[ib]; ok && !moved[ib] {
+				return ia
+			}
+		}
+		return len(sa)
+	}
+	for ib := range sb {
+		ia, ok := pairOf[ib]
+		if !ok {
+			flushRemoved(nextAnchor(ib))
+			d.Steps = append(d.Steps, StepDiff{Change: StepAdded, B: &sb[ib]})
+			continue
+		}
+		if !moved[ib] {
+			flushRemoved(ia)
+		}
+		sd := StepDiff{Change: StepSame, A: &sa[ia], B: &sb[ib], Fields: stepFields(sa[ia], sb[ib]), Moved: moved[ib]}
+		if len(sd.Fields) > 0 || sd.Moved {
+			sd.Change = StepChanged
+		}
+		d.Steps = append(d.Steps, sd)
+	}
+	flushRemoved(len(sa))
+	return d
+}
+
+// Changed 报告两次运行是否存在任何差异。
+func (d RunDiff) Changed() bool {
+	if d.ReadSummary != nil || d.Goal != nil || d.Final != nil || d.A.Outcome != d.B.Outcome {
+		return true
+	}
+	for _, s := range d.Steps {
+		if s.Change != StepSame {
+			return true
+		}
+	}
+	return false
+}
+
+func runRef(r Run) RunRef {
+	return RunRef{
+		RunID:       r.RunID,
+		StartedAt:   r.StartedAt,
+		Outcome:     r.Outcome,
+		DurationMs:  r.DurationMs,
+		TotalTokens: r.Usage.TotalTokens,
+		Steps:       len(r.Plan.Steps),
+	}
+}
+
+func textChange(name, a, b string) *TextChange {
+	if strings.TrimSpace(a) == strings.TrimSpace(b) {
+		return nil
+	}
+	return &TextChange{A: a, B: b, Diff: fschange.UnifiedDiff(name, ensureNewline(a), ensureNewline(b))}
+}
+
+func ensureNewline(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return ""
+	}
+	return s + "\n"
+}
+
+// stepSides 合并计划步骤与执行记录；同一步骤有多条记录时（如重规划后）以最后一条为准。
+func stepSides(r Run) []StepSide {
+	logs := make(map[string]ActionStepLog, len(r.ActionLogs))
+	for _, l := range r.ActionLogs {
+		logs[l.StepID] = l
+	}
+	out := make([]StepSide, 0, len(r.Plan.Steps))
+	for i, s := range r.Plan.Steps {
+		side := StepSide{Index: i + 1, ID: s.ID, Title: s.Title, Risk: s.Risk, RequiresApproval: s.RequiresApproval}
+		if l, ok := logs[s.ID]; ok {
+			side.Status = l.Status
+			side.Attempts = l.Attempts
+			side.ToolCalls = l.ToolCalls
+			side.WriteToolCalls = l.WriteToolCalls
+		}
+		out = append(out, side)
+	}
+	return out
+}
+
+// pairSteps 返回 B 中步骤下标到 A 中步骤下标的配对，重名步骤按出现顺序依次配对。
+func pairSteps(sa, sb []StepSide) map[int]int {
+	pairOf := make(map[int]int)
+	byTitle := make(map[string][]int)
+	for i, s := range sa {
+		key := normalizeTitle(s.Title)
+		byTitle[key] = append(byTitle[key], i)
+	}
+	for ib, s := range sb {
+		key := normalizeTitle(s.Title)
+		if list := byTitle[key]; len(list) > 0 {
+			pairOf[ib] = list[0]
+			byTitle[key] = list[1:]
+		}
+	}
+	return pairOf
+}
+
+func normalizeTitle(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// movedSteps 在已配对的步骤中求 A 下标的最长递增子序列，不在其中的步骤即相对顺序发生了变化。
+func movedSteps(pairOf map[int]int, nb int) map[int]bool {
+	order := make([]int, 0, len(pairOf))
+	for ib := 0; ib < nb; ib++ {
+		if _, ok := pairOf[ib]; ok {
+			order = append(order, ib)
+		}
+	}
+	n := len(order)
+	length := make([]int, n)
+	prev := make([]int, n)
+	best := -1
+	for i := 0; i < n; i++ {
+		length[i], prev[i] = 1, -1
+		for j := 0; j < i; j++ {
+			if pairOf[order[j]] < pairOf[order[i]] && length[j]+1 > length[i] {
+				length[i], prev[i] = length[j]+1, j
+			}
+		}
+		if best < 0 || length[i] > length[best] {
+			best = i
+		}
+	}
+	keep := make(map[int]bool, n)
+	for i := best; i >= 0; i = prev[i] {
+		keep[order[i]] = true
+	}
+	moved := make(map[int]bool)
+	for _, ib := range order {
+		if !keep[ib] {
+			moved[ib] = true
+		}
+	}
+	return moved
+}
+
+func stepFields(a, b StepSide) []string {
+	var fields []string
+	if !strings.EqualFold(a.Risk, b.Risk) {
+		fields = append(fields, "risk")
+	}
+	if a.RequiresApproval != b.RequiresApproval {
+		fields = append(fields, "requires_approval")
+	}
+	if a.Status != b.Status {
+		fields = append(fields, "status")
+	}
+	if a.Attempts != b.Attempts {
+		fields = append(fields, "attempts")
+	}
+	if a.ToolCalls != b.ToolCalls {
+		fields = append(fields, "tool_calls")
+	}
+	if a.WriteToolCalls != b.WriteToolCalls {
+		fields = append(fields, "write_tool_calls")
+	}
+	return fields
+}
@@ -0,0 +1,81 @@
+package audit
+
+import "testing"
+
+func TestDiffSteps(t *testing.T) {
+	a := Run{
+		RunID:       "a",
+		Outcome:     OutcomeDone,
+		ReadSummary: "摘要",
+		Plan: Plan{Goal: "g", Steps: []PlanStep{
+			{ID: "s1", Title: "准备数据", Risk: "low"},
+			{ID: "s2", Title: "训练模型", Risk: "low"},
+			{ID: "s3", Title: "编写文档", Risk: "low"},
+			{ID: "s4", Title: "清理", Risk: "low"},
+		}},
+		ActionLogs: []ActionStepLog{
+			{StepID: "s1", Status: "done", Attempts: 1, ToolCalls: 2},
+			{StepID: "s2", Status: "done", Attempts: 1},
+		},
+		Final: "完成",
+	}
+	b := Run{
+		RunID:       "b",
+		Outcome:     OutcomeBlocked,
+		ReadSummary: "摘要",
+		Plan: Plan{Goal: "g2", Steps: []PlanStep{
+			{ID: "s1", Title: "编写文档", Risk: "low"},
+			{ID: "s2", Title: "准备数据", Risk: "low"},
+			{ID: "s3", Title: "训练模型", Risk: "high", RequiresApproval: true},
+			{ID: "s5", Title: "发布", Risk: "medium"},
+		}},
+		ActionLogs: []ActionStepLog{
+			{StepID: "s2", Status: "done", Attempts: 1, ToolCalls: 2},
+			{StepID: "s3", Status: "blocked", Attempts: 3},
+		},
+		Final: "任务未完成",
+	}
+	d := Diff(a, b)
+	if d.ReadSummary != nil || d.Goal == nil || d.Final == nil || !d.Changed() {
+		t.Fatalf("unexpected text changes: %+v", d)
+	}
+	type want struct {
+		change string
+		title  string
+		moved  bool
+		fields int
+	}
+	wants := []want{
+		{StepChanged, "编写文档", true, 0},
+		{StepSame, "准备数据", false, 0},
+		{StepChanged, "训练模型", false, 4},
+		{StepRemoved, "清理", false, 0},
+		{StepAdded, "发布", false, 0},
+	}
+	if len(d.Steps) != len(wants) {
+		t.Fatalf("unexpected steps: %+v", d.Steps)
+	}
+	for i, w := range wants {
+		s := d.Steps[i]
+		side := s.B
+		if side == nil {
+			side = s.A
+		}
+		if s.Change != w.change || side.Title != w.title || s.Moved != w.moved || len(s.Fields) != w.fields {
+			t.Fatalf("step %d: got %+v (a=%+v b=%+v), want %+v", i, s, s.A, s.B, w)
+		}
+	}
+}
+
+func TestDiffIdenticalAndRenamed(t *testing.T) {
+	run := Run{RunID: "x", Outcome: OutcomeDone, Plan: Plan{Goal: "g", Steps: []PlanStep{{ID: "s1", Title: "a"}, {ID: "s2", Title: "b"}}}}
+	if d := Diff(run, run); d.Changed() {
+		t.Fatalf("identical runs should not differ: %+v", d)
+	}
+	renamed := run
+	renamed.Plan.Steps = []PlanStep{{ID: "s1", Title: "a"}, {ID: "s2", Title: "b2"}}
+	d := Diff(run, renamed)
+	if len(d.Steps) != 3 || d.Steps[1].Change != StepRemoved || d.Steps[2].Change != StepAdded {
+		t.Fatalf("retitled step should be removed and added: %+v", d.Steps)
+	}
+}
@@ -0,0 +1,231 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IndexEntry 是 <audit-dir>/index.jsonl 中的一行，保存列表与过滤所需的审计摘要。
+// 索引只追加，同一 run_id 以最后一行为准；ModTime 与审计文件不一致时视为过期。
+type IndexEntry struct {
+	RunID       string   `json:"run_id"`
+	File        string   `json:"file"`
+	ModTime     string   `json:"mod_time"`
+	StartedAt   string   `json:"started_at"`
+	DurationMs  int64    `json:"duration_ms"`
+	Outcome     string   `json:"outcome"`
+	UserInput   string   `json:"user_input"`
+	Goal        string   `json:"goal"`
+	Steps       []string `json:"steps"`
+	Done        int      `json:"done"`
+	WorkingDir  string   `json:"working_dir,omitempty"`
+	ParentRunID string   `json:"parent_run_id,omitempty"`
+}
+
+func IndexPath(dir string) string {
+	return filepath.Join(dir, "index.jsonl")
+}
+
+func newIndexEntry(path string, info os.FileInfo, run Run) IndexEntry {
+	e := IndexEntry{
+		RunID:       run.RunID,
+		File:        filepath.Base(path),
+		ModTime:     info.ModTime().UTC().Format(time.RFC3339Nano),
+		StartedAt:   run.StartedAt,
+		DurationMs:  run.DurationMs,
+		Outcome:     run.Outcome,
+		UserInput:   run.UserInput,
+		Goal:        run.Plan.Goal,
+		Steps:       make([]string, 0, len(run.Plan.Steps)),
+		WorkingDir:  run.WorkingDir,
+		ParentRunID: run.ParentRunID,
+	}
+	for _, s := range run.Plan.Steps {
+		e.Steps = append(e.Steps, s.Title)
+	}
+	for _, l := range run.ActionLogs {
+		if strings.EqualFold(strings.TrimSpace(l.Status), OutcomeDone) {
+			e.Done++
+		}
+	}
+	return e
+}
+
+// IndexRun 在审计文件 path 写入后把它追加到同目录的索引中。
+func IndexRun(path string, run Run) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(newIndexEntry(path, info, run))
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(IndexPath(filepath.Dir(path)), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// Index 读取 dir 的索引，并与磁盘上的 run-*.json 对账：补上缺失或过期的条目、去掉文件已删除的条目，
+// 有变化时压缩重写索引。结果按开始时间从新到旧排序。
+func Index(dir string) ([]IndexEntry, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	indexed, lines := readIndex(IndexPath(dir))
+	out := make([]IndexEntry, 0, len(entries))
+	changed := false
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, "run-") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if e, ok := indexed[name]; ok && e.ModTime == info.ModTime().UTC().Format(time.RFC3339Nano) {
+			out = append(out, e)
+			continue
+		}
+		path := filepath.Join(dir, name)
+		run, err := Load(path)
+		if err != nil {
+			// 损坏或无法迁移的文件不进入索引
+			continue
+		}
+		out = append(out, newIndexEntry(path, info, run))
+		changed = true
+	}
+	sortEntries(out)
+	if changed || lines != len(out) {
+		if err := writeIndex(IndexPath(dir), out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// readIndex 返回按文件名去重后的条目与索引的总行数；读不到或无法解析的行会在重写时丢弃。
+func readIndex(path string) (map[string]IndexEntry, int) {
+	out := make(map[string]IndexEntry)
+	f, err := os.Open(path)
+	if err != nil {
+		return out, 0
+	}
+	defer f.Close()
+	lines := 0
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		lines++
+		var e IndexEntry
+		if json.Unmarshal(sc.Bytes(), &e) == nil && e.File != "" {
+			out[e.File] = e
+		}
+	}
+	return out, lines
+}
+
+func writeIndex(path string, entries []IndexEntry) error {
+	var buf bytes.Buffer
+	for _, e := range entries {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func sortEntries(entries []IndexEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].StartedAt != entries[j].StartedAt {
+			return entries[i].StartedAt > entries[j].StartedAt
+		}
+		return entries[i].RunID > entries[j].RunID
+	})
+}
+
+// Query 为 audit list 的过滤条件，零值字段不参与过滤。
+type Query struct {
+	Since      time.Time
+	Until      time.Time
+	Outcome    string
+	Text       string
+	Step       string
+	WorkingDir string
+	Limit      int
+}
+
+// Filter 返回满足 q 的条目：Text 在用户输入或目标中、Step 在任一步骤标题中做不区分大小写的子串匹配，
+// WorkingDir 匹配该目录及其子目录。
+func Filter(entries []IndexEntry, q Query) []IndexEntry {
+	out := make([]IndexEntry, 0, len(entries))
+	for _, e := range entries {
+		if !q.Since.IsZero() || !q.Until.IsZero() {
+			started, err := time.Parse(time.RFC3339, e.StartedAt)
+			if err != nil || (!q.Since.IsZero() && started.Before(q.Since)) || (!q.Until.IsZero() && !started.Before(q.Until)) {
+				continue
+			}
+		}
+		if q.Outcome != "" && !strings.EqualFold(e.Outcome, q.Outcome) {
+			continue
+		}
+		if q.Text != "" && !containsFold(e.UserInput, q.Text) && !containsFold(e.Goal, q.Text) {
+			continue
+		}
+		if q.Step != "" && !anyContainsFold(e.Steps, q.Step) {
+			continue
+		}
+		if q.WorkingDir != "" && !withinDir(e.WorkingDir, q.WorkingDir) {
+			continue
+		}
+		out = append(out, e)
+		if q.Limit > 0 && len(out) >= q.Limit {
+			break
+		}
+	}
+	return out
+}
+
+func containsFold(s, sub string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(sub))
+}
+
+func anyContainsFold(list []string, sub string) bool {
+	for _, s := range list {
+		if containsFold(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+func withinDir(dir, root string) bool {
+	if dir == "" {
+		return false
+	}
+	rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(dir))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func saveTestRun(t *testing.T, dir string, run Run) string {
+	t.Helper()
+	path := filepath.Join(dir, "run-"+run.RunID+".json")
+	if err := Save(path, run); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestIndexKeepsUpWithSavedRuns(t *testing.T) {
+	dir := t.TempDir()
+	first := Run{RunID: "20250101-100000", StartedAt: "2025-01-01T10:00:00Z", Outcome: OutcomeDone, UserInput: "实现登录",
+		Plan:       Plan{Goal: "登录", Steps: []PlanStep{{ID: "s1", Title: "编写 handler"}}},
+		ActionLogs: []ActionStepLog{{StepID: "s1", Status: "done"}}}
+	path := saveTestRun(t, dir, first)
+	if err := IndexRun(path, first); err != nil {
+		t.Fatal(err)
+	}
+	// 未经 IndexRun 写入的旧审计在读取时补进索引
+	legacy := filepath.Join(dir, "run-20241231-090000.json")
+	if err := os.WriteFile(legacy, []byte(`{"run_id":"20241231-090000","started_at":"2024-12-31T09:00:00Z","action_logs":[{"StepID":"s1","Status":"blocked"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := Index(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].RunID != first.RunID || entries[0].Done != 1 || entries[1].Outcome != OutcomeBlocked {
+		t.Fatalf("unexpected entries: %#v", entries)
+	}
+
+	// 重新保存（如 resume 后）以新条目为准，删除的审计从索引中移除
+	first.Outcome = OutcomeBlocked
+	path = saveTestRun(t, dir, first)
+	if err := IndexRun(path, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(legacy); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err = Index(dir); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Outcome != OutcomeBlocked {
+		t.Fatalf("index should reflect the latest save: %#v", entries)
+	}
+	b, _ := os.ReadFile(IndexPath(dir))
+	if n := strings.Count(string(b), "\n"); n != 1 {
+		t.Fatalf("index should be compacted to one line, got %d:\n%s", n, b)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	entries := []IndexEntry{
+		{RunID: "c", StartedAt: "2025-03-01T10:00:00Z", Outcome: OutcomeDone, UserInput: "Add login", Goal: "auth", Steps: []string{"写 handler"}, WorkingDir: "/src/app"},
+		{RunID: "b", StartedAt: "2025-02-01T10:00:00Z", Outcome: OutcomeBlocked, UserInput: "修复构建", Goal: "CI", Steps: []string{"运行 make"}, WorkingDir: "/src/app/sub"},
+		{RunID: "a", StartedAt: "2025-01-01T10:00:00Z", Outcome: OutcomeDone, UserInput: "docs", Goal: "README", WorkingDir: "/src/application"},
+	}
+	ids := func(list []IndexEntry) string {
+		out := make([]string, 0, len(list))
+		for _, e := range list {
+			out = append(out, e.RunID)
+		}
+		return strings.Join(out, ",")
+	}
+	since, _ := time.Parse(time.RFC3339, "2025-01-15T00:00:00Z")
+	until, _ := time.Parse(time.RFC3339, "2025-03-01T10:00:00Z")
+	cases := []struct {
+		q    Query
+		want string
+	}{
+		{Query{}, "c,b,a"},
+		{Query{Since: since}, "c,b"},
+		{Query{Since: since, Until: until}, "b"},
+		{Query{Outcome: "DONE"}, "c,a"},
+		{Query{Text: "LOGIN"}, "c"},
+		{Query{Text: "readme"}, "a"},
+		{Query{Step: "make"}, "b"},
+		{Query{WorkingDir: "/src/app"}, "c,b"},
+		{Query{Limit: 2}, "c,b"},
+	}
+	for _, c := range cases {
+		if got := ids(Filter(entries, c.q)); got != c.want {
+			t.Errorf("Filter(%+v) = %s, want %s", c.q, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// migrations[i] 把版本 i+1 的文档升级到 i+2。
+var migrations = []func(doc map[string]any){
+	migrateV1,
+	migrateV2,
+}
+
+// legacyActionLogKeys 是版本 1 中 action_logs 的键（Go 字段名）到当前键的映射。
+var legacyActionLogKeys = map[string]string{
+	"StepID":         "step_id",
+	"Title":          "title",
+	"Status":         "status",
+	"Attempts":       "attempts",
+	"Output":         "output",
+	"ErrorText":      "error",
+	"ToolCalls":      "tool_calls",
+	"WriteToolCalls": "write_tool_calls",
+	"Acceptance":     "acceptance",
+	"Snapshot":       "snapshot",
+	"RolledBack":     "rolled_back",
+	"ApprovalDenied": "approval_denied",
+	"Changes":        "changes",
+	"Policy":         "policy",
+}
+
+// Version 返回文档声明的 schema_version，未声明时视为 1。
+func Version(doc map[string]any) (int, error) {
+	raw, ok := doc["schema_version"]
+	if !ok || raw == nil {
+		return 1, nil
+	}
+	var v int64
+	var err error
+	switch n := raw.(type) {
+	case json.Number:
+		v, err = n.Int64()
+	case float64:
+		v = int64(n)
+		if float64(v) != n {
+			err = fmt.Errorf("not an integer")
+		}
+	default:
+		err = fmt.Errorf("unexpected type %T", raw)
+	}
+	if err != nil || v < 1 {
+		return 0, fmt.Errorf("invalid schema_version %v", raw)
+	}
+	return int(v), nil
+}
+
+// Upgrade 把解码为 map 的文档原地迁移到 SchemaVersion。比当前版本新的文档会报错。
+func Upgrade(doc map[string]any) error {
+	v, err := Version(doc)
+	if err != nil {
+		return err
+	}
+	if v > SchemaVersion {
+		return fmt.Errorf("schema_version %d is newer than supported version %d", v, SchemaVersion)
+	}
+	for ; v < SchemaVersion; v++ {
+		migrations[v-1](doc)
+	}
+	doc["schema_version"] = SchemaVersion
+	return nil
+}
+
+// UpgradeJSON 迁移 data 后解码到 v。检查点等内嵌 action_logs 的文档同样适用。
+func UpgradeJSON(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+	if doc == nil {
+		return fmt.Errorf("empty document")
+	}
+	if err := Upgrade(doc); err != nil {
+		return err
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func migrateV1(doc map[string]any) {
+	logs, _ := doc["action_logs"].([]any)
+	for _, item := range logs {
+		log, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		for old, key := range legacyActionLogKeys {
+			val, ok := log[old]
+			if !ok {
+				continue
+			}
+			delete(log, old)
+			if _, exists := log[key]; !exists {
+				log[key] = val
+			}
+		}
+	}
+}
+
+// migrateV2 按写入 outcome 之前的规则推导：预算耗尽或有步骤阻塞为 blocked，其次有审批拒绝为 approval_denied。
+func migrateV2(doc map[string]any) {
+	if _, ok := doc["outcome"]; ok {
+		return
+	}
+	outcome := OutcomeDone
+	if b, ok := doc["budget_exceeded"]; ok && b != nil {
+		outcome = OutcomeBlocked
+	}
+	logs, _ := doc["action_logs"].([]any)
+	for _, item := range logs {
+		log, _ := item.(map[string]any)
+		status, _ := log["status"].(string)
+		if strings.EqualFold(strings.TrimSpace(status), OutcomeBlocked) {
+			outcome = OutcomeBlocked
+			break
+		}
+		if denied, _ := log["approval_denied"].(bool); denied && outcome == OutcomeDone {
+			outcome = OutcomeApprovalDenied
+		}
+	}
+	doc["outcome"] = outcome
+}
@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TranscriptPath 返回审计文件对应的旁路 transcript 文件（每行一个 Exchange 的 JSONL）。
+func TranscriptPath(auditPath string) string {
+	return strings.TrimSuffix(auditPath, ".json") + ".transcript.jsonl"
+}
+
+func SaveTranscript(path string, exchanges []Exchange) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	for _, e := range exchanges {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+func LoadTranscript(path string) ([]Exchange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []Exchange
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var e Exchange
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("transcript %s:%d: %w", path, line, err)
+		}
+		out = append(out, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("transcript %s: %w", path, err)
+	}
+	return out, nil
+}
+
+// ReadTranscript 返回 run 的完整 transcript：内嵌时直接返回，写在旁路文件时从 auditPath 所在目录读取。
+func ReadTranscript(auditPath string, run Run) ([]Exchange, error) {
+	if run.TranscriptFile == "" {
+		return run.Transcript, nil
+	}
+	return LoadTranscript(filepath.Join(filepath.Dir(auditPath), run.TranscriptFile))
+}
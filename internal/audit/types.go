@@ -0,0 +1,168 @@
+package audit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/yangruihan/go-pi-pro/internal/fschange"
+)
+
+type Plan struct {
+	Goal  string     `json:"goal"`
+	Steps []PlanStep `json:"steps"`
+}
+
+type PlanStep struct {
+	ID               string                `json:"id" redact:"-"`
+	Title            string                `json:"title"`
+	Reason           string                `json:"reason"`
+	Risk             string                `json:"risk"`
+	RequiresApproval bool                  `json:"requires_approval"`
+	DependsOn        []string              `json:"depends_on,omitempty" redact:"-"`
+	Acceptance       []AcceptanceCriterion `json:"acceptance,omitempty"`
+}
+
+type AcceptanceCriterion struct {
+	Type     string `json:"type"`
+	Path     string `json:"path,omitempty" redact:"-"`
+	Pattern  string `json:"pattern,omitempty"`
+	Command  string `json:"command,omitempty"`
+	ExitCode int    `json:"exit_code,omitempty"`
+	JSONPath string `json:"json_path,omitempty"`
+	Value    any    `json:"value,omitempty"`
+}
+
+// AcceptanceResult 中 Skipped 表示条件未被校验（如未开启命令验收），不计为失败；
+// Policy 为 command_exit 命令的审批结果。
+type AcceptanceResult struct {
+	Criterion AcceptanceCriterion `json:"criterion"`
+	Passed    bool                `json:"passed"`
+	Skipped   bool                `json:"skipped,omitempty"`
+	Detail    string              `json:"detail,omitempty"`
+	Policy    *PolicyDecision     `json:"policy,omitempty"`
+}
+
+// ActionStepLog 记录一个步骤的执行结果。Status 为 todo 状态（done / blocked / skipped）；
+// Snapshot 为步骤开始前的 git 快照 ref；ChangesUnattributed 表示有尝试与其它步骤并发执行，其文件变更无法归属而未记录。
+type ActionStepLog struct {
+	StepID         string             `json:"step_id" redact:"-"`
+	Title          string             `json:"title"`
+	Status         string             `json:"status"`
+	Attempts       int                `json:"attempts"`
+	Output         string             `json:"output"`
+	ErrorText      string             `json:"error,omitempty"`
+	ToolCalls      int                `json:"tool_calls"`
+	WriteToolCalls int                `json:"write_tool_calls"`
+	Acceptance     []AcceptanceResult `json:"acceptance,omitempty"`
+	Snapshot       string             `json:"snapshot,omitempty" redact:"-"`
+	RolledBack     bool               `json:"rolled_back,omitempty"`
+	ApprovalDenied bool               `json:"approval_denied,omitempty"`
+	Changes        []fschange.Change  `json:"changes,omitempty"`
+	// 并发执行时变更无法归属到单个步骤
+	ChangesUnattributed bool            `json:"changes_unattributed,omitempty"`
+	Policy              *PolicyDecision `json:"policy,omitempty"`
+}
+
+type PolicyDecision struct {
+	Action   string `json:"action"`
+	Rule     string `json:"rule"`
+	Asked    bool   `json:"asked,omitempty"`
+	Approved bool   `json:"approved"`
+	At       string `json:"at"`
+}
+
+type ReplanRecord struct {
+	Round        int    `json:"round"`
+	At           string `json:"at"`
+	FailedStepID string `json:"failed_step_id" redact:"-"`
+	FailedTitle  string `json:"failed_title"`
+	Reason       string `json:"reason"`
+	PreviousPlan Plan   `json:"previous_plan"`
+	RevisedPlan  Plan   `json:"revised_plan"`
+	Error        string `json:"error,omitempty"`
+}
+
+type PlanReviewRecord struct {
+	Round    int    `json:"round"`
+	At       string `json:"at"`
+	Action   string `json:"action"`
+	Edited   bool   `json:"edited,omitempty"`
+	Feedback string `json:"feedback,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type CallUsage struct {
+	Phase        string  `json:"phase"`
+	StepID       string  `json:"step_id,omitempty" redact:"-"`
+	At           string  `json:"at"`
+	LatencyMs    int64   `json:"latency_ms"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Estimated    bool    `json:"estimated,omitempty"`
+	Cost         float64 `json:"cost,omitempty"`
+	Error        string  `json:"error,omitempty"`
+	// Redactions 为发送前在 prompt 中按规则替换的次数。
+	Redactions map[string]int `json:"redactions,omitempty"`
+}
+
+type PhaseUsage struct {
+	Calls        int     `json:"calls"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	LatencyMs    int64   `json:"latency_ms"`
+	Cost         float64 `json:"cost,omitempty"`
+}
+
+type UsageSummary struct {
+	Calls        int                   `json:"calls"`
+	InputTokens  int                   `json:"input_tokens"`
+	OutputTokens int                   `json:"output_tokens"`
+	TotalTokens  int                   `json:"total_tokens"`
+	LatencyMs    int64                 `json:"latency_ms"`
+	Estimated    bool                  `json:"estimated,omitempty"`
+	Cost         float64               `json:"estimated_cost,omitempty"`
+	Currency     string                `json:"currency,omitempty"`
+	ByPhase      map[string]PhaseUsage `json:"by_phase,omitempty"`
+}
+
+// Exchange 是一次 LLM 调用的完整 prompt 与原始响应。Seq 为调用结束的先后顺序（从 1 开始）；
+// Attempt 在 act 阶段为重试序号、在 repair 阶段为修复轮次，其余阶段为 0。
+type Exchange struct {
+	Seq       int    `json:"seq"`
+	Phase     string `json:"phase"`
+	StepID    string `json:"step_id,omitempty" redact:"-"`
+	Attempt   int    `json:"attempt,omitempty"`
+	At        string `json:"at"`
+	LatencyMs int64  `json:"latency_ms"`
+	Prompt    string `json:"prompt"`
+	Response  string `json:"response"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Redactions 统计脱敏替换次数：Audit 为写入审计前在整条记录中替换的次数，Prompts 为发送前在 prompt 中替换的次数，ByRule 合计两者。
+type Redactions struct {
+	Audit   int            `json:"audit"`
+	Prompts int            `json:"prompts,omitempty"`
+	ByRule  map[string]int `json:"by_rule,omitempty"`
+}
+
+const (
+	BudgetLLMCalls = "max_llm_calls"
+	BudgetTokens   = "max_tokens"
+	BudgetWallTime = "max_wall_time"
+)
+
+// BudgetExceeded 记录首个耗尽的预算。max_wall_time 的 Limit/Used 单位为毫秒。
+type BudgetExceeded struct {
+	Budget string `json:"budget"`
+	Limit  int64  `json:"limit"`
+	Used   int64  `json:"used"`
+	At     string `json:"at"`
+}
+
+func (b *BudgetExceeded) Error() string {
+	if b.Budget == BudgetWallTime {
+		return fmt.Sprintf("budget exhausted: %s (%s/%s)", b.Budget, time.Duration(b.Used)*time.Millisecond, time.Duration(b.Limit)*time.Millisecond)
+	}
+	return fmt.Sprintf("budget exhausted: %s (%d/%d)", b.Budget, b.Used, b.Limit)
+}
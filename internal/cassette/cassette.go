@@ -0,0 +1,217 @@
+package cassette
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/yangruihan/go-pi-pro/internal/usage"
+)
+
+const Version = 1
+
+type Interaction struct {
+	Seq            int    `json:"seq"`
+	At             string `json:"at"`
+	Prompt         string `json:"prompt"`
+	Response       string `json:"response"`
+	ToolCalls      int    `json:"tool_calls"`
+	WriteToolCalls int    `json:"write_tool_calls"`
+	Error          string `json:"error,omitempty"`
+	LatencyMs      int64  `json:"latency_ms"`
+	InputTokens    int    `json:"input_tokens,omitempty"`
+	OutputTokens   int    `json:"output_tokens,omitempty"`
+}
+
+type Cassette struct {
+	Version      int           `json:"version"`
+	CreatedAt    string        `json:"created_at"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+type asker interface {
+	Ask(ctx context.Context, prompt string) (string, error)
+}
+
+type statsAsker interface {
+	AskWithStats(ctx context.Context, prompt string) (string, int, int, error)
+}
+
+func Load(path string) (*Cassette, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("cassette %s: %w", path, err)
+	}
+	if c.Version != Version {
+		return nil, fmt.Errorf("cassette %s: unsupported version %d", path, c.Version)
+	}
+	return &c, nil
+}
+
+func (c *Cassette) Save(path string) error {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Recorder 透传调用到内部 LLM，并在每次调用后把完整的交互追加写入 cassette 文件，
+// 即使运行中途崩溃，已完成的调用也保留在文件中。
+type Recorder struct {
+	inner asker
+	path  string
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+func NewRecorder(inner asker, path string) *Recorder {
+	return &Recorder{
+		inner:    inner,
+		path:     path,
+		cassette: Cassette{Version: Version, CreatedAt: time.Now().Format(time.RFC3339), Interactions: make([]Interaction, 0)},
+	}
+}
+
+func (r *Recorder) Ask(ctx context.Context, prompt string) (string, error) {
+	start := time.Now()
+	text, err := r.inner.Ask(ctx, prompt)
+	if rerr := r.record(ctx, prompt, text, -1, -1, err, start); rerr != nil && err == nil {
+		return "", rerr
+	}
+	return text, err
+}
+
+func (r *Recorder) AskWithStats(ctx context.Context, prompt string) (string, int, int, error) {
+	withStats, ok := r.inner.(statsAsker)
+	if !ok {
+		text, err := r.Ask(ctx, prompt)
+		return text, -1, -1, err
+	}
+	start := time.Now()
+	text, toolCalls, writeToolCalls, err := withStats.AskWithStats(ctx, prompt)
+	if rerr := r.record(ctx, prompt, text, toolCalls, writeToolCalls, err, start); rerr != nil && err == nil {
+		return "", 0, 0, rerr
+	}
+	return text, toolCalls, writeToolCalls, err
+}
+
+func (r *Recorder) Path() string {
+	return r.path
+}
+
+func (r *Recorder) record(ctx context.Context, prompt, text string, toolCalls, writeToolCalls int, err error, start time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	it := Interaction{
+		Seq:            len(r.cassette.Interactions) + 1,
+		At:             start.Format(time.RFC3339Nano),
+		Prompt:         prompt,
+		Response:       text,
+		ToolCalls:      toolCalls,
+		WriteToolCalls: writeToolCalls,
+		LatencyMs:      time.Since(start).Milliseconds(),
+	}
+	if tokens, ok := usage.Reported(ctx); ok {
+		it.InputTokens, it.OutputTokens = tokens.Input, tokens.Output
+	}
+	if err != nil {
+		it.Error = err.Error()
+	}
+	r.cassette.Interactions = append(r.cassette.Interactions, it)
+	if serr := r.cassette.Save(r.path); serr != nil {
+		return fmt.Errorf("record cassette: %w", serr)
+	}
+	return nil
+}
+
+// Replayer 按 cassette 回放响应：优先匹配 prompt 完全相同且未使用过的交互，
+// 找不到时按录制顺序取下一条未使用的交互并计入 Misses（并行步骤或 todo 状态不同会导致 prompt 细微差异）。
+type Replayer struct {
+	mu     sync.Mutex
+	items  []Interaction
+	used   []bool
+	misses int
+}
+
+func NewReplayer(c *Cassette) *Replayer {
+	return &Replayer{items: c.Interactions, used: make([]bool, len(c.Interactions))}
+}
+
+func (r *Replayer) Ask(ctx context.Context, prompt string) (string, error) {
+	text, _, _, err := r.AskWithStats(ctx, prompt)
+	return text, err
+}
+
+func (r *Replayer) AskWithStats(ctx context.Context, prompt string) (string, int, int, error) {
+	if err := ctx.Err(); err != nil {
+		return "", 0, 0, err
+	}
+	it, ok := r.next(prompt)
+	if !ok {
+		return "", 0, 0, errors.New("cassette exhausted: no recorded interaction left")
+	}
+	if it.InputTokens > 0 || it.OutputTokens > 0 {
+		usage.Report(ctx, it.InputTokens, it.OutputTokens)
+	}
+	if it.Error != "" {
+		return "", it.ToolCalls, it.WriteToolCalls, errors.New(it.Error)
+	}
+	return it.Response, it.ToolCalls, it.WriteToolCalls, nil
+}
+
+func (r *Replayer) Misses() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.misses
+}
+
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, u := range r.used {
+		if !u {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *Replayer) next(prompt string) (Interaction, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, it := range r.items {
+		if !r.used[i] && it.Prompt == prompt {
+			r.used[i] = true
+			return it, true
+		}
+	}
+	for i, it := range r.items {
+		if !r.used[i] {
+			r.used[i] = true
+			r.misses++
+			return it, true
+		}
+	}
+	return Interaction{}, false
+}
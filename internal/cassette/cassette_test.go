@@ -0,0 +1,100 @@
+package cassette
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/yangruihan/go-pi-pro/internal/usage"
+)
+
+type fakeLLM struct {
+	calls int
+}
+
+func (f *fakeLLM) Ask(_ context.Context, prompt string) (string, error) {
+	text, _, _, err := f.AskWithStats(context.Background(), prompt)
+	return text, err
+}
+
+func (f *fakeLLM) AskWithStats(_ context.Context, prompt string) (string, int, int, error) {
+	f.calls++
+	if prompt == "fail" {
+		return "", 0, 0, errors.New("upstream down")
+	}
+	return "re:" + prompt, 2, 1, nil
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.cassette.json")
+	inner := &fakeLLM{}
+	rec := NewRecorder(inner, path)
+	ctx := context.Background()
+	if out, err := rec.Ask(ctx, "a"); err != nil || out != "re:a" {
+		t.Fatalf("record ask: %q %v", out, err)
+	}
+	if out, tc, wtc, err := rec.AskWithStats(ctx, "b"); err != nil || out != "re:b" || tc != 2 || wtc != 1 {
+		t.Fatalf("record ask with stats: %q %d %d %v", out, tc, wtc, err)
+	}
+	if _, err := rec.Ask(ctx, "fail"); err == nil {
+		t.Fatalf("expected inner error to pass through")
+	}
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(c.Interactions) != 3 || c.Interactions[2].Error != "upstream down" {
+		t.Fatalf("unexpected cassette: %#v", c.Interactions)
+	}
+
+	rep := NewReplayer(c)
+	if out, tc, wtc, err := rep.AskWithStats(ctx, "b"); err != nil || out != "re:b" || tc != 2 || wtc != 1 {
+		t.Fatalf("replay b: %q %d %d %v", out, tc, wtc, err)
+	}
+	if _, err := rep.Ask(ctx, "fail"); err == nil || err.Error() != "upstream down" {
+		t.Fatalf("replay should reproduce recorded error, got %v", err)
+	}
+	if out, err := rep.Ask(ctx, "a changed prompt"); err != nil || out != "re:a" {
+		t.Fatalf("replay fallback: %q %v", out, err)
+	}
+	if rep.Misses() != 1 || rep.Remaining() != 0 {
+		t.Fatalf("misses=%d remaining=%d", rep.Misses(), rep.Remaining())
+	}
+	if _, err := rep.Ask(ctx, "extra"); err == nil {
+		t.Fatalf("expected exhausted cassette error")
+	}
+	if inner.calls != 3 {
+		t.Fatalf("replay must not call the live LLM, calls=%d", inner.calls)
+	}
+}
+
+type usageLLM struct{}
+
+func (usageLLM) Ask(ctx context.Context, prompt string) (string, error) {
+	usage.Report(ctx, 12, 34)
+	return "ok", nil
+}
+
+func TestRecordReplayTokenUsage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.cassette.json")
+	ctx, sink := usage.WithSink(context.Background())
+	if _, err := NewRecorder(usageLLM{}, path).Ask(ctx, "p"); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if tokens, ok := sink.Tokens(); !ok || tokens.Input != 12 {
+		t.Fatalf("recorder should pass usage through: %#v %v", tokens, ok)
+	}
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	replayCtx, replaySink := usage.WithSink(context.Background())
+	if _, err := NewReplayer(c).Ask(replayCtx, "p"); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if tokens, ok := replaySink.Tokens(); !ok || tokens != (usage.Tokens{Input: 12, Output: 34}) {
+		t.Fatalf("replay should report recorded usage: %#v %v", tokens, ok)
+	}
+}
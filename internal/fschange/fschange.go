@@ -0,0 +1,267 @@
+package fschange
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	KindCreated  = "created"
+	KindModified = "modified"
+	KindDeleted  = "deleted"
+)
+
+const (
+	defaultMaxHashBytes = 16 << 20
+	defaultMaxTextBytes = 256 << 10
+	defaultMaxTotalText = 32 << 20
+	racyWindow          = 2 * time.Second
+)
+
+var DefaultIgnore = []string{".git", ".gopi-pro", "node_modules", ".venv", "__pycache__", ".idea", ".vscode"}
+
+type Options struct {
+	// Ignore 中的模式按 path.Match 匹配相对路径或任一路径段，例如 "build"、"*.log"、"dist/*.js"。
+	Ignore       []string
+	MaxHashBytes int64
+	// MaxTextBytes 为单个文件保留文本的上限，MaxTotalText 为一个快照保留文本的总量上限，超出的文件不生成 diff。
+	MaxTextBytes int64
+	MaxTotalText int64
+	// IncludeGitignored 为 true 时不跳过 .gitignore 忽略的文件（默认在 git 仓库中跳过）。
+	IncludeGitignored bool
+}
+
+type Entry struct {
+	Size    int64
+	ModTime time.Time
+	Hash    string
+	text    []byte
+	isText  bool
+}
+
+type Snapshot struct {
+	Root  string
+	Taken time.Time
+	Files map[string]Entry
+}
+
+type Change struct {
+	Path       string `json:"path" redact:"-"`
+	Kind       string `json:"kind"`
+	Attempt    int    `json:"attempt,omitempty"`
+	SizeBefore int64  `json:"size_before,omitempty"`
+	SizeAfter  int64  `json:"size_after,omitempty"`
+	HashBefore string `json:"hash_before,omitempty" redact:"-"`
+	HashAfter  string `json:"hash_after,omitempty" redact:"-"`
+	Diff       string `json:"diff,omitempty"`
+}
+
+func Take(root string, opts Options) (Snapshot, error) {
+	return Update(Snapshot{}, root, opts)
+}
+
+// Update 基于 prev 重新快照 root：大小与 mtime 都未变的文件沿用 prev 中的哈希与文本，只读取发生变化的文件。
+// mtime 落在 prev 拍摄前 racyWindow 内的文件仍会重新读取，以免同一时间粒度内的改写被漏掉。
+func Update(prev Snapshot, root string, opts Options) (Snapshot, error) {
+	opts = withDefaults(opts)
+	if prev.Root != root {
+		prev = Snapshot{}
+	}
+	snap := Snapshot{Root: root, Taken: time.Now(), Files: make(map[string]Entry)}
+	gitignored := map[string]bool{}
+	if !opts.IncludeGitignored {
+		gitignored = gitIgnored(root)
+	}
+	textBudget := opts.MaxTotalText
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			return nil
+		}
+		rel, rerr := filepath.Rel(root, p)
+		if rerr != nil || rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if ignored(rel, opts.Ignore) || gitignored[rel+"/"] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ignored(rel, opts.Ignore) || gitignored[rel] || !d.Type().IsRegular() {
+			return nil
+		}
+		info, ierr := d.Info()
+		if ierr != nil {
+			return nil
+		}
+		if old, ok := prev.Files[rel]; ok && old.Size == info.Size() && old.ModTime.Equal(info.ModTime()) &&
+			old.ModTime.Before(prev.Taken.Add(-racyWindow)) && int64(len(old.text)) <= textBudget {
+			textBudget -= int64(len(old.text))
+			snap.Files[rel] = old
+			return nil
+		}
+		entry := Entry{Size: info.Size(), ModTime: info.ModTime()}
+		if info.Size() <= opts.MaxHashBytes {
+			keepText := info.Size() <= opts.MaxTextBytes && info.Size() <= textBudget
+			entry.Hash, entry.text, entry.isText = readEntry(p, keepText)
+			textBudget -= int64(len(entry.text))
+		}
+		snap.Files[rel] = entry
+		return nil
+	})
+	return snap, err
+}
+
+// gitIgnored 返回 root 下被 .gitignore 忽略的路径（目录以 / 结尾）；不在 git 仓库中或没有 git 时为空。
+func gitIgnored(root string) map[string]bool {
+	out := map[string]bool{}
+	cmd := exec.Command("git", "-C", root, "ls-files", "-z", "--others", "--ignored", "--exclude-standard", "--directory")
+	b, err := cmd.Output()
+	if err != nil {
+		return out
+	}
+	for _, p := range strings.Split(string(b), "\x00") {
+		if p != "" {
+			out[p] = true
+		}
+	}
+	return out
+}
+
+func Compare(before, after Snapshot) []Change {
+	changes := make([]Change, 0)
+	for p, b := range before.Files {
+		a, ok := after.Files[p]
+		if !ok {
+			c := Change{Path: p, Kind: KindDeleted, SizeBefore: b.Size, HashBefore: b.Hash}
+			if b.isText {
+				c.Diff = UnifiedDiff(p, string(b.text), "")
+			}
+			changes = append(changes, c)
+			continue
+		}
+		if !modified(b, a) {
+			continue
+		}
+		c := Change{Path: p, Kind: KindModified, SizeBefore: b.Size, SizeAfter: a.Size, HashBefore: b.Hash, HashAfter: a.Hash}
+		if b.isText && a.isText {
+			c.Diff = UnifiedDiff(p, string(b.text), string(a.text))
+		}
+		changes = append(changes, c)
+	}
+	for p, a := range after.Files {
+		if _, ok := before.Files[p]; ok {
+			continue
+		}
+		c := Change{Path: p, Kind: KindCreated, SizeAfter: a.Size, HashAfter: a.Hash}
+		if a.isText {
+			c.Diff = UnifiedDiff(p, "", string(a.text))
+		}
+		changes = append(changes, c)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func Summary(changes []Change) string {
+	var created, modifiedCount, deleted int
+	for _, c := range changes {
+		switch c.Kind {
+		case KindCreated:
+			created++
+		case KindModified:
+			modifiedCount++
+		case KindDeleted:
+			deleted++
+		}
+	}
+	return fmt.Sprintf("+%d created, ~%d modified, -%d deleted", created, modifiedCount, deleted)
+}
+
+func modified(b, a Entry) bool {
+	if b.Hash != "" && a.Hash != "" {
+		return b.Hash != a.Hash
+	}
+	return b.Size != a.Size || !b.ModTime.Equal(a.ModTime)
+}
+
+func readEntry(p string, keepText bool) (string, []byte, bool) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", nil, false
+	}
+	defer f.Close()
+	h := sha256.New()
+	var buf bytes.Buffer
+	var w io.Writer = h
+	if keepText {
+		w = io.MultiWriter(h, &buf)
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		return "", nil, false
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	if !keepText || !isText(buf.Bytes()) {
+		return sum, nil, false
+	}
+	return sum, buf.Bytes(), true
+}
+
+func isText(b []byte) bool {
+	probe := b
+	if len(probe) > 8000 {
+		probe = probe[:8000]
+	}
+	return bytes.IndexByte(probe, 0) < 0 && utf8.Valid(b)
+}
+
+func ignored(rel string, patterns []string) bool {
+	segments := strings.Split(rel, "/")
+	for _, pat := range patterns {
+		pat = strings.Trim(filepath.ToSlash(strings.TrimSpace(pat)), "/")
+		if pat == "" {
+			continue
+		}
+		if ok, _ := path.Match(pat, rel); ok {
+			return true
+		}
+		for _, seg := range segments {
+			if ok, _ := path.Match(pat, seg); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func withDefaults(opts Options) Options {
+	if opts.Ignore == nil {
+		opts.Ignore = DefaultIgnore
+	}
+	if opts.MaxHashBytes <= 0 {
+		opts.MaxHashBytes = defaultMaxHashBytes
+	}
+	if opts.MaxTextBytes <= 0 {
+		opts.MaxTextBytes = defaultMaxTextBytes
+	}
+	if opts.MaxTotalText <= 0 {
+		opts.MaxTotalText = defaultMaxTotalText
+	}
+	return opts
+}
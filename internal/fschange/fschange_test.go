@@ -0,0 +1,170 @@
+package fschange
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func write(t *testing.T, dir, name, content string) {
+	t.Helper()
+	p := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func TestTakeAndCompare(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, "keep.txt", "same\n")
+	write(t, dir, "edit.txt", "a\nb\nc\n")
+	write(t, dir, "gone.txt", "bye\n")
+	write(t, dir, "node_modules/x.js", "ignored")
+	write(t, dir, "logs/app.log", "ignored")
+
+	opts := Options{Ignore: append([]string{"*.log"}, DefaultIgnore...)}
+	before, err := Take(dir, opts)
+	if err != nil {
+		t.Fatalf("take: %v", err)
+	}
+	if _, ok := before.Files["node_modules/x.js"]; ok {
+		t.Fatalf("ignored dir should be skipped")
+	}
+	if _, ok := before.Files["logs/app.log"]; ok {
+		t.Fatalf("ignored pattern should be skipped")
+	}
+
+	write(t, dir, "edit.txt", "a\nB\nc\n")
+	write(t, dir, "sub/new.txt", "hello\n")
+	write(t, dir, "bin.dat", "\x00\x01\x02")
+	if err := os.Remove(filepath.Join(dir, "gone.txt")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	write(t, dir, "logs/app.log", "changed")
+
+	after, err := Take(dir, opts)
+	if err != nil {
+		t.Fatalf("take: %v", err)
+	}
+	changes := Compare(before, after)
+	got := make([]string, 0, len(changes))
+	for _, c := range changes {
+		got = append(got, c.Kind+":"+c.Path)
+	}
+	want := "created:bin.dat,modified:edit.txt,deleted:gone.txt,created:sub/new.txt"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("unexpected changes: %v", got)
+	}
+	if changes[0].Diff != "" {
+		t.Fatalf("binary file should have no diff")
+	}
+	if !strings.Contains(changes[1].Diff, "-b\n+B\n") || !strings.Contains(changes[1].Diff, "@@ -1,3 +1,3 @@") {
+		t.Fatalf("unexpected diff: %s", changes[1].Diff)
+	}
+	if !strings.Contains(changes[3].Diff, "--- /dev/null") || !strings.Contains(changes[3].Diff, "+hello") {
+		t.Fatalf("unexpected created diff: %s", changes[3].Diff)
+	}
+	if Summary(changes) != "+2 created, ~1 modified, -1 deleted" {
+		t.Fatalf("unexpected summary: %s", Summary(changes))
+	}
+}
+
+func TestUnifiedDiffSplitsDistantHunks(t *testing.T) {
+	before := make([]string, 0, 20)
+	for i := 0; i < 20; i++ {
+		before = append(before, "line")
+	}
+	after := append([]string(nil), before...)
+	after[1] = "first"
+	after[18] = "second"
+	diff := UnifiedDiff("f.txt", strings.Join(before, "\n"), strings.Join(after, "\n"))
+	if strings.Count(diff, "@@ -") != 2 {
+		t.Fatalf("expected two hunks: %s", diff)
+	}
+}
+
+func TestUpdateReusesUnchangedEntries(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, "old.txt", "aaaa\n")
+	write(t, dir, "big.txt", "bbbb\n")
+	old := time.Now().Add(-time.Hour)
+	for _, name := range []string{"old.txt", "big.txt"} {
+		if err := os.Chtimes(filepath.Join(dir, name), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prev, err := Take(dir, Options{})
+	if err != nil {
+		t.Fatalf("take: %v", err)
+	}
+	// 大小与 mtime 都不变时沿用旧哈希，不重新读取
+	write(t, dir, "old.txt", "cccc\n")
+	if err := os.Chtimes(filepath.Join(dir, "old.txt"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	write(t, dir, "big.txt", "dddd\n")
+	snap, err := Update(prev, dir, Options{})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if snap.Files["old.txt"].Hash != prev.Files["old.txt"].Hash {
+		t.Fatalf("unchanged size and mtime should reuse the previous hash")
+	}
+	if snap.Files["big.txt"].Hash == prev.Files["big.txt"].Hash {
+		t.Fatalf("changed mtime should be re-read")
+	}
+
+	// 刚写入（mtime 在上次快照附近）的文件每次都重新读取
+	racy, err := Take(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(t, dir, "big.txt", "eeee\n")
+	if err := os.Chtimes(filepath.Join(dir, "big.txt"), racy.Files["big.txt"].ModTime, racy.Files["big.txt"].ModTime); err != nil {
+		t.Fatal(err)
+	}
+	if snap, err = Update(racy, dir, Options{}); err != nil || snap.Files["big.txt"].Hash == racy.Files["big.txt"].Hash {
+		t.Fatalf("racily clean file should be re-read: %v", err)
+	}
+}
+
+func TestTakeLimitsTextAndSkipsGitignored(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, "a.txt", "0123456789\n")
+	write(t, dir, "b.txt", "0123456789\n")
+	snap, err := Take(dir, Options{MaxTotalText: 15})
+	if err != nil {
+		t.Fatalf("take: %v", err)
+	}
+	if !snap.Files["a.txt"].isText || snap.Files["b.txt"].isText || snap.Files["b.txt"].Hash == "" {
+		t.Fatalf("text beyond the total budget should be hashed but not kept: %#v", snap.Files)
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	if out, err := exec.Command("git", "-C", dir, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v %s", err, out)
+	}
+	write(t, dir, ".gitignore", "build/\n*.tmp\n")
+	write(t, dir, "build/out.bin", "x")
+	write(t, dir, "scratch.tmp", "x")
+	if snap, err = Take(dir, Options{}); err != nil {
+		t.Fatalf("take: %v", err)
+	}
+	if _, ok := snap.Files["build/out.bin"]; ok {
+		t.Fatalf("gitignored dir should be skipped: %#v", snap.Files)
+	}
+	if _, ok := snap.Files["scratch.tmp"]; ok {
+		t.Fatalf("gitignored file should be skipped: %#v", snap.Files)
+	}
+	if snap, err = Take(dir, Options{IncludeGitignored: true}); err != nil || len(snap.Files) != 5 {
+		t.Fatalf("IncludeGitignored should keep ignored files: %#v %v", snap.Files, err)
+	}
+}
@@ -0,0 +1,247 @@
+package gitsnap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const RefPrefix = "refs/gopi-pro/snapshots"
+
+// stateDir 是 gopi-pro 自身的状态目录（审计、检查点），快照与回滚都不触碰它。
+const stateDir = ".gopi-pro"
+
+var refUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func RefName(runID, name string) string {
+	clean := func(s string) string {
+		s = refUnsafe.ReplaceAllString(strings.TrimSpace(s), "_")
+		s = strings.Trim(s, "._")
+		if s == "" {
+			s = "_"
+		}
+		return s
+	}
+	return fmt.Sprintf("%s/%s/%s", RefPrefix, clean(runID), clean(name))
+}
+
+func IsRepo(ctx context.Context, dir string) bool {
+	out, err := git(ctx, dir, nil, "rev-parse", "--is-inside-work-tree")
+	return err == nil && strings.TrimSpace(out) == "true"
+}
+
+func Exists(ctx context.Context, dir, ref string) bool {
+	_, err := git(ctx, dir, nil, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	return err == nil
+}
+
+// Snapshot 把 dir 下的工作区（含未跟踪文件，不含忽略文件、.gopi-pro 与 exclude 中的路径）写成一个影子提交并指向 ref，
+// 使用临时 index，不改动用户的 index、HEAD 与分支。
+func Snapshot(ctx context.Context, dir, ref, message string, exclude ...string) (string, error) {
+	top, spec, err := scope(ctx, dir, exclude)
+	if err != nil {
+		return "", err
+	}
+	tree, err := worktreeTree(ctx, top, spec)
+	if err != nil {
+		return "", err
+	}
+	args := []string{"commit-tree", tree, "-m", message}
+	if head, herr := git(ctx, top, nil, "rev-parse", "--verify", "--quiet", "HEAD"); herr == nil {
+		args = append(args, "-p", strings.TrimSpace(head))
+	}
+	commit, err := git(ctx, top, identityEnv(), args...)
+	if err != nil {
+		return "", err
+	}
+	commit = strings.TrimSpace(commit)
+	if _, err := git(ctx, top, nil, "update-ref", ref, commit); err != nil {
+		return "", err
+	}
+	return commit, nil
+}
+
+// Restore 把 dir 下的工作区恢复到 ref 指向的快照：快照中的文件被还原，快照之后新增的文件被删除。
+// 范围与排除规则同 Snapshot，dir 之外与被排除的文件不受影响。
+func Restore(ctx context.Context, dir, ref string, exclude ...string) error {
+	top, spec, err := scope(ctx, dir, exclude)
+	if err != nil {
+		return err
+	}
+	snapTree, err := git(ctx, top, nil, "rev-parse", "--verify", ref+"^{tree}")
+	if err != nil {
+		return fmt.Errorf("snapshot %s not found", ref)
+	}
+	snapTree = strings.TrimSpace(snapTree)
+	curTree, err := worktreeTree(ctx, top, spec)
+	if err != nil {
+		return err
+	}
+
+	added, err := git(ctx, top, nil, append([]string{"diff-tree", "-r", "-z", "--name-only", "--no-renames", "--diff-filter=A", snapTree, curTree, "--"}, spec...)...)
+	if err != nil {
+		return err
+	}
+	for _, p := range strings.Split(added, "\x00") {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		if err := os.Remove(filepath.Join(top, filepath.FromSlash(p))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return withTempIndex(func(env []string) error {
+		if _, err := git(ctx, top, env, "read-tree", snapTree); err != nil {
+			return err
+		}
+		// 旧快照可能包含整个仓库，只检出范围内的文件
+		files, err := git(ctx, top, env, append([]string{"ls-files", "-z", "--"}, spec...)...)
+		if err != nil {
+			return err
+		}
+		_, err = gitInput(ctx, top, env, files, "checkout-index", "-f", "-z", "--stdin")
+		return err
+	})
+}
+
+func List(ctx context.Context, dir, runID string) ([]string, error) {
+	prefix := strings.TrimSuffix(RefName(runID, "x"), "/x")
+	out, err := git(ctx, dir, nil, "for-each-ref", "--format=%(refname)", prefix)
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]string, 0)
+	for _, line := range strings.Split(out, "\n") {
+		if v := strings.TrimSpace(line); v != "" {
+			refs = append(refs, v)
+		}
+	}
+	return refs, nil
+}
+
+// scope 返回仓库根目录与限定快照范围的 pathspec：dir 相对根目录的路径，排除根目录与 dir 下的 .gopi-pro
+// 以及 exclude 中位于 dir 内的路径（如自定义的审计目录）。
+func scope(ctx context.Context, dir string, exclude []string) (string, []string, error) {
+	top, err := toplevel(ctx, dir)
+	if err != nil {
+		return "", nil, err
+	}
+	top = filepath.FromSlash(top)
+	rel, ok := relPath(top, dir)
+	if !ok {
+		return "", nil, fmt.Errorf("%s is outside the git work tree %s", dir, top)
+	}
+	spec := []string{":(literal)" + rel, ":(exclude,literal)" + stateDir}
+	if rel != "." {
+		spec = append(spec, ":(exclude,literal)"+path.Join(rel, stateDir))
+	}
+	for _, e := range exclude {
+		if strings.TrimSpace(e) == "" {
+			continue
+		}
+		if r, ok := relPath(top, e); ok && r != "." {
+			spec = append(spec, ":(exclude,literal)"+r)
+		}
+	}
+	return top, spec, nil
+}
+
+// relPath 返回 p 相对 top 的 slash 路径；p 不在 top 内时 ok 为 false。
+func relPath(top, p string) (string, bool) {
+	rel, err := filepath.Rel(top, realPath(p))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// realPath 返回解析符号链接后的绝对路径；p 可能尚不存在（如审计目录），此时解析其已存在的上级目录。
+func realPath(p string) string {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return p
+	}
+	rest := ""
+	for cur := abs; ; {
+		if resolved, err := filepath.EvalSymlinks(cur); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		parent := filepath.Dir(cur)
+		if parent == cur {
+			return abs
+		}
+		rest = filepath.Join(filepath.Base(cur), rest)
+		cur = parent
+	}
+}
+
+func worktreeTree(ctx context.Context, top string, spec []string) (string, error) {
+	var tree string
+	err := withTempIndex(func(env []string) error {
+		if _, err := git(ctx, top, env, append([]string{"add", "-A", "--"}, spec...)...); err != nil {
+			return err
+		}
+		out, err := git(ctx, top, env, "write-tree")
+		tree = strings.TrimSpace(out)
+		return err
+	})
+	return tree, err
+}
+
+func withTempIndex(fn func(env []string) error) error {
+	f, err := os.CreateTemp("", "gopi-pro-index-*")
+	if err != nil {
+		return err
+	}
+	path := f.Name()
+	_ = f.Close()
+	_ = os.Remove(path)
+	defer os.Remove(path)
+	return fn([]string{"GIT_INDEX_FILE=" + path})
+}
+
+func toplevel(ctx context.Context, dir string) (string, error) {
+	out, err := git(ctx, dir, nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func identityEnv() []string {
+	return []string{
+		"GIT_AUTHOR_NAME=gopi-pro", "GIT_AUTHOR_EMAIL=gopi-pro@localhost",
+		"GIT_COMMITTER_NAME=gopi-pro", "GIT_COMMITTER_EMAIL=gopi-pro@localhost",
+	}
+}
+
+func git(ctx context.Context, dir string, env []string, args ...string) (string, error) {
+	return gitInput(ctx, dir, env, "", args...)
+}
+
+func gitInput(ctx context.Context, dir string, env []string, stdin string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	var out, errOut bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errOut
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(errOut.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s failed: %s", args[0], msg)
+	}
+	return out.String(), nil
+}
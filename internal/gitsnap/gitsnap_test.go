@@ -0,0 +1,176 @@
+package gitsnap
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func initRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	ctx := context.Background()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"config", "user.email", "t@example.com"},
+		{"config", "user.name", "t"},
+	} {
+		if _, err := git(ctx, dir, nil, args...); err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+	}
+	writeFile(t, dir, "tracked.txt", "v1")
+	writeFile(t, dir, ".gitignore", "ignored.txt\n")
+	if _, err := git(ctx, dir, nil, "add", "-A"); err != nil {
+		t.Fatalf("git add: %v", err)
+	}
+	if _, err := git(ctx, dir, nil, "commit", "-q", "-m", "init"); err != nil {
+		t.Fatalf("git commit: %v", err)
+	}
+	return dir
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func readFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return string(b)
+}
+
+func TestRefName(t *testing.T) {
+	if got := RefName("20250101-120000", "s 1/x"); got != RefPrefix+"/20250101-120000/s_1_x" {
+		t.Fatalf("unexpected ref: %s", got)
+	}
+}
+
+func TestSnapshotAndRestore(t *testing.T) {
+	dir := initRepo(t)
+	ctx := context.Background()
+	if !IsRepo(ctx, dir) {
+		t.Fatalf("expected git repo")
+	}
+	if IsRepo(ctx, t.TempDir()) {
+		t.Fatalf("plain dir should not be a repo")
+	}
+
+	writeFile(t, dir, "untracked.txt", "keep me")
+	ref := RefName("run1", "s1")
+	if _, err := Snapshot(ctx, dir, ref, "before s1"); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if !Exists(ctx, dir, ref) {
+		t.Fatalf("snapshot ref missing")
+	}
+	status, err := git(ctx, dir, nil, "status", "--porcelain")
+	if err != nil || !strings.Contains(status, "?? untracked.txt") {
+		t.Fatalf("snapshot must not touch the index: %q %v", status, err)
+	}
+
+	writeFile(t, dir, "tracked.txt", "v2")
+	writeFile(t, dir, "new/created.txt", "new")
+	writeFile(t, dir, "ignored.txt", "ignored")
+	writeFile(t, dir, ".gopi-pro/runs/run-x.json", "{}")
+	if err := os.Remove(filepath.Join(dir, "untracked.txt")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+
+	if err := Restore(ctx, dir, ref); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if got := readFile(t, dir, "tracked.txt"); got != "v1" {
+		t.Fatalf("tracked file not restored: %s", got)
+	}
+	if got := readFile(t, dir, "untracked.txt"); got != "keep me" {
+		t.Fatalf("deleted file not restored: %s", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new", "created.txt")); !os.IsNotExist(err) {
+		t.Fatalf("created file should be removed: %v", err)
+	}
+	if got := readFile(t, dir, "ignored.txt"); got != "ignored" {
+		t.Fatalf("ignored file must be untouched")
+	}
+	if got := readFile(t, dir, ".gopi-pro/runs/run-x.json"); got != "{}" {
+		t.Fatalf("state dir must be untouched")
+	}
+
+	refs, err := List(ctx, dir, "run1")
+	if err != nil || len(refs) != 1 || refs[0] != ref {
+		t.Fatalf("unexpected refs: %v %v", refs, err)
+	}
+	if err := Restore(ctx, dir, RefName("run1", "missing")); err == nil {
+		t.Fatalf("expected error for missing snapshot")
+	}
+}
+
+func TestSnapshotRestoreLimitedToSubdirectory(t *testing.T) {
+	repo := initRepo(t)
+	ctx := context.Background()
+	writeFile(t, repo, "app/main.txt", "v1")
+	writeFile(t, repo, "other/keep.txt", "v1")
+	dir := filepath.Join(repo, "app")
+	audits := filepath.Join(dir, "audits")
+
+	ref := RefName("run1", "s1")
+	if _, err := Snapshot(ctx, dir, ref, "before s1", audits); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	writeFile(t, repo, "app/main.txt", "v2")
+	writeFile(t, repo, "app/new.txt", "new")
+	writeFile(t, repo, "app/audits/run-x.json", "{}")
+	writeFile(t, repo, "app/.gopi-pro/runs/run-y.json", "{}")
+	writeFile(t, repo, "other/keep.txt", "v2")
+	writeFile(t, repo, "other/new.txt", "new")
+
+	if err := Restore(ctx, dir, ref, audits); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if got := readFile(t, repo, "app/main.txt"); got != "v1" {
+		t.Fatalf("file in working dir not restored: %s", got)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "app", "new.txt")); !os.IsNotExist(err) {
+		t.Fatalf("created file in working dir should be removed: %v", err)
+	}
+	for name, want := range map[string]string{
+		"app/audits/run-x.json":         "{}",
+		"app/.gopi-pro/runs/run-y.json": "{}",
+		"other/keep.txt":                "v2",
+		"other/new.txt":                 "new",
+	} {
+		if got := readFile(t, repo, name); got != want {
+			t.Fatalf("%s outside the snapshot scope was changed: %q", name, got)
+		}
+	}
+
+	// 旧版快照覆盖整个仓库，恢复时同样只作用于 dir
+	whole := RefName("run1", "whole")
+	if _, err := Snapshot(ctx, repo, whole, "whole repo"); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	writeFile(t, repo, "other/keep.txt", "v3")
+	writeFile(t, repo, "app/main.txt", "v3")
+	if err := Restore(ctx, dir, whole, audits); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if readFile(t, repo, "other/keep.txt") != "v3" || readFile(t, repo, "app/main.txt") != "v1" {
+		t.Fatalf("restore of a whole-repo snapshot should only touch dir")
+	}
+}
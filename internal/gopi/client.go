@@ -95,6 +95,7 @@ func (c *Client) AskWithStats(ctx context.Context, prompt string) (string, int,
 		if err != nil {
 			return "", 0, 0, err
 		}
+		// SDK 元数据只有工具调用统计，没有 token 用量，由调用方用分词器估算
 		return text, meta.ToolCallCount(), meta.WriteToolCallCount(), nil
 	}
 
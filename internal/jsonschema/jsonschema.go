@@ -0,0 +1,202 @@
+// Package jsonschema 实现 JSON Schema（draft 2020-12）中校验 LLM 结构化输出所需的子集：
+// type、properties、required、additionalProperties、items、minItems、maxItems、enum、minLength、pattern。
+// 不支持的关键字会被忽略。
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type Schema map[string]any
+
+// Error 是一条带 JSON 路径的校验错误，例如 $.steps[1].risk。
+type Error struct {
+	Path    string
+	Message string
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+func Parse(data []byte) (Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ValidateJSON 解析 data 并校验，JSON 本身无效时返回一条位于 $ 的错误。
+func (s Schema) ValidateJSON(data []byte) []Error {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return []Error{{Path: "$", Message: fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+	return s.Validate(doc)
+}
+
+// Validate 校验 encoding/json 解码出的值，返回全部错误（按出现顺序）。
+func (s Schema) Validate(doc any) []Error {
+	var errs []Error
+	validate(s, doc, "$", &errs)
+	return errs
+}
+
+func validate(s map[string]any, v any, path string, errs *[]Error) {
+	add := func(format string, args ...any) {
+		*errs = append(*errs, Error{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	if t, ok := s["type"]; ok && !matchesType(t, v) {
+		add("expected %s, got %s", typeNames(t), typeOf(v))
+		return
+	}
+	if enum, ok := s["enum"].([]any); ok && !inEnum(enum, v) {
+		b, _ := json.Marshal(enum)
+		add("value %s is not one of %s", jsonString(v), string(b))
+	}
+	switch t := v.(type) {
+	case string:
+		if n, ok := number(s["minLength"]); ok && float64(len([]rune(t))) < n {
+			add("must be at least %d characters", int(n))
+		}
+		if p, ok := s["pattern"].(string); ok {
+			if re, err := regexp.Compile(p); err == nil && !re.MatchString(t) {
+				add("value %q does not match pattern %q", t, p)
+			}
+		}
+	case []any:
+		if n, ok := number(s["minItems"]); ok && float64(len(t)) < n {
+			add("expected at least %d items, got %d", int(n), len(t))
+		}
+		if n, ok := number(s["maxItems"]); ok && float64(len(t)) > n {
+			add("expected at most %d items, got %d", int(n), len(t))
+		}
+		if items, ok := s["items"].(map[string]any); ok {
+			for i, item := range t {
+				validate(items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	case map[string]any:
+		if required, ok := s["required"].([]any); ok {
+			for _, r := range required {
+				name, _ := r.(string)
+				if _, ok := t[name]; !ok {
+					add("missing required property %q", name)
+				}
+			}
+		}
+		props, _ := s["properties"].(map[string]any)
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if ps, ok := props[k].(map[string]any); ok {
+				validate(ps, t[k], path+"."+k, errs)
+				continue
+			}
+			if allowed, ok := s["additionalProperties"].(bool); ok && !allowed {
+				add("unknown property %q", k)
+			}
+		}
+	}
+}
+
+func matchesType(t, v any) bool {
+	switch tt := t.(type) {
+	case string:
+		return matchesTypeName(tt, v)
+	case []any:
+		for _, name := range tt {
+			if n, ok := name.(string); ok && matchesTypeName(n, v) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchesTypeName(name string, v any) bool {
+	switch name {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "null":
+		return v == nil
+	}
+	return false
+}
+
+func typeNames(t any) string {
+	if list, ok := t.([]any); ok {
+		names := make([]string, 0, len(list))
+		for _, n := range list {
+			names = append(names, fmt.Sprint(n))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func typeOf(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if t == math.Trunc(t) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func inEnum(enum []any, v any) bool {
+	for _, e := range enum {
+		if jsonString(e) == jsonString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonString(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func number(v any) (float64, bool) {
+	f, ok := v.(float64)
+	return f, ok
+}
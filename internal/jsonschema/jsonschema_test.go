@@ -0,0 +1,61 @@
+package jsonschema
+
+import (
+	"strings"
+	"testing"
+)
+
+const testSchema = `{
+  "type": "object",
+  "required": ["goal", "steps"],
+  "additionalProperties": false,
+  "properties": {
+    "goal": {"type": "string", "minLength": 1},
+    "steps": {
+      "type": "array", "minItems": 2, "maxItems": 3,
+      "items": {
+        "type": "object",
+        "required": ["id", "risk"],
+        "properties": {
+          "id": {"type": "string", "pattern": "^s[0-9]+$"},
+          "risk": {"enum": ["low", "high"]},
+          "retries": {"type": "integer"}
+        }
+      }
+    }
+  }
+}`
+
+func TestValidate(t *testing.T) {
+	s, err := Parse([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if errs := s.ValidateJSON([]byte(`{"goal":"g","steps":[{"id":"s1","risk":"low"},{"id":"s2","risk":"high","retries":2}]}`)); len(errs) != 0 {
+		t.Fatalf("valid document rejected: %v", errs)
+	}
+
+	errs := s.ValidateJSON([]byte(`{"goal":"","extra":1,"steps":[{"id":"x1","risk":"mid","retries":1.5}]}`))
+	got := make([]string, 0, len(errs))
+	for _, e := range errs {
+		got = append(got, e.Error())
+	}
+	want := []string{
+		`$: unknown property "extra"`,
+		`$.goal: must be at least 1 characters`,
+		`$.steps: expected at least 2 items, got 1`,
+		`$.steps[0].id: value "x1" does not match pattern "^s[0-9]+$"`,
+		`$.steps[0].retries: expected integer, got number`,
+		`$.steps[0].risk: value "mid" is not one of ["low","high"]`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected errors:\n%s", strings.Join(got, "\n"))
+	}
+
+	if errs := s.ValidateJSON([]byte(`{"steps":{}}`)); len(errs) != 2 || errs[0].Message != `missing required property "goal"` || errs[1].Path != "$.steps" {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if errs := s.ValidateJSON([]byte(`not json`)); len(errs) != 1 || !strings.Contains(errs[0].Message, "invalid JSON") {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+}
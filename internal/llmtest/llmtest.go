@@ -0,0 +1,191 @@
+// Package llmtest 提供按阶段匹配 prompt 并返回脚本化响应的假 LLM，用于端到端测试 agent.Runner。
+package llmtest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/yangruihan/go-pi-pro/internal/usage"
+)
+
+const (
+	PhaseRead    = "read"
+	PhasePlan    = "plan"
+	PhaseRepair  = "repair"
+	PhaseReplan  = "replan"
+	PhaseAct     = "act"
+	PhaseFinal   = "final"
+	PhaseUnknown = "unknown"
+)
+
+var phasePrefixes = []struct {
+	prefix string
+	phase  string
+}{
+	{"你是read阶段", PhaseRead},
+	{"你是plan修复阶段", PhaseRepair},
+	{"你是plan阶段", PhasePlan},
+	{"你是replan阶段", PhaseReplan},
+	{"你是act阶段", PhaseAct},
+	{"基于以下执行记录", PhaseFinal},
+}
+
+// DetectPhase 根据 agent 各阶段 prompt 的固定开头判断阶段。
+func DetectPhase(prompt string) string {
+	p := strings.TrimSpace(prompt)
+	for _, pp := range phasePrefixes {
+		if strings.HasPrefix(p, pp.prefix) {
+			return pp.phase
+		}
+	}
+	return PhaseUnknown
+}
+
+type Call struct {
+	Phase  string
+	Prompt string
+}
+
+type Rule struct {
+	phase          string
+	contains       []string
+	text           string
+	toolCalls      int
+	writeToolCalls int
+	err            error
+	fn             func(prompt string) (string, error)
+	usage          *usage.Tokens
+	times          int
+	used           int
+}
+
+// Matching 要求 prompt 同时包含所有给定片段，例如 "当前步骤：写入文件"。
+func (r *Rule) Matching(substr ...string) *Rule {
+	r.contains = append(r.contains, substr...)
+	return r
+}
+
+func (r *Rule) Reply(text string) *Rule {
+	r.text = text
+	return r
+}
+
+func (r *Rule) ReplyWithStats(text string, toolCalls, writeToolCalls int) *Rule {
+	r.text, r.toolCalls, r.writeToolCalls = text, toolCalls, writeToolCalls
+	return r
+}
+
+func (r *Rule) Fail(err error) *Rule {
+	r.err = err
+	return r
+}
+
+func (r *Rule) Do(fn func(prompt string) (string, error)) *Rule {
+	r.fn = fn
+	return r
+}
+
+// Usage 模拟底层客户端上报的 token 用量；不设置时调用方会退回到估算。
+func (r *Rule) Usage(input, output int) *Rule {
+	r.usage = &usage.Tokens{Input: input, Output: output}
+	return r
+}
+
+// Times 限制规则最多命中 n 次，用完后继续匹配后面的规则；0 表示不限次数。
+func (r *Rule) Times(n int) *Rule {
+	r.times = n
+	return r
+}
+
+func (r *Rule) matches(phase, prompt string) bool {
+	if r.phase != phase {
+		return false
+	}
+	if r.times > 0 && r.used >= r.times {
+		return false
+	}
+	for _, c := range r.contains {
+		if !strings.Contains(prompt, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// LLM 同时实现 agent.LLM 与 agent.LLMWithStats。规则按注册顺序匹配，第一个命中的规则生效；
+// 没有规则命中时返回错误，使测试能发现未预期的调用。
+type LLM struct {
+	mu    sync.Mutex
+	rules []*Rule
+	calls []Call
+}
+
+func New() *LLM {
+	return &LLM{}
+}
+
+func (l *LLM) On(phase string) *Rule {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r := &Rule{phase: phase, toolCalls: -1, writeToolCalls: -1}
+	l.rules = append(l.rules, r)
+	return r
+}
+
+func (l *LLM) Ask(ctx context.Context, prompt string) (string, error) {
+	text, _, _, err := l.AskWithStats(ctx, prompt)
+	return text, err
+}
+
+func (l *LLM) AskWithStats(ctx context.Context, prompt string) (string, int, int, error) {
+	if err := ctx.Err(); err != nil {
+		return "", 0, 0, err
+	}
+	phase := DetectPhase(prompt)
+	l.mu.Lock()
+	l.calls = append(l.calls, Call{Phase: phase, Prompt: prompt})
+	var rule *Rule
+	for _, r := range l.rules {
+		if r.matches(phase, prompt) {
+			r.used++
+			rule = r
+			break
+		}
+	}
+	l.mu.Unlock()
+
+	if rule == nil {
+		return "", 0, 0, fmt.Errorf("llmtest: no scripted response for %s prompt: %.80s", phase, prompt)
+	}
+	if rule.usage != nil {
+		usage.Report(ctx, rule.usage.Input, rule.usage.Output)
+	}
+	if rule.fn != nil {
+		text, err := rule.fn(prompt)
+		return text, rule.toolCalls, rule.writeToolCalls, err
+	}
+	if rule.err != nil {
+		return "", rule.toolCalls, rule.writeToolCalls, rule.err
+	}
+	return rule.text, rule.toolCalls, rule.writeToolCalls, nil
+}
+
+func (l *LLM) Calls() []Call {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Call(nil), l.calls...)
+}
+
+func (l *LLM) CallCount(phase string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, c := range l.calls {
+		if c.Phase == phase {
+			n++
+		}
+	}
+	return n
+}
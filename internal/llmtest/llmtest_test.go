@@ -0,0 +1,47 @@
+package llmtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRulesMatchByPhaseOrderAndTimes(t *testing.T) {
+	l := New()
+	l.On(PhaseAct).Matching("当前步骤：A").Fail(errors.New("boom")).Times(1)
+	l.On(PhaseAct).Matching("当前步骤：A").ReplyWithStats("A ok", 2, 1)
+	l.On(PhaseRead).Reply("摘要")
+	ctx := context.Background()
+
+	if _, err := l.Ask(ctx, "你是act阶段。\n当前步骤：A"); err == nil {
+		t.Fatalf("first act call should fail")
+	}
+	text, tc, wtc, err := l.AskWithStats(ctx, "你是act阶段。\n当前步骤：A")
+	if err != nil || text != "A ok" || tc != 2 || wtc != 1 {
+		t.Fatalf("unexpected second call: %q %d %d %v", text, tc, wtc, err)
+	}
+	if text, err := l.Ask(ctx, "你是read阶段。xxx"); err != nil || text != "摘要" {
+		t.Fatalf("read: %q %v", text, err)
+	}
+	if _, err := l.Ask(ctx, "你是plan阶段。"); err == nil {
+		t.Fatalf("unscripted phase should error")
+	}
+	if l.CallCount(PhaseAct) != 2 || len(l.Calls()) != 4 {
+		t.Fatalf("unexpected calls: %#v", l.Calls())
+	}
+}
+
+func TestDetectPhase(t *testing.T) {
+	cases := map[string]string{
+		"你是plan修复阶段。": PhaseRepair,
+		"你是plan阶段。":   PhasePlan,
+		"你是replan阶段。": PhaseReplan,
+		"基于以下执行记录，输出": PhaseFinal,
+		"hello":       PhaseUnknown,
+	}
+	for prompt, want := range cases {
+		if got := DetectPhase(prompt); got != want {
+			t.Fatalf("%q: got %s want %s", prompt, got, want)
+		}
+	}
+}
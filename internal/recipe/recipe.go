@@ -0,0 +1,213 @@
+// Package recipe 管理可复用的参数化计划模板（recipe）。每个 recipe 是 recipes 目录下的一个 YAML 文件，
+// 计划中的字符串字段是 text/template 模板，运行时用 --set 提供的变量渲染为 agent.Plan。
+package recipe
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/yangruihan/go-pi-pro/internal/agent"
+	"gopkg.in/yaml.v3"
+)
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+type Variable struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	Default     string `yaml:"default,omitempty"`
+	Required    bool   `yaml:"required,omitempty"`
+}
+
+type Recipe struct {
+	Name        string     `yaml:"name,omitempty"`
+	Description string     `yaml:"description,omitempty"`
+	Variables   []Variable `yaml:"variables,omitempty"`
+	// Task 渲染后作为本次运行的用户输入，为空时使用计划目标。
+	Task string `yaml:"task,omitempty"`
+	// Plan 保留原始 YAML 节点，展示时维持文件中的字段顺序。
+	Plan yaml.Node `yaml:"plan"`
+
+	Path string `yaml:"-"`
+}
+
+func Dir(dir string) string {
+	if strings.TrimSpace(dir) == "" {
+		return filepath.Join(".gopi-pro", "recipes")
+	}
+	return dir
+}
+
+// Load 按名称读取 recipe，支持 <name>.yaml 与 <name>.yml。
+func Load(dir, name string) (Recipe, error) {
+	if !namePattern.MatchString(name) {
+		return Recipe{}, fmt.Errorf("invalid recipe name %q", name)
+	}
+	for _, ext := range []string{".yaml", ".yml"} {
+		path := filepath.Join(Dir(dir), name+ext)
+		if _, err := os.Stat(path); err == nil {
+			return LoadFile(path)
+		}
+	}
+	return Recipe{}, fmt.Errorf("recipe %q not found in %s", name, Dir(dir))
+}
+
+func LoadFile(path string) (Recipe, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Recipe{}, err
+	}
+	var r Recipe
+	if err := yaml.Unmarshal(b, &r); err != nil {
+		return Recipe{}, fmt.Errorf("%s: %w", path, err)
+	}
+	r.Path = path
+	if strings.TrimSpace(r.Name) == "" {
+		r.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if r.Plan.Kind == 0 {
+		return Recipe{}, fmt.Errorf("%s: plan is required", path)
+	}
+	seen := make(map[string]struct{}, len(r.Variables))
+	for _, v := range r.Variables {
+		if strings.TrimSpace(v.Name) == "" {
+			return Recipe{}, fmt.Errorf("%s: variable name is required", path)
+		}
+		if _, ok := seen[v.Name]; ok {
+			return Recipe{}, fmt.Errorf("%s: duplicate variable %q", path, v.Name)
+		}
+		seen[v.Name] = struct{}{}
+	}
+	return r, nil
+}
+
+// List 返回目录下的全部 recipe，按名称排序；目录不存在时返回空列表。
+func List(dir string) ([]Recipe, error) {
+	entries, err := os.ReadDir(Dir(dir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Recipe, 0, len(entries))
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if e.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		r, err := LoadFile(filepath.Join(Dir(dir), e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// Values 合并默认值与调用方提供的变量，拒绝未声明的变量并检查必填项。
+func (r Recipe) Values(set map[string]string) (map[string]string, error) {
+	declared := make(map[string]struct{}, len(r.Variables))
+	values := make(map[string]string, len(r.Variables))
+	for _, v := range r.Variables {
+		declared[v.Name] = struct{}{}
+		values[v.Name] = v.Default
+	}
+	for k, v := range set {
+		if _, ok := declared[k]; !ok {
+			return nil, fmt.Errorf("%s: unknown variable %q", r.Name, k)
+		}
+		values[k] = v
+	}
+	missing := make([]string, 0)
+	for _, v := range r.Variables {
+		if v.Required && strings.TrimSpace(values[v.Name]) == "" {
+			missing = append(missing, v.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%s: missing required variables: %s", r.Name, strings.Join(missing, ", "))
+	}
+	return values, nil
+}
+
+// Render 渲染计划模板与任务描述。模板中引用未声明的变量会报错。
+func (r Recipe) Render(set map[string]string) (agent.Plan, string, error) {
+	values, err := r.Values(set)
+	if err != nil {
+		return agent.Plan{}, "", err
+	}
+	var doc any
+	if err := r.Plan.Decode(&doc); err != nil {
+		return agent.Plan{}, "", fmt.Errorf("%s: %w", r.Name, err)
+	}
+	rendered, err := renderValue(doc, values)
+	if err != nil {
+		return agent.Plan{}, "", fmt.Errorf("%s: %w", r.Name, err)
+	}
+	b, err := json.Marshal(rendered)
+	if err != nil {
+		return agent.Plan{}, "", err
+	}
+	plan, err := agent.ParsePlan(b, "json")
+	if err != nil {
+		return agent.Plan{}, "", fmt.Errorf("%s: %w", r.Name, err)
+	}
+	task, err := renderString(r.Task, values)
+	if err != nil {
+		return agent.Plan{}, "", fmt.Errorf("%s: task: %w", r.Name, err)
+	}
+	return plan, strings.TrimSpace(task), nil
+}
+
+// renderValue 只渲染字符串叶子，变量值不会被当作 YAML 解析，含引号或换行也是安全的。
+func renderValue(v any, values map[string]string) (any, error) {
+	switch t := v.(type) {
+	case string:
+		return renderString(t, values)
+	case []any:
+		out := make([]any, len(t))
+		for i, item := range t {
+			r, err := renderValue(item, values)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = r
+		}
+		return out, nil
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, item := range t {
+			r, err := renderValue(item, values)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = r
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
+
+func renderString(s string, values map[string]string) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	tmpl, err := template.New("recipe").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, values); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
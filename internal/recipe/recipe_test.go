@@ -0,0 +1,87 @@
+package recipe
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const addEndpoint = `description: 新增 HTTP 接口
+variables:
+  - name: path
+    required: true
+  - name: method
+    default: GET
+task: 新增 {{.method}} {{.path}} 接口
+plan:
+  goal: 新增 {{.method}} {{.path}}
+  steps:
+    - id: s1
+      title: 在 router.go 中注册 {{.method}} {{.path}}
+      risk: low
+      acceptance:
+        - type: file_contains
+          path: router.go
+          pattern: "{{.path}}"
+    - id: s2
+      title: 为 {{.path}} 编写测试
+      depends_on: [s1]
+`
+
+func writeRecipe(t *testing.T, dir, name, body string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadListAndRender(t *testing.T) {
+	dir := t.TempDir()
+	writeRecipe(t, dir, "add-endpoint.yaml", addEndpoint)
+	writeRecipe(t, dir, "bump.yml", "name: bump-version\nplan:\n  steps:\n    - title: bump\n")
+	writeRecipe(t, dir, "notes.txt", "ignored")
+
+	list, err := List(dir)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(list) != 2 || list[0].Name != "add-endpoint" || list[1].Name != "bump-version" {
+		t.Fatalf("unexpected list: %#v", list)
+	}
+
+	r, err := Load(dir, "add-endpoint")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	plan, task, err := r.Render(map[string]string{"path": `/users/"{id}"`})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if task != `新增 GET /users/"{id}" 接口` || plan.Goal != `新增 GET /users/"{id}"` {
+		t.Fatalf("unexpected task/goal: %q %q", task, plan.Goal)
+	}
+	if plan.Steps[0].Acceptance[0].Pattern != `/users/"{id}"` || plan.Steps[1].DependsOn[0] != "s1" {
+		t.Fatalf("unexpected steps: %#v", plan.Steps)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeRecipe(t, dir, "add-endpoint.yaml", addEndpoint)
+	writeRecipe(t, dir, "typo.yaml", "plan:\n  steps:\n    - title: \"{{.nope}}\"\n")
+	r, _ := Load(dir, "add-endpoint")
+	if _, _, err := r.Render(nil); err == nil || !strings.Contains(err.Error(), "path") {
+		t.Fatalf("expected missing required variable, got %v", err)
+	}
+	if _, _, err := r.Render(map[string]string{"path": "/a", "extra": "x"}); err == nil {
+		t.Fatalf("expected unknown variable error")
+	}
+	typo, _ := Load(dir, "typo")
+	if _, _, err := typo.Render(nil); err == nil {
+		t.Fatalf("expected undeclared template variable error")
+	}
+	if _, err := Load(dir, "../etc"); err == nil {
+		t.Fatalf("expected invalid name error")
+	}
+}
@@ -0,0 +1,253 @@
+// Package redact 在审计落盘和 prompt 发出前把疑似密钥替换为 [REDACTED:<规则名>]。
+package redact
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const marker = "[REDACTED"
+
+// Counts 按规则名统计替换次数。
+type Counts map[string]int
+
+func (c Counts) Add(other Counts) {
+	for k, v := range other {
+		c[k] += v
+	}
+}
+
+func (c Counts) Total() int {
+	n := 0
+	for _, v := range c {
+		n += v
+	}
+	return n
+}
+
+// String 按规则名排序输出 "name=n"，用于日志。
+func (c Counts) String() string {
+	names := make([]string, 0, len(c))
+	for k := range c {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, k := range names {
+		parts = append(parts, fmt.Sprintf("%s=%d", k, c[k]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// rule 命中后替换第一个参与匹配的捕获组（有捕获组时）或整个匹配；keep 返回 true 时保留原文。
+type rule struct {
+	name string
+	re   *regexp.Regexp
+	keep func(string) bool
+}
+
+// 顺序有意义：先匹配格式明确的密钥，最后才按熵值兜底。
+var builtinRules = []rule{
+	{name: "private_key", re: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{name: "aws_access_key", re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{name: "github_token", re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`)},
+	{name: "api_key", re: regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`)},
+	{name: "google_api_key", re: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`)},
+	{name: "slack_token", re: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{name: "jwt", re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{name: "url_credentials", re: regexp.MustCompile(`\b[A-Za-z][A-Za-z0-9+.-]*://[^/\s:@]+:([^/\s@]+)@`)},
+	{name: "bearer", re: regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/=-]{16,})`)},
+	{
+		name: "env_assignment",
+		re:   regexp.MustCompile(`(?i)\b[A-Za-z0-9_.-]*(?:api[_-]?key|secret|token|passw(?:or)?d|pwd|credentials?|access[_-]?key|private[_-]?key)[A-Za-z0-9_.-]*["']?[ \t]*[:=][ \t]*(?:"([^"\n]+)"|'([^'\n]+)'|([^\s"',;]+))`),
+		keep: isPlainValue,
+	},
+	{
+		name: "high_entropy",
+		re:   regexp.MustCompile(`[A-Za-z0-9+/=_-]{24,}`),
+		keep: func(s string) bool { return isPathLike(s) || !looksRandom(s) },
+	},
+}
+
+type Redactor struct {
+	rules []rule
+}
+
+// New 返回带全部内置规则的 Redactor，patterns 为额外的自定义正则（规则名 custom）。
+func New(patterns []string) (*Redactor, error) {
+	r := &Redactor{rules: append([]rule(nil), builtinRules...)}
+	for _, p := range patterns {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", p, err)
+		}
+		// 自定义规则放在熵值兜底之前
+		r.rules = append(r.rules[:len(r.rules)-1], rule{name: "custom", re: re}, r.rules[len(r.rules)-1])
+	}
+	return r, nil
+}
+
+func (r *Redactor) String(s string) (string, Counts) {
+	counts := Counts{}
+	if r == nil || s == "" {
+		return s, counts
+	}
+	for _, ru := range r.rules {
+		s = ru.apply(s, counts)
+	}
+	return s, counts
+}
+
+func (ru rule) apply(s string, counts Counts) string {
+	matches := ru.re.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		for g := 2; g+1 < len(m); g += 2 {
+			if m[g] >= 0 {
+				start, end = m[g], m[g+1]
+				break
+			}
+		}
+		secret := s[start:end]
+		if start < last || secret == "" || strings.Contains(secret, marker) || (ru.keep != nil && ru.keep(secret)) {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(marker + ":" + ru.name + "]")
+		last = end
+		counts[ru.name]++
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// Value 原地替换 v（指针）中所有导出的字符串字段、切片与 map 元素，调用方需自行传入副本。
+// 带 `redact:"-"` 标签的字段（id、路径、快照 ref、哈希等结构性字段）不做替换。
+func (r *Redactor) Value(v any) Counts {
+	counts := Counts{}
+	if r != nil {
+		r.walk(reflect.ValueOf(v), counts)
+	}
+	return counts
+}
+
+func (r *Redactor) walk(v reflect.Value, counts Counts) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			r.walk(v.Elem(), counts)
+		}
+	case reflect.Interface:
+		if v.IsNil() || !v.CanSet() {
+			return
+		}
+		elem := reflect.New(v.Elem().Type()).Elem()
+		elem.Set(v.Elem())
+		r.walk(elem, counts)
+		v.Set(elem)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Type().Field(i); f.IsExported() && f.Tag.Get("redact") != "-" {
+				r.walk(v.Field(i), counts)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			r.walk(v.Index(i), counts)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(iter.Value().Type()).Elem()
+			elem.Set(iter.Value())
+			r.walk(elem, counts)
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	case reflect.String:
+		if !v.CanSet() {
+			return
+		}
+		s, c := r.String(v.String())
+		if c.Total() > 0 {
+			v.SetString(s)
+			counts.Add(c)
+		}
+	}
+}
+
+// isPlainValue 排除 "max_tokens: 100"、"token=true" 这类显然不是密钥的赋值。
+func isPlainValue(v string) bool {
+	if len(v) < 4 {
+		return true
+	}
+	switch strings.ToLower(v) {
+	case "true", "false", "null", "none", "nil":
+		return true
+	}
+	return strings.IndexFunc(v, func(r rune) bool { return !unicode.IsDigit(r) && r != '.' }) < 0
+}
+
+// isPathLike 排除 "/Users/JohnSmith/Projects2024/myWebApp" 这类按 / 分段、每段都不像随机串的路径。
+// 标准 base64 同样含 /，因此含 + 或 = 的不视为路径。
+func isPathLike(s string) bool {
+	if !strings.Contains(s, "/") || strings.ContainsAny(s, "+=") {
+		return false
+	}
+	for _, seg := range strings.Split(s, "/") {
+		if len(seg) >= 16 && mixedClasses(seg) && entropy(seg) >= 3.6 {
+			return false
+		}
+	}
+	return true
+}
+
+// looksRandom 要求同时包含大小写字母与数字且香农熵不低于 4.2 bit/字符，以避开十六进制哈希和普通标识符。
+func looksRandom(s string) bool {
+	return mixedClasses(s) && entropy(s) >= 4.2
+}
+
+func mixedClasses(s string) bool {
+	var upper, lower, digit bool
+	for _, c := range s {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= '0' && c <= '9':
+			digit = true
+		}
+	}
+	return upper && lower && digit
+}
+
+// entropy 返回 s 的香农熵（bit/字符）。
+func entropy(s string) float64 {
+	freq := make(map[rune]int)
+	for _, c := range s {
+		freq[c]++
+	}
+	h := 0.0
+	n := float64(len(s))
+	for _, k := range freq {
+		p := float64(k) / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
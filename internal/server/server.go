@@ -0,0 +1,482 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yangruihan/go-pi-pro/internal/agent"
+	"github.com/yangruihan/go-pi-pro/internal/todo"
+)
+
+const (
+	StatusQueued   = "queued"
+	StatusRunning  = "running"
+	StatusFinished = "finished"
+	StatusFailed   = "failed"
+)
+
+const (
+	EventProgress         = "progress"
+	EventApproval         = "approval"
+	EventApprovalResolved = "approval_resolved"
+	EventFinished         = "finished"
+)
+
+// DefaultKeepFinished 是 Options.KeepFinished 为 0 时保留的已结束 run 数。
+const DefaultKeepFinished = 100
+
+type Options struct {
+	LLM         agent.LLM
+	Runner      agent.RunnerOptions
+	AutoApprove bool
+	// KeepFinished 为内存中保留的已结束 run 数（含事件与完整结果），超出时先移除最早结束的；0 表示 DefaultKeepFinished。
+	KeepFinished int
+}
+
+// Server 通过 HTTP 暴露 agent.Runner。每个 run 使用独立的 Runner，但同一时刻只执行一个 run，
+// 因为底层 LLM 客户端（gopi 会话）不保证并发安全；其余 run 保持 queued 直到轮到它们。
+type Server struct {
+	opts   Options
+	ctx    context.Context
+	cancel context.CancelFunc
+	sem    chan struct{}
+
+	mu   sync.Mutex
+	seq  int
+	runs map[string]*run
+}
+
+type Event struct {
+	ID   int    `json:"id"`
+	Type string `json:"type"`
+	At   string `json:"at"`
+	Data any    `json:"data"`
+}
+
+type Approval struct {
+	RunID       string         `json:"run_id"`
+	Step        agent.PlanStep `json:"step"`
+	RequestedAt string         `json:"requested_at"`
+}
+
+type RunView struct {
+	ID         string            `json:"id"`
+	Task       string            `json:"task"`
+	Status     string            `json:"status"`
+	Outcome    string            `json:"outcome,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	CreatedAt  string            `json:"created_at"`
+	StartedAt  string            `json:"started_at,omitempty"`
+	FinishedAt string            `json:"finished_at,omitempty"`
+	Phase      string            `json:"phase,omitempty"`
+	Todos      []todo.Item       `json:"todos"`
+	Approvals  []Approval        `json:"approvals,omitempty"`
+	Result     *agent.StepResult `json:"result,omitempty"`
+}
+
+type run struct {
+	id        string
+	task      string
+	createdAt time.Time
+	cancel    context.CancelFunc
+
+	mu         sync.Mutex
+	status     string
+	outcome    string
+	errText    string
+	startedAt  time.Time
+	finishedAt time.Time
+	phase      string
+	todos      []todo.Item
+	result     *agent.StepResult
+	events     []Event
+	notify     chan struct{}
+	pending    map[string]*pendingApproval
+}
+
+type pendingApproval struct {
+	approval Approval
+	answer   chan bool
+}
+
+func New(opts Options) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		opts:   opts,
+		ctx:    ctx,
+		cancel: cancel,
+		sem:    make(chan struct{}, 1),
+		runs:   make(map[string]*run),
+	}
+}
+
+// Close 取消所有排队中和执行中的 run。
+func (s *Server) Close() {
+	s.cancel()
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /runs", s.handleCreate)
+	mux.HandleFunc("GET /runs", s.handleList)
+	mux.HandleFunc("GET /runs/{id}", s.handleGet)
+	mux.HandleFunc("DELETE /runs/{id}", s.handleCancel)
+	mux.HandleFunc("GET /runs/{id}/events", s.handleEvents)
+	mux.HandleFunc("GET /runs/{id}/approvals", s.handleApprovals)
+	mux.HandleFunc("POST /runs/{id}/approvals/{step}", s.handleAnswer)
+	return mux
+}
+
+func (s *Server) Start(task string) *RunView {
+	s.mu.Lock()
+	s.seq++
+	ctx, cancel := context.WithCancel(s.ctx)
+	rn := &run{
+		id:        strconv.Itoa(s.seq),
+		task:      task,
+		createdAt: time.Now(),
+		cancel:    cancel,
+		status:    StatusQueued,
+		todos:     make([]todo.Item, 0),
+		notify:    make(chan struct{}),
+		pending:   make(map[string]*pendingApproval),
+	}
+	s.runs[rn.id] = rn
+	s.mu.Unlock()
+
+	go s.execute(ctx, rn)
+	view := rn.view(false)
+	return &view
+}
+
+func (s *Server) execute(ctx context.Context, rn *run) {
+	defer rn.cancel()
+	select {
+	case s.sem <- struct{}{}:
+		defer func() { <-s.sem }()
+	case <-ctx.Done():
+		rn.finish(nil, ctx.Err())
+		return
+	}
+
+	rn.mu.Lock()
+	rn.status = StatusRunning
+	rn.startedAt = time.Now()
+	rn.mu.Unlock()
+
+	opts := s.opts.Runner
+	opts.OnProgress = rn.progress
+	opts.Approver = s.approver(rn)
+	res, err := agent.NewRunner(s.opts.LLM, opts).Run(ctx, rn.task)
+	if err != nil {
+		rn.finish(nil, err)
+	} else {
+		rn.finish(&res, nil)
+	}
+	s.pruneFinished()
+}
+
+// pruneFinished 只保留最近结束的 KeepFinished 个 run，排队与执行中的 run 不受影响。
+func (s *Server) pruneFinished() {
+	limit := s.opts.KeepFinished
+	if limit <= 0 {
+		limit = DefaultKeepFinished
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	finished := make([]*run, 0, len(s.runs))
+	ended := make(map[*run]time.Time, len(s.runs))
+	for _, rn := range s.runs {
+		if t := rn.finishedTime(); !t.IsZero() {
+			finished = append(finished, rn)
+			ended[rn] = t
+		}
+	}
+	if len(finished) <= limit {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return ended[finished[i]].Before(ended[finished[j]]) })
+	for _, rn := range finished[:len(finished)-limit] {
+		delete(s.runs, rn.id)
+	}
+}
+
+func (s *Server) approver(rn *run) agent.Approver {
+	return func(ctx context.Context, step agent.PlanStep) (bool, error) {
+		if s.opts.AutoApprove {
+			return true, nil
+		}
+		p := &pendingApproval{
+			approval: Approval{RunID: rn.id, Step: step, RequestedAt: time.Now().Format(time.RFC3339)},
+			answer:   make(chan bool, 1),
+		}
+		rn.mu.Lock()
+		rn.pending[step.ID] = p
+		rn.publishLocked(EventApproval, p.approval)
+		rn.mu.Unlock()
+
+		var approved bool
+		var err error
+		select {
+		case approved = <-p.answer:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		rn.mu.Lock()
+		delete(rn.pending, step.ID)
+		rn.publishLocked(EventApprovalResolved, map[string]any{"step_id": step.ID, "approved": approved})
+		rn.mu.Unlock()
+		return approved, err
+	}
+}
+
+func (s *Server) lookup(id string) (*run, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rn, ok := s.runs[id]
+	return rn, ok
+}
+
+func (s *Server) handleCreate(w http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Task string `json:"task"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	task := strings.TrimSpace(body.Task)
+	if task == "" {
+		writeError(w, http.StatusBadRequest, errors.New("task is required"))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, s.Start(task))
+}
+
+func (s *Server) handleList(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	runs := make([]*run, 0, len(s.runs))
+	for _, rn := range s.runs {
+		runs = append(runs, rn)
+	}
+	s.mu.Unlock()
+	sort.Slice(runs, func(i, j int) bool { return runs[i].createdAt.Before(runs[j].createdAt) })
+	views := make([]RunView, 0, len(runs))
+	for _, rn := range runs {
+		views = append(views, rn.view(false))
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, req *http.Request) {
+	rn, ok := s.lookup(req.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("run not found"))
+		return
+	}
+	writeJSON(w, http.StatusOK, rn.view(true))
+}
+
+func (s *Server) handleCancel(w http.ResponseWriter, req *http.Request) {
+	rn, ok := s.lookup(req.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("run not found"))
+		return
+	}
+	// 已结束的 run 从内存中移除，否则取消
+	if !rn.finishedTime().IsZero() {
+		s.mu.Lock()
+		delete(s.runs, rn.id)
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, rn.view(false))
+		return
+	}
+	rn.cancel()
+	writeJSON(w, http.StatusAccepted, rn.view(false))
+}
+
+func (s *Server) handleApprovals(w http.ResponseWriter, req *http.Request) {
+	rn, ok := s.lookup(req.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("run not found"))
+		return
+	}
+	approvals := rn.view(false).Approvals
+	if approvals == nil {
+		approvals = make([]Approval, 0)
+	}
+	writeJSON(w, http.StatusOK, approvals)
+}
+
+func (s *Server) handleAnswer(w http.ResponseWriter, req *http.Request) {
+	rn, ok := s.lookup(req.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("run not found"))
+		return
+	}
+	var body struct {
+		Approved *bool `json:"approved"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.Approved == nil {
+		writeError(w, http.StatusBadRequest, errors.New(`body must be {"approved": true|false}`))
+		return
+	}
+	stepID := req.PathValue("step")
+	rn.mu.Lock()
+	p, ok := rn.pending[stepID]
+	if ok {
+		delete(rn.pending, stepID)
+	}
+	rn.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no pending approval for step %s", stepID))
+		return
+	}
+	p.answer <- *body.Approved
+	writeJSON(w, http.StatusOK, map[string]any{"step_id": stepID, "approved": *body.Approved})
+}
+
+// handleEvents 以 Server-Sent Events 推送 run 的事件：先补发已有事件（支持 Last-Event-ID），
+// 再实时推送新事件，run 结束后发送 finished 事件并关闭连接。
+func (s *Server) handleEvents(w http.ResponseWriter, req *http.Request) {
+	rn, ok := s.lookup(req.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("run not found"))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming unsupported"))
+		return
+	}
+	next := 0
+	if v, err := strconv.Atoi(strings.TrimSpace(req.Header.Get("Last-Event-ID"))); err == nil && v > 0 {
+		next = v
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		rn.mu.Lock()
+		var batch []Event
+		if next < len(rn.events) {
+			batch = append(batch, rn.events[next:]...)
+		}
+		done := !rn.finishedAt.IsZero()
+		notify := rn.notify
+		rn.mu.Unlock()
+
+		for _, ev := range batch {
+			data, err := json.Marshal(ev.Data)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+			next = ev.ID
+		}
+		flusher.Flush()
+		if done {
+			return
+		}
+		select {
+		case <-notify:
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+func (rn *run) progress(ev agent.ProgressEvent) {
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+	rn.phase = ev.Phase
+	if ev.Todos != nil {
+		rn.todos = ev.Todos
+	}
+	rn.publishLocked(EventProgress, ev)
+}
+
+func (rn *run) finish(res *agent.StepResult, err error) {
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+	rn.finishedAt = time.Now()
+	if err != nil {
+		rn.status = StatusFailed
+		rn.errText = err.Error()
+	} else {
+		rn.status = StatusFinished
+		rn.outcome = res.Outcome()
+		rn.result = res
+	}
+	rn.publishLocked(EventFinished, rn.viewLocked(true))
+}
+
+// publishLocked 追加事件并唤醒所有等待中的 SSE 订阅者，调用方需持有 rn.mu。
+func (rn *run) publishLocked(typ string, data any) {
+	rn.events = append(rn.events, Event{ID: len(rn.events) + 1, Type: typ, At: time.Now().Format(time.RFC3339Nano), Data: data})
+	close(rn.notify)
+	rn.notify = make(chan struct{})
+}
+
+func (rn *run) finishedTime() time.Time {
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+	return rn.finishedAt
+}
+
+func (rn *run) view(withResult bool) RunView {
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+	return rn.viewLocked(withResult)
+}
+
+func (rn *run) viewLocked(withResult bool) RunView {
+	v := RunView{
+		ID:        rn.id,
+		Task:      rn.task,
+		Status:    rn.status,
+		Outcome:   rn.outcome,
+		Error:     rn.errText,
+		CreatedAt: rn.createdAt.Format(time.RFC3339),
+		Phase:     rn.phase,
+		Todos:     append([]todo.Item(nil), rn.todos...),
+	}
+	if v.Todos == nil {
+		v.Todos = make([]todo.Item, 0)
+	}
+	if !rn.startedAt.IsZero() {
+		v.StartedAt = rn.startedAt.Format(time.RFC3339)
+	}
+	if !rn.finishedAt.IsZero() {
+		v.FinishedAt = rn.finishedAt.Format(time.RFC3339)
+	}
+	for _, p := range rn.pending {
+		v.Approvals = append(v.Approvals, p.approval)
+	}
+	if withResult {
+		v.Result = rn.result
+	}
+	return v
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yangruihan/go-pi-pro/internal/agent"
+)
+
+type funcLLM func(prompt string) (string, error)
+
+func (f funcLLM) Ask(_ context.Context, prompt string) (string, error) {
+	return f(prompt)
+}
+
+const approvalPlanJSON = `{"goal":"g","steps":[{"id":"s1","title":"删除临时目录","reason":"r","risk":"high","requires_approval":true}]}`
+
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	llm := funcLLM(func(prompt string) (string, error) {
+		switch {
+		case strings.HasPrefix(prompt, "你是read阶段"):
+			return "摘要", nil
+		case strings.HasPrefix(prompt, "你是plan阶段"):
+			return approvalPlanJSON, nil
+		case strings.HasPrefix(prompt, "你是act阶段"):
+			return "已删除", nil
+		}
+		return "完成", nil
+	})
+	dir := t.TempDir()
+	srv := New(Options{LLM: llm, Runner: agent.RunnerOptions{AuditDir: dir, WorkingDir: dir, MaxActRetries: 1, PlanMinSteps: 1}})
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(func() {
+		srv.Close()
+		ts.Close()
+	})
+	return srv, ts
+}
+
+func decode(t *testing.T, resp *http.Response, v any) {
+	t.Helper()
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+}
+
+func TestServeRunWithApprovalOverHTTP(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	resp, err := http.Post(ts.URL+"/runs", "application/json", strings.NewReader(`{"task":"清理临时目录"}`))
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+	var created RunView
+	decode(t, resp, &created)
+
+	events, err := http.Get(ts.URL + "/runs/" + created.ID + "/events")
+	if err != nil {
+		t.Fatalf("events: %v", err)
+	}
+	defer events.Body.Close()
+	if ct := events.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	seen := make(chan []string, 1)
+	go func() {
+		var types []string
+		sc := bufio.NewScanner(events.Body)
+		for sc.Scan() {
+			if v, ok := strings.CutPrefix(sc.Text(), "event: "); ok {
+				types = append(types, v)
+			}
+		}
+		seen <- types
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	var pending []Approval
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(ts.URL + "/runs/" + created.ID + "/approvals")
+		if err != nil {
+			t.Fatalf("approvals: %v", err)
+		}
+		decode(t, resp, &pending)
+		if len(pending) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(pending) != 1 || pending[0].Step.ID != "s1" {
+		t.Fatalf("expected pending approval for s1, got %#v", pending)
+	}
+
+	resp, err = http.Post(ts.URL+"/runs/"+created.ID+"/approvals/s1", "application/json", strings.NewReader(`{"approved":true}`))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("answer approval: %v %v", err, resp)
+	}
+	resp.Body.Close()
+
+	var types []string
+	select {
+	case types = <-seen:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("event stream did not finish")
+	}
+	joined := strings.Join(types, ",")
+	for _, want := range []string{EventProgress, EventApproval, EventApprovalResolved, EventFinished} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("missing %s event in %v", want, types)
+		}
+	}
+	if types[len(types)-1] != EventFinished {
+		t.Fatalf("finished must be the last event: %v", types)
+	}
+
+	resp, err = http.Get(ts.URL + "/runs/" + created.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	var view RunView
+	decode(t, resp, &view)
+	if view.Status != StatusFinished || view.Outcome != agent.OutcomeDone || view.Result == nil {
+		t.Fatalf("unexpected final view: %#v", view)
+	}
+	if len(view.Todos) != 1 || view.Todos[0].Status != "done" {
+		t.Fatalf("unexpected todos: %#v", view.Todos)
+	}
+}
+
+func TestServeRejectsBadRequests(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	resp, err := http.Post(ts.URL+"/runs", "application/json", strings.NewReader(`{"task":"  "}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for empty task, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(ts.URL + "/runs/404")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(ts.URL+"/runs/1/approvals/s1", "application/json", strings.NewReader(`{"approved":true}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown run approval, got %d", resp.StatusCode)
+	}
+}
+
+func TestServeDropsOldFinishedRuns(t *testing.T) {
+	llm := funcLLM(func(prompt string) (string, error) {
+		if strings.HasPrefix(prompt, "你是plan阶段") {
+			return approvalPlanJSON, nil
+		}
+		return "ok", nil
+	})
+	dir := t.TempDir()
+	srv := New(Options{LLM: llm, AutoApprove: true, KeepFinished: 2, Runner: agent.RunnerOptions{AuditDir: dir, WorkingDir: dir, MaxActRetries: 1, PlanMinSteps: 1}})
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(func() {
+		srv.Close()
+		ts.Close()
+	})
+
+	ids := make([]string, 0, 3)
+	for i := 0; i < 3; i++ {
+		v := srv.Start("任务")
+		ids = append(ids, v.ID)
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			rn, ok := srv.lookup(v.ID)
+			if !ok || !rn.finishedTime().IsZero() {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("run %s did not finish", v.ID)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	// 结束后才清理，轮询等待
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := srv.lookup(ids[0]); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("oldest finished run should be dropped")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/runs/"+ids[1], nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("deleting a finished run should return 200, got %d", resp.StatusCode)
+	}
+	if resp, err = http.Get(ts.URL + "/runs/" + ids[1]); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("deleted run should be gone, got %d", resp.StatusCode)
+	}
+	if _, ok := srv.lookup(ids[2]); !ok {
+		t.Fatalf("latest run should be kept")
+	}
+}
@@ -3,6 +3,7 @@ package todo
 import (
 	"fmt"
 	"strings"
+	"sync"
 )
 
 type Status string
@@ -16,12 +17,13 @@ const (
 )
 
 type Item struct {
-	ID     int
-	Title  string
-	Status Status
+	ID     int    `json:"id"`
+	Title  string `json:"title"`
+	Status Status `json:"status"`
 }
 
 type Store struct {
+	mu    sync.Mutex
 	items []Item
 }
 
@@ -29,11 +31,19 @@ func New() *Store {
 	return &Store{items: make([]Item, 0)}
 }
 
+func Restore(items []Item) *Store {
+	s := New()
+	s.items = append(s.items, items...)
+	return s
+}
+
 func (s *Store) Upsert(title string, status Status) Item {
 	title = strings.TrimSpace(title)
 	if title == "" {
 		return Item{}
 	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	for i := range s.items {
 		if strings.EqualFold(s.items[i].Title, title) {
 			s.items[i].Status = status
@@ -46,12 +56,16 @@ func (s *Store) Upsert(title string, status Status) Item {
 }
 
 func (s *Store) All() []Item {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	out := make([]Item, len(s.items))
 	copy(out, s.items)
 	return out
 }
 
 func (s *Store) Render() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if len(s.items) == 0 {
 		return "(no todos)"
 	}
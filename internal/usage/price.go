@@ -0,0 +1,66 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Price 为每百万 token 的单价。
+type Price struct {
+	Input  float64 `json:"input" yaml:"input"`
+	Output float64 `json:"output" yaml:"output"`
+}
+
+type PriceTable struct {
+	Currency string           `json:"currency,omitempty" yaml:"currency,omitempty"`
+	Models   map[string]Price `json:"models" yaml:"models"`
+}
+
+func (p Price) Cost(t Tokens) float64 {
+	return (float64(t.Input)*p.Input + float64(t.Output)*p.Output) / 1e6
+}
+
+func LoadPriceTable(file string) (PriceTable, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return PriceTable{}, err
+	}
+	var t PriceTable
+	if strings.EqualFold(filepath.Ext(file), ".json") {
+		err = json.Unmarshal(b, &t)
+	} else {
+		err = yaml.Unmarshal(b, &t)
+	}
+	if err != nil {
+		return PriceTable{}, fmt.Errorf("price table %s: %w", file, err)
+	}
+	if len(t.Models) == 0 {
+		return PriceTable{}, fmt.Errorf("price table %s: no models", file)
+	}
+	return t, nil
+}
+
+// Lookup 按模型名查找价格：先精确匹配（忽略大小写），再匹配最长的前缀，最后回退到 "default"。
+func (t PriceTable) Lookup(model string) (Price, bool) {
+	model = strings.ToLower(strings.TrimSpace(model))
+	best, bestLen := Price{}, -1
+	for name, p := range t.Models {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if key == model {
+			return p, true
+		}
+		if key != "default" && key != "" && strings.HasPrefix(model, key) && len(key) > bestLen {
+			best, bestLen = p, len(key)
+		}
+	}
+	if bestLen >= 0 {
+		return best, true
+	}
+	p, ok := t.Models["default"]
+	return p, ok
+}
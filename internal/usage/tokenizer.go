@@ -0,0 +1,107 @@
+package usage
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tiktoken "github.com/pkoukk/tiktoken-go"
+)
+
+// Encoding 是估算 token 时使用的 tiktoken 编码。
+const Encoding = "cl100k_base"
+
+var (
+	encOnce sync.Once
+	enc     *tiktoken.Tiktoken
+)
+
+// tokenizer 返回 cl100k_base 分词器；词表首次使用时下载并缓存，取不到（如离线）时返回 nil。
+func tokenizer() *tiktoken.Tiktoken {
+	encOnce.Do(func() {
+		tiktoken.SetBpeLoader(bpeLoader{})
+		if e, err := tiktoken.GetEncoding(Encoding); err == nil {
+			enc = e
+		}
+	})
+	return enc
+}
+
+// TokenizerAvailable 报告 Estimate 是否使用分词器计数（否则按字符数近似）。
+func TokenizerAvailable() bool {
+	return tokenizer() != nil
+}
+
+// bpeLoader 从 TIKTOKEN_CACHE_DIR（缺省为用户缓存目录下的 gopi-pro/tiktoken）读取词表，
+// 没有缓存时限时下载，避免网络不通时卡住运行。
+type bpeLoader struct{}
+
+func (bpeLoader) LoadTiktokenBpe(file string) (map[string]int, error) {
+	dir := strings.TrimSpace(os.Getenv("TIKTOKEN_CACHE_DIR"))
+	if dir == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			base = os.TempDir()
+		}
+		dir = filepath.Join(base, "gopi-pro", "tiktoken")
+	}
+	cached := filepath.Join(dir, path.Base(file))
+	data, err := os.ReadFile(cached)
+	if err != nil {
+		if data, err = download(file); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(dir, 0o755); err == nil {
+			tmp := cached + ".tmp"
+			if os.WriteFile(tmp, data, 0o644) == nil {
+				_ = os.Rename(tmp, cached)
+			}
+		}
+	}
+	return parseBpe(data)
+}
+
+func download(url string) ([]byte, error) {
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// parseBpe 解析 "<base64 token> <rank>" 每行一条的词表。
+func parseBpe(data []byte) (map[string]int, error) {
+	ranks := make(map[string]int)
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		token, rank, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid bpe line %q", line)
+		}
+		b, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(rank))
+		if err != nil {
+			return nil, err
+		}
+		ranks[string(b)] = n
+	}
+	return ranks, nil
+}
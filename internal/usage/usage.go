@@ -0,0 +1,80 @@
+// Package usage 在一次 LLM 调用的 context 中传递 token 用量，并提供估算与价格表。
+// 调用方用 WithSink 创建接收器，能拿到真实用量的中间层（录制回放、测试桩）用 Report 上报；
+// 没有上报时调用方退回到 Estimate，用 tiktoken 分词器计数。
+package usage
+
+import (
+	"context"
+	"sync"
+	"unicode"
+)
+
+type Tokens struct {
+	Input  int
+	Output int
+}
+
+type Sink struct {
+	mu       sync.Mutex
+	tokens   Tokens
+	reported bool
+}
+
+type sinkKey struct{}
+
+func WithSink(ctx context.Context) (context.Context, *Sink) {
+	s := &Sink{}
+	return context.WithValue(ctx, sinkKey{}, s), s
+}
+
+// Report 记录真实用量，ctx 中没有接收器时忽略。
+func Report(ctx context.Context, input, output int) {
+	s, ok := ctx.Value(sinkKey{}).(*Sink)
+	if !ok || s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = Tokens{Input: input, Output: output}
+	s.reported = true
+}
+
+// Reported 返回 ctx 中已上报的用量，供录制等中间层读取。
+func Reported(ctx context.Context) (Tokens, bool) {
+	s, ok := ctx.Value(sinkKey{}).(*Sink)
+	if !ok || s == nil {
+		return Tokens{}, false
+	}
+	return s.Tokens()
+}
+
+func (s *Sink) Tokens() (Tokens, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens, s.reported
+}
+
+// Estimate 用 cl100k_base 分词器统计文本的 token 数；分词器不可用时退回 approximate。
+func Estimate(text string) int {
+	if text == "" {
+		return 0
+	}
+	if t := tokenizer(); t != nil {
+		return len(t.Encode(text, nil, nil))
+	}
+	return approximate(text)
+}
+
+// approximate 按字符数近似：CJK 等宽字符约 1 token/字，其余按约 4 字符/token 计。
+func approximate(text string) int {
+	wide, other := 0, 0
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			wide++
+		default:
+			other++
+		}
+	}
+	return wide + (other+3)/4
+}
@@ -0,0 +1,83 @@
+package usage
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSinkReport(t *testing.T) {
+	Report(context.Background(), 1, 2)
+
+	ctx, sink := WithSink(context.Background())
+	if _, ok := sink.Tokens(); ok {
+		t.Fatalf("fresh sink must not be reported")
+	}
+	Report(ctx, 120, 30)
+	got, ok := Reported(ctx)
+	if !ok || got.Input != 120 || got.Output != 30 {
+		t.Fatalf("unexpected tokens: %#v %v", got, ok)
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	if Estimate("") != 0 {
+		t.Fatalf("empty text should be 0 tokens")
+	}
+	if got := approximate("你好世界"); got != 4 {
+		t.Fatalf("cjk estimate=%d", got)
+	}
+	if got := approximate("abcdefgh"); got != 2 {
+		t.Fatalf("ascii estimate=%d", got)
+	}
+	if !TokenizerAvailable() {
+		t.Skip("tiktoken vocabulary unavailable (offline)")
+	}
+	if got := Estimate("hello world"); got != 2 {
+		t.Fatalf("tokenizer count=%d", got)
+	}
+}
+
+func TestParseBpeAndCachedLoad(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TIKTOKEN_CACHE_DIR", dir)
+	data := "aGVsbG8= 0\nIHdvcmxk 1\n"
+	if err := os.WriteFile(filepath.Join(dir, "test.tiktoken"), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ranks, err := bpeLoader{}.LoadTiktokenBpe("https://example.invalid/encodings/test.tiktoken")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if ranks["hello"] != 0 || ranks[" world"] != 1 || len(ranks) != 2 {
+		t.Fatalf("unexpected ranks: %#v", ranks)
+	}
+	if _, err := parseBpe([]byte("bad-line")); err == nil {
+		t.Fatalf("expected error for malformed line")
+	}
+}
+
+func TestPriceTableLookupAndCost(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "prices.yaml")
+	data := "currency: USD\nmodels:\n  gpt-4o:\n    input: 2.5\n    output: 10\n  gpt-4o-mini:\n    input: 0.15\n    output: 0.6\n  default:\n    input: 1\n    output: 2\n"
+	if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	table, err := LoadPriceTable(file)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	p, _ := table.Lookup("gpt-4o-mini-2024-07-18")
+	if p.Input != 0.15 {
+		t.Fatalf("longest prefix should win: %#v", p)
+	}
+	p, _ = table.Lookup("some-other-model")
+	if p.Input != 1 {
+		t.Fatalf("default should be used: %#v", p)
+	}
+	if c := (Price{Input: 2.5, Output: 10}).Cost(Tokens{Input: 1_000_000, Output: 100_000}); math.Abs(c-3.5) > 1e-9 {
+		t.Fatalf("unexpected cost %v", c)
+	}
+}